@@ -52,8 +52,9 @@ func setCollectdVersionEnvvar() {
 func doStatus() {
 	set := flag.NewFlagSet("status", flag.ExitOnError)
 	configPath := set.String("config", getDefaultConfigPath(), "agent config path")
+	format := set.String("format", "text", "output format, one of text, json or yaml")
 	set.Usage = func() {
-		fmt.Fprintf(set.Output(), "Usage: signalfx-agent status [all | monitors | config | endpoints]\n\n"+
+		fmt.Fprintf(set.Output(), "Usage: signalfx-agent status [-format text|json|yaml] [all | monitors | config | endpoints]\n\n"+
 			"  The optional section arg can be one of the following:\n"+
 			"    all - Dump everything available\n"+
 			"    monitors - Show information about all active monitors\n"+
@@ -75,7 +76,7 @@ func doStatus() {
 		os.Exit(4)
 	}
 
-	status, err := core.Status(*configPath, section)
+	status, err := core.Status(*configPath, section, *format)
 	if err != nil {
 		fmt.Printf("Could not get status: %s\nAre you sure the agent is currently running?\n", err)
 		os.Exit(1)
@@ -84,14 +85,81 @@ func doStatus() {
 	fmt.Println("")
 }
 
+// Evaluate a discovery rule against the endpoints discovered by an existing
+// instance of the agent.
+func doDebugRule() {
+	set := flag.NewFlagSet("debug-rule", flag.ExitOnError)
+	configPath := set.String("config", getDefaultConfigPath(), "agent config path")
+	format := set.String("format", "text", "output format, one of text, json or yaml")
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "Usage: signalfx-agent debug-rule [-format text|json|yaml] '<discovery rule>'\n\n"+
+			"  Evaluates the discovery rule against every endpoint currently discovered by\n"+
+			"  the running agent and shows whether it matched, the variables available to\n"+
+			"  the rule and any identifiers in the rule that the endpoint does not have.\n\n")
+		set.PrintDefaults()
+	}
+
+	_ = set.Parse(os.Args[2:])
+	if len(set.Args()) != 1 {
+		set.Usage()
+		os.Exit(4)
+	}
+
+	log.SetLevel(log.ErrorLevel)
+
+	out, err := core.DebugDiscoveryRule(*configPath, set.Args()[0], *format)
+	if err != nil {
+		fmt.Printf("Could not evaluate discovery rule: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(out))
+	fmt.Println("")
+}
+
+// Check the config for problems without running the agent, exiting non-zero
+// if there are any
+func doValidateConfig() {
+	set := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	configPath := set.String("config", getDefaultConfigPath(), "agent config path")
+	set.Usage = func() {
+		fmt.Fprintf(set.Output(), "Usage: signalfx-agent validate-config [-config <path>]\n\n"+
+			"  Loads the agent config, including all remote config values, and checks it\n"+
+			"  for problems without starting the agent.  Exits with a non-zero status and\n"+
+			"  lists each problem if the config is invalid.\n\n")
+		set.PrintDefaults()
+	}
+
+	_ = set.Parse(os.Args[2:])
+	if len(set.Args()) > 0 {
+		set.Usage()
+		os.Exit(4)
+	}
+
+	log.SetLevel(log.ErrorLevel)
+	log.SetOutput(os.Stderr)
+
+	errs := core.ValidateConfig(*configPath)
+	if len(errs) > 0 {
+		fmt.Printf("Config %s is invalid:\n", *configPath)
+		for _, err := range errs {
+			fmt.Printf("  - %s\n", strings.ReplaceAll(err.Error(), "\n", "\n    "))
+		}
+		os.Exit(1)
+	}
+	fmt.Printf("Config %s is valid\n", *configPath)
+}
+
 // Print out agent self-description of config/metadata
 func doSelfDescribe() {
 	log.SetOutput(os.Stderr)
 	selfdescribe.JSON(os.Stdout)
 }
 
-var dpTapUsage = `
-If no filters are specified, all datapoints will be output.
+var tapUsage = `
+If no filters are specified, everything will be output.  The -metric filter
+matches the metric name of datapoints, the event type of events and the name
+of trace spans.  The -dims filter matches the dimensions of datapoints and
+events, the tags of trace spans and the name/value of dimension updates.
 
 Examples:
 
@@ -99,34 +167,52 @@ Examples:
 
     signalfx-agent tap-dps -metric 'ps_*' -dims '{plugin_instance: java*}'
 
+  Get all dimension updates for Kubernetes pods as JSON:
+
+    signalfx-agent tap-dims -dims '{kubernetes_pod_uid: "*"}' -json | jq .
+
 `
 
-func doDatapointTap() {
-	set := flag.NewFlagSet("tap-dps", flag.ExitOnError)
+// The diagnostic server paths of each tap subcommand
+var tapPaths = map[string]string{
+	"tap-dps":    "/tap-dps",
+	"tap-events": "/tap-events",
+	"tap-spans":  "/tap-spans",
+	"tap-dims":   "/tap-dims",
+}
+
+func doTap(subcommand string) {
+	set := flag.NewFlagSet(subcommand, flag.ExitOnError)
 	set.Usage = func() {
-		fmt.Fprintf(set.Output(), "Usage of %s tap-dps:\n", os.Args[0])
+		fmt.Fprintf(set.Output(), "Usage of %s %s:\n", os.Args[0], subcommand)
 		set.PrintDefaults()
-		fmt.Fprint(set.Output(), dpTapUsage)
+		fmt.Fprint(set.Output(), tapUsage)
 	}
 
 	configPath := set.String("config", getDefaultConfigPath(), "agent config path")
-	metric := set.String("metric", "", "metric name filter string -- accepts globs")
+	metric := set.String("metric", "", "metric name (or event type/span name) filter string -- accepts globs")
 	dims := set.String("dims", "", "dimension filter string in compact YAML map notation -- dimension values can be globbed")
+	asJSON := set.Bool("json", false, "output one JSON object per line instead of human readable text")
 
 	if err := set.Parse(os.Args[2:]); err != nil {
 		set.Usage()
 		os.Exit(1)
 	}
 
-	stream, err := core.StreamDatapoints(*configPath, *metric, *dims)
+	format := "text"
+	if *asJSON {
+		format = "json"
+	}
+
+	stream, err := core.StreamTap(*configPath, tapPaths[subcommand], *metric, *dims, format)
 	if err != nil {
-		fmt.Printf("Could not stream datapoints: %v", err)
+		fmt.Printf("Could not stream from tap: %v", err)
 		return
 	}
 
 	_, err = io.Copy(os.Stdout, stream)
 	if err != io.EOF && err != nil {
-		fmt.Printf("Error streaming datapoints: %v", err)
+		fmt.Printf("Error streaming from tap: %v", err)
 	}
 }
 
@@ -254,8 +340,12 @@ func Run() {
 		doStatus()
 	case "selfdescribe":
 		doSelfDescribe()
-	case "tap-dps":
-		doDatapointTap()
+	case "validate-config":
+		doValidateConfig()
+	case "debug-rule":
+		doDebugRule()
+	case "tap-dps", "tap-events", "tap-spans", "tap-dims":
+		doTap(firstArg)
 	default:
 		if firstArg != "" && !strings.HasPrefix(firstArg, "-") {
 			log.Errorf("Unknown subcommand '%s'", firstArg)
@@ -212,26 +212,41 @@ func Startup(configPath string) (context.CancelFunc, <-chan struct{}) {
 	return cancel, shutdownComplete
 }
 
-// Status reads the text from the diagnostic socket and returns it if available.
-func Status(configPath string, section string) ([]byte, error) {
+// Status reads the status from the diagnostic socket in the given format
+// (text, json or yaml) and returns it if available.
+func Status(configPath string, section string, format string) ([]byte, error) {
 	configLoads, err := config.LoadConfig(context.Background(), configPath)
 	if err != nil {
 		return nil, err
 	}
 
 	conf := <-configLoads
-	return readStatusInfo(conf.InternalStatusHost, conf.InternalStatusPort, section)
+	return readStatusInfo(conf.InternalStatusHost, conf.InternalStatusPort, section, format)
 }
 
-// StreamDatapoints reads the text from the diagnostic socket and returns it if available.
-func StreamDatapoints(configPath string, metric string, dims string) (io.ReadCloser, error) {
+// DebugDiscoveryRule evaluates a discovery rule against all of the endpoints
+// discovered by a running agent and returns the results in the given format.
+func DebugDiscoveryRule(configPath string, rule string, format string) ([]byte, error) {
 	configLoads, err := config.LoadConfig(context.Background(), configPath)
 	if err != nil {
 		return nil, err
 	}
 
 	conf := <-configLoads
-	return streamDatapoints(conf.InternalStatusHost, conf.InternalStatusPort, metric, dims)
+	return readDiscoveryRuleResults(conf.InternalStatusHost, conf.InternalStatusPort, rule, format)
+}
+
+// StreamTap streams the output of one of the taps (`/tap-dps`,
+// `/tap-events`, `/tap-spans` or `/tap-dims`) from the diagnostic server of
+// a running agent in the given format.
+func StreamTap(configPath string, path string, metric string, dims string, format string) (io.ReadCloser, error) {
+	configLoads, err := config.LoadConfig(context.Background(), configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := <-configLoads
+	return streamTap(conf.InternalStatusHost, conf.InternalStatusPort, path, metric, dims, format)
 }
 
 func startSyncClusterProperty(dimChan chan *types.Dimension, cluster string, hostDims map[string]string, setOnHost bool) {
@@ -1,5 +1,7 @@
 package dpmeta
 
+import "time"
+
 // constants for standard datapoint Meta fields that the agent uses
 const (
 	// The monitor instance id
@@ -15,4 +17,18 @@ const (
 	// host that collectd is running on (e.g. cluster wide metrics in a k8s
 	// cluster).
 	NotHostSpecificMeta = "sfx-not-host-specific"
+	// An *Exemplar of a measurement that contributed to the datapoint's
+	// value, if the source provided one.
+	ExemplarMeta = "sfx-exemplar"
 )
+
+// Exemplar is an example measurement, such as from a traced request, that
+// contributed to the value of a datapoint.
+type Exemplar struct {
+	TraceID   string
+	SpanID    string
+	Value     float64
+	Timestamp time.Time
+	// Any labels on the exemplar other than the trace and span ids
+	Labels map[string]string
+}
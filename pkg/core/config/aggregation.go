@@ -0,0 +1,92 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
+)
+
+// The functions that can be used to aggregate datapoints
+const (
+	AggregationSum   = "sum"
+	AggregationAvg   = "avg"
+	AggregationMax   = "max"
+	AggregationMin   = "min"
+	AggregationCount = "count"
+)
+
+const defaultAggregationInterval = 10 * time.Second
+
+// AggregationConfig describes how to roll up a set of datapoints into fewer
+// time series by removing dimensions and combining the values of the series
+// that end up with the same dimensions.
+type AggregationConfig struct {
+	// A list of metric names to aggregate.  These support the same globbing
+	// and regex syntax as datapoint filters.
+	MetricNames []string `yaml:"metricNames"`
+	// A map of dimension key/values that datapoints must have to be
+	// aggregated by this rule, in the same format as datapoint filters.
+	Dimensions map[string]interface{} `yaml:"dimensions"`
+	// The dimensions to keep on the aggregated datapoints.  All other
+	// dimensions are removed.  Only one of `groupBy` and `dropDimensions`
+	// can be set.
+	GroupBy []string `yaml:"groupBy"`
+	// The dimensions to remove from the aggregated datapoints.  All other
+	// dimensions are kept.
+	DropDimensions []string `yaml:"dropDimensions"`
+	// How to combine the values of the series that are aggregated together:
+	// `sum`, `avg`, `max`, `min` or `count` (the number of series).  Only
+	// `sum` keeps the original metric type, the others are sent as gauges.
+	Function string `yaml:"function"`
+	// How often to send the aggregated datapoints.  Only the latest value of
+	// each series within this interval (or the total, for delta counters)
+	// is used.  A series that isn't sent in an interval keeps its last
+	// value for up to 5 intervals so that aggregates don't dip when a
+	// series is late.  Defaults to 10s.
+	Interval timeutil.Duration `yaml:"interval"`
+}
+
+// Validate the aggregation config
+func (ac *AggregationConfig) Validate() error {
+	if len(ac.MetricNames) == 0 {
+		return errors.New("metricNames must be set")
+	}
+	if len(ac.GroupBy) > 0 && len(ac.DropDimensions) > 0 {
+		return errors.New("only one of groupBy and dropDimensions can be set")
+	}
+	if len(ac.GroupBy) == 0 && len(ac.DropDimensions) == 0 {
+		return errors.New("either groupBy or dropDimensions must be set")
+	}
+	switch ac.Function {
+	case AggregationSum, AggregationAvg, AggregationMax, AggregationMin, AggregationCount:
+	default:
+		return fmt.Errorf("function '%s' is not one of sum, avg, max, min or count", ac.Function)
+	}
+	if ac.Interval.AsDuration() < 0 {
+		return errors.New("interval must be positive")
+	}
+	_, err := ac.Filter()
+	return err
+}
+
+// Filter returns a filter that matches the datapoints that should be
+// aggregated by this rule.
+func (ac *AggregationConfig) Filter() (dpfilters.DatapointFilter, error) {
+	mf := MetricFilter{
+		MetricNames: ac.MetricNames,
+		Dimensions:  ac.Dimensions,
+	}
+	return mf.MakeFilter()
+}
+
+// IntervalOrDefault returns the configured interval, or the default if it
+// isn't set.
+func (ac *AggregationConfig) IntervalOrDefault() time.Duration {
+	if ac.Interval.AsDuration() <= 0 {
+		return defaultAggregationInterval
+	}
+	return ac.Interval.AsDuration()
+}
@@ -102,6 +102,15 @@ type Config struct {
 	Observers []ObserverConfig `yaml:"observers" default:"[]"`
 	// A list of monitors to use (see monitor config)
 	Monitors []MonitorConfig `yaml:"monitors" default:"[]"`
+	// A map of named monitor config templates.  Each template is a monitor
+	// config whose string values can refer to parameters with Go template
+	// syntax (e.g. `"{{.database}}"`).  Monitors can instantiate a template
+	// with the `monitorTemplate` and `monitorTemplateParams` monitor options.
+	MonitorTemplates map[string]map[string]interface{} `yaml:"monitorTemplates" default:"{}" neverLog:"omit"`
+	// A list of config overlays that are deep merged, in order, on top of
+	// this config if their conditions match the current host (see overlay
+	// config)
+	Overlays []OverlayConfig `yaml:"overlays" default:"[]"`
 	// Configuration of the datapoint/event writer
 	Writer WriterConfig `yaml:"writer"`
 	// Log configuration
@@ -125,6 +134,8 @@ type Config struct {
 	// The host on which the internal status server will listen.  The internal
 	// status HTTP server serves internal metrics and diagnostic information
 	// about the agent and can be scraped by the `internal-metrics` monitor.
+	// The same metrics are served in the Prometheus/OpenMetrics exposition
+	// format at the `/metrics/prometheus` path for scraping by Prometheus.
 	// Can be set to `0.0.0.0` if you want to monitor the agent from another
 	// host.  If you set this to blank/null, the internal status server will
 	// not be started.  See `internalStatusPort`.
@@ -250,6 +261,16 @@ func (c *Config) validate() error {
 		return err
 	}
 
+	monitorIDs := map[string]bool{}
+	for i := range c.Monitors {
+		if id := c.Monitors[i].ID; id != "" {
+			if monitorIDs[id] {
+				return fmt.Errorf("monitor config id '%s' is used more than once", id)
+			}
+			monitorIDs[id] = true
+		}
+	}
+
 	for i := range c.Monitors {
 		if err := c.Monitors[i].Validate(); err != nil {
 			return fmt.Errorf("monitor config for type '%s' is invalid: %v", c.Monitors[i].Type, err)
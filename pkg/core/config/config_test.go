@@ -59,3 +59,50 @@ func TestWriterOutputValidation(t *testing.T) {
 		require.Nil(t, err)
 	})
 }
+
+func TestWriterOutputConfigs(t *testing.T) {
+	t.Run("legacy options are converted to outputs", func(t *testing.T) {
+		wc := &WriterConfig{
+			Splunk: &SplunkConfig{Enabled: true, URL: "https://splunk:8088"},
+		}
+		outputs := wc.OutputConfigs()
+		require.Len(t, outputs, 2)
+		require.Equal(t, "signalfx", outputs[0].Type)
+		require.Equal(t, "splunk", outputs[1].Type)
+		require.Equal(t, "https://splunk:8088", outputs[1].OtherConfig["url"])
+		require.NotContains(t, outputs[1].OtherConfig, "enabled")
+	})
+
+	t.Run("output names must be unique", func(t *testing.T) {
+		c := &Config{
+			Writer: WriterConfig{
+				Outputs: []OutputConfig{
+					{Type: "signalfx"},
+					{Type: "signalfx"},
+				},
+			},
+		}
+		require.Nil(t, defaults.Set(c))
+
+		err := c.validate()
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "used more than once")
+
+		c.Writer.Outputs[1].Name = "other"
+		require.Nil(t, c.validate())
+	})
+
+	t.Run("otlp is only supported as an output", func(t *testing.T) {
+		c := &Config{
+			Writer: WriterConfig{TraceExportFormat: "otlp"},
+		}
+		require.Nil(t, defaults.Set(c))
+
+		err := c.validate()
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "type: otlp")
+
+		c.Writer.TraceExportFormat = "SAPM"
+		require.Nil(t, c.validate())
+	})
+}
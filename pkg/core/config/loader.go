@@ -97,9 +97,17 @@ func LoadConfig(ctx context.Context, configPath string) (<-chan *Config, error)
 func loadYAML(fileContent []byte) (*Config, error) {
 	config := &Config{}
 
-	preprocessedContent := preprocessConfig(fileContent)
+	preprocessedContent, err := applyOverlays(preprocessConfig(fileContent))
+	if err != nil {
+		return nil, err
+	}
+
+	preprocessedContent, err = expandMonitorTemplates(preprocessedContent)
+	if err != nil {
+		return nil, err
+	}
 
-	err := yaml.UnmarshalStrict(preprocessedContent, config)
+	err = yaml.UnmarshalStrict(preprocessedContent, config)
 	if err != nil {
 		return nil, utils.YAMLErrorWithContext(preprocessedContent, err)
 	}
@@ -497,6 +497,185 @@ var _ = Describe("Config Loader", func() {
 		Expect(config.SignalFxAccessToken).Should(Equal(`s3cr3t`))
 	})
 
+	It("Merges matching overlays into the config", func() {
+		mkFile("agent/overlays/app.yaml", outdent(`
+			intervalSeconds: 20
+			globalDimensions:
+			  team: app
+			monitors:
+			- id: cpu
+			  extraMetrics: [cpu.idle]
+			- type: redis
+			  host: localhost
+			  port: 6379
+		`))
+		mkFile("agent/overlays/other.yaml", outdent(`
+			intervalSeconds: 30
+		`))
+
+		path := mkFile("agent/agent.yaml", outdent(fmt.Sprintf(`
+			signalFxAccessToken: abcd
+			hostname: web-1
+			globalDimensions:
+			  env: prod
+			monitors:
+			- id: cpu
+			  type: cpu
+			  extraDimensions:
+			    a: b
+			- type: memory
+			overlays:
+			- hostnames: ["web-*"]
+			  config: {"#from": '%s/agent/overlays/app.yaml'}
+			- hostnames: ["db-*"]
+			  config: {"#from": '%s/agent/overlays/other.yaml'}
+		`, dir, dir)))
+
+		loads, err := LoadConfig(ctx, path)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var config *Config
+		Eventually(loads).Should(Receive(&config))
+
+		Expect(config.IntervalSeconds).To(Equal(20))
+		Expect(config.GlobalDimensions).To(Equal(map[string]string{"env": "prod", "team": "app"}))
+		Expect(config.Monitors).To(HaveLen(3))
+		Expect(config.Monitors[0].Type).To(Equal("cpu"))
+		Expect(config.Monitors[0].ExtraMetrics).To(Equal([]string{"cpu.idle"}))
+		Expect(config.Monitors[0].ExtraDimensions).To(Equal(map[string]string{"a": "b"}))
+		Expect(config.Monitors[1].Type).To(Equal("memory"))
+		Expect(config.Monitors[2].Type).To(Equal("redis"))
+	})
+
+	It("Applies overlays based on envvars", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			overlays:
+			- envVars:
+			    OVERLAY_TEST_ENV: "stag*"
+			  config:
+			    intervalSeconds: 5
+			- envVars:
+			    OVERLAY_TEST_ENV: "prod"
+			  config:
+			    intervalSeconds: 60
+		`))
+
+		os.Setenv("OVERLAY_TEST_ENV", "staging")
+		loads, err := LoadConfig(ctx, path)
+		os.Unsetenv("OVERLAY_TEST_ENV")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var config *Config
+		Eventually(loads).Should(Receive(&config))
+
+		Expect(config.IntervalSeconds).To(Equal(5))
+	})
+
+	It("Errors on duplicate monitor ids", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			monitors:
+			- id: cpu
+			  type: cpu
+			- id: cpu
+			  type: load
+		`))
+		_, err := LoadConfig(ctx, path)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Expands monitor templates", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			monitorTemplates:
+			  pg:
+			    type: postgresql
+			    host: db.example.com
+			    port: "{{.port}}"
+			    connectionString: "dbname={{.db}} sslmode=disable"
+			    extraDimensions:
+			      team: "{{.team}}"
+			monitors:
+			- monitorTemplate: pg
+			  monitorTemplateParams: {db: orders, team: a, port: 5432}
+			- monitorTemplate: pg
+			  monitorTemplateParams: {db: users, team: b, port: 5433}
+			  intervalSeconds: 30
+			  extraDimensions:
+			    tier: gold
+		`))
+
+		loads, err := LoadConfig(ctx, path)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var config *Config
+		Eventually(loads).Should(Receive(&config))
+
+		Expect(config.Monitors).To(HaveLen(2))
+		Expect(config.Monitors[0].Type).To(Equal("postgresql"))
+		Expect(config.Monitors[0].MonitorTemplate).To(Equal("pg"))
+		Expect(config.Monitors[0].OtherConfig["port"]).To(Equal(5432))
+		Expect(config.Monitors[0].OtherConfig["connectionString"]).To(Equal("dbname=orders sslmode=disable"))
+		Expect(config.Monitors[0].ExtraDimensions).To(Equal(map[string]string{"team": "a"}))
+		Expect(config.Monitors[1].IntervalSeconds).To(Equal(30))
+		Expect(config.Monitors[1].OtherConfig["port"]).To(Equal(5433))
+		Expect(config.Monitors[1].ExtraDimensions).To(Equal(map[string]string{"team": "b", "tier": "gold"}))
+	})
+
+	It("Errors on undefined monitor templates", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			monitors:
+			- monitorTemplate: nope
+		`))
+		_, err := LoadConfig(ctx, path)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Leaves references to unknown monitor template params alone", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			monitorTemplates:
+			  custom:
+			    type: collectd/custom
+			    template: |
+			      <Plugin "{{.plugin}}">
+			        Host "{{.Host}}"
+			      </Plugin>
+			monitors:
+			- monitorTemplate: custom
+			  monitorTemplateParams: {plugin: redis}
+		`))
+
+		loads, err := LoadConfig(ctx, path)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var config *Config
+		Eventually(loads).Should(Receive(&config))
+
+		Expect(config.Monitors[0].OtherConfig["template"]).To(Equal("<Plugin \"redis\">\n  Host \"{{.Host}}\"\n</Plugin>\n"))
+	})
+
+	It("Doesn't treat the collectd/custom template option as a monitor template", func() {
+		path := mkFile("agent/agent.yaml", outdent(`
+			signalFxAccessToken: abcd
+			monitors:
+			- type: collectd/custom
+			  template: "LoadPlugin foo"
+		`))
+
+		loads, err := LoadConfig(ctx, path)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var config *Config
+		Eventually(loads).Should(Receive(&config))
+
+		Expect(config.Monitors[0].Type).To(Equal("collectd/custom"))
+		Expect(config.Monitors[0].MonitorTemplate).To(Equal(""))
+		Expect(config.Monitors[0].OtherConfig["template"]).To(Equal("LoadPlugin foo"))
+	})
+
 })
 
 func TestLoader(t *testing.T) {
@@ -22,6 +22,19 @@ import (
 type MonitorConfig struct {
 	// The type of the monitor
 	Type string `yaml:"type" json:"type"`
+	// An optional unique identifier for this monitor config.  Config
+	// overlays can refer to it to merge their own settings into this monitor
+	// config instead of adding a new one.
+	ID string `yaml:"id" json:"id" hash:"ignore"`
+	// The name of a template in the top-level `monitorTemplates` section to
+	// base this monitor config on.  Any other options set on this monitor
+	// config are merged on top of the rendered template.
+	MonitorTemplate string `yaml:"monitorTemplate" json:"monitorTemplate"`
+	// The parameters used to render the template given in `monitorTemplate`.
+	// A template string value that consists solely of a single parameter
+	// reference (e.g. `"{{.port}}"`) is replaced by the parameter value
+	// itself, so that non-string parameters retain their type.
+	MonitorTemplateParams map[string]interface{} `yaml:"monitorTemplateParams" json:"monitorTemplateParams"`
 	// The rule used to match up this configuration with a discovered endpoint.
 	// If blank, the configuration will be run immediately when the agent is
 	// started.  If multiple endpoints match this rule, multiple instances of
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// expandMonitorTemplates replaces each monitor config in the config content
+// that refers to a template in the `monitorTemplates` section with the
+// rendered template, merging any other options in the monitor config on top
+// of it.  If no monitors use templates the original content is returned
+// as-is.
+func expandMonitorTemplates(content []byte) ([]byte, error) {
+	var conf map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		// Let the strict unmarshal report the error with proper context
+		return content, nil
+	}
+
+	monitors, _ := conf["monitors"].([]interface{})
+
+	var usesTemplates bool
+	for _, m := range monitors {
+		if mc, ok := m.(map[interface{}]interface{}); ok && mc["monitorTemplate"] != nil {
+			usesTemplates = true
+			break
+		}
+	}
+	if !usesTemplates {
+		return content, nil
+	}
+
+	templates, _ := conf["monitorTemplates"].(map[interface{}]interface{})
+
+	for i, m := range monitors {
+		mc, ok := m.(map[interface{}]interface{})
+		if !ok || mc["monitorTemplate"] == nil {
+			continue
+		}
+
+		name, ok := mc["monitorTemplate"].(string)
+		if !ok {
+			return nil, fmt.Errorf("monitor %d has a non-string template name", i)
+		}
+
+		tmpl, ok := templates[name].(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("monitor template '%s' is not defined", name)
+		}
+		if _, ok := tmpl["monitorTemplate"]; ok {
+			return nil, fmt.Errorf("monitor template '%s' cannot itself use a template", name)
+		}
+
+		params := map[string]interface{}{}
+		if rawParams, ok := mc["monitorTemplateParams"].(map[interface{}]interface{}); ok {
+			for k, v := range rawParams {
+				params[fmt.Sprintf("%v", k)] = v
+			}
+		}
+
+		unmatched := map[string]bool{}
+		rendered, err := renderTemplateValue(tmpl, params, unmatched)
+		if err != nil {
+			return nil, fmt.Errorf("could not render monitor template '%s': %v", name, err)
+		}
+		for _, param := range sortedKeys(unmatched) {
+			log.WithFields(log.Fields{
+				"monitorTemplate": name,
+				"param":           param,
+			}).Warn("Monitor template refers to a param that is not in monitorTemplateParams, leaving it as-is")
+		}
+
+		renderedMap := rendered.(map[interface{}]interface{})
+		mergeOverlay(renderedMap, mc, false)
+		monitors[i] = renderedMap
+	}
+
+	return yaml.Marshal(conf)
+}
+
+var paramRefRE = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// renderTemplateValue makes a copy of a generic YAML value, replacing every
+// reference to one of the params (e.g. `{{.port}}`) in its strings with the
+// param value.  Anything else that looks like a template, such as `{{.Host}}`
+// in a collectd/custom template, is left alone so that monitors can render
+// it themselves at runtime.  The names of those references are added to
+// unmatched so that typos in param names can be reported.
+func renderTemplateValue(val interface{}, params map[string]interface{}, unmatched map[string]bool) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		// A string that is nothing but a single param reference is replaced
+		// by the param value as-is so that non-string params keep their type.
+		if match := paramRefRE.FindStringSubmatch(v); match != nil && match[0] == v {
+			if p, ok := params[match[1]]; ok {
+				return p, nil
+			}
+		}
+		return paramRefRE.ReplaceAllStringFunc(v, func(ref string) string {
+			param := paramRefRE.FindStringSubmatch(ref)[1]
+			if p, ok := params[param]; ok {
+				return fmt.Sprintf("%v", p)
+			}
+			unmatched[param] = true
+			return ref
+		}), nil
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := renderTemplateValue(item, params, unmatched)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderTemplateValue(item, params, unmatched)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
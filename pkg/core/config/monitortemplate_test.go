@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplateValue(t *testing.T) {
+	tmpl := map[interface{}]interface{}{
+		"port": "{{.port}}",
+		"hosts": []interface{}{
+			"{{ .host }}:{{.port}}",
+			"{{.Host}}",
+		},
+		"db": "dbname={{.dbname}}",
+	}
+
+	unmatched := map[string]bool{}
+	rendered, err := renderTemplateValue(tmpl, map[string]interface{}{"port": 5432, "host": "db1", "db": "orders"}, unmatched)
+	require.Nil(t, err)
+
+	require.Equal(t, map[interface{}]interface{}{
+		"port": 5432,
+		"hosts": []interface{}{
+			"db1:5432",
+			"{{.Host}}",
+		},
+		"db": "dbname={{.dbname}}",
+	}, rendered)
+	require.Equal(t, map[string]bool{"Host": true, "dbname": true}, unmatched)
+}
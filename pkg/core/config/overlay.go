@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gobwas/glob"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OverlayConfig is a partial agent config that is deep merged on top of the
+// main config file if its conditions match the host the agent is running on.
+// This lets separate teams own separate config files that get combined at
+// load time.
+type OverlayConfig struct {
+	// A list of globs that are matched against the agent's hostname (the
+	// `hostname` config option if set, otherwise the OS hostname).  If
+	// provided, the overlay is only applied if at least one of them matches.
+	Hostnames []string `yaml:"hostnames"`
+	// A map of envvar names to globs that the envvar's value must match.  If
+	// provided, the overlay is only applied if all of them match.  An unset
+	// envvar is treated as an empty string.
+	EnvVars map[string]string `yaml:"envVars"`
+	// The config to merge into the main config.  This is most commonly
+	// a reference to another file or remote config path, e.g. `{"#from":
+	// "/etc/signalfx/overlays/myapp.yaml"}`.  Maps are merged recursively,
+	// while scalar values and lists replace what was there before, with the
+	// exception of the top-level `monitors` list.  Monitor configs in that
+	// list that have an `id` matching a monitor config in the main config are
+	// merged into that monitor, while all others are appended to the list.
+	Config map[string]interface{} `yaml:"config" neverLog:"omit"`
+}
+
+// applyOverlays merges all of the overlays that match the current host into
+// the config content and returns the new content.  If there are no overlays
+// configured the original content is returned as-is so that error messages
+// about the config retain their original line numbers.
+func applyOverlays(content []byte) ([]byte, error) {
+	var conf map[interface{}]interface{}
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		// Let the strict unmarshal report the error with proper context
+		return content, nil
+	}
+
+	rawOverlays, ok := conf["overlays"]
+	if !ok || rawOverlays == nil {
+		return content, nil
+	}
+
+	overlaysYAML, err := yaml.Marshal(rawOverlays)
+	if err != nil {
+		return nil, err
+	}
+
+	var overlays []OverlayConfig
+	if err := yaml.UnmarshalStrict(overlaysYAML, &overlays); err != nil {
+		return nil, fmt.Errorf("overlays config is invalid: %v", err)
+	}
+
+	hostname, _ := conf["hostname"].(string)
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	for i := range overlays {
+		matches, err := overlays[i].matches(hostname)
+		if err != nil {
+			return nil, fmt.Errorf("overlay %d is invalid: %v", i, err)
+		}
+		if !matches || overlays[i].Config == nil {
+			continue
+		}
+
+		if _, ok := overlays[i].Config["overlays"]; ok {
+			return nil, fmt.Errorf("overlay %d cannot itself contain overlays", i)
+		}
+
+		overlayYAML, err := yaml.Marshal(overlays[i].Config)
+		if err != nil {
+			return nil, err
+		}
+		var overlay map[interface{}]interface{}
+		if err := yaml.Unmarshal(overlayYAML, &overlay); err != nil {
+			return nil, err
+		}
+
+		mergeOverlay(conf, overlay, true)
+	}
+
+	return yaml.Marshal(conf)
+}
+
+func (oc *OverlayConfig) matches(hostname string) (bool, error) {
+	if len(oc.Hostnames) > 0 {
+		var hostMatched bool
+		for _, h := range oc.Hostnames {
+			g, err := glob.Compile(h)
+			if err != nil {
+				return false, fmt.Errorf("hostname glob '%s' is invalid: %v", h, err)
+			}
+			if g.Match(hostname) {
+				hostMatched = true
+				break
+			}
+		}
+		if !hostMatched {
+			return false, nil
+		}
+	}
+
+	for envvar, pattern := range oc.EnvVars {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("envvar glob '%s' is invalid: %v", pattern, err)
+		}
+		if !g.Match(getEnv(envvar)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// mergeOverlay deep merges the overlay into the base map in place.
+func mergeOverlay(base, overlay map[interface{}]interface{}, topLevel bool) {
+	for k, v := range overlay {
+		if topLevel && k == "monitors" {
+			base[k] = mergeMonitorLists(base[k], v)
+			continue
+		}
+
+		baseMap, baseIsMap := base[k].(map[interface{}]interface{})
+		overlayMap, overlayIsMap := v.(map[interface{}]interface{})
+		if baseIsMap && overlayIsMap {
+			mergeOverlay(baseMap, overlayMap, false)
+			continue
+		}
+		base[k] = v
+	}
+}
+
+// mergeMonitorLists merges monitor configs from the overlay that have an id
+// matching one in the base list, and appends the rest.
+func mergeMonitorLists(base, overlay interface{}) interface{} {
+	baseList, _ := base.([]interface{})
+	overlayList, ok := overlay.([]interface{})
+	if !ok {
+		return overlay
+	}
+
+	out := append([]interface{}{}, baseList...)
+OUTER:
+	for _, o := range overlayList {
+		overlayMonitor, ok := o.(map[interface{}]interface{})
+		if !ok {
+			out = append(out, o)
+			continue
+		}
+
+		if id, ok := overlayMonitor["id"].(string); ok && id != "" {
+			for _, b := range out {
+				if baseMonitor, ok := b.(map[interface{}]interface{}); ok && baseMonitor["id"] == id {
+					mergeOverlay(baseMonitor, overlayMonitor, false)
+					continue OUTER
+				}
+			}
+		}
+		out = append(out, overlayMonitor)
+	}
+	return out
+}
+
+// getEnv gets an envvar, falling back to the cache of envvars that have
+// already been read and sanitized from the process environment.
+func getEnv(envvar string) string {
+	if val, ok := envVarCache[envvar]; ok {
+		return val
+	}
+	return os.Getenv(envvar)
+}
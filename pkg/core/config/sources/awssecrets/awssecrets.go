@@ -0,0 +1,336 @@
+// Package awssecrets contains a config source that reads values from AWS SSM
+// Parameter Store and AWS Secrets Manager.
+package awssecrets
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/gobwas/glob"
+	"github.com/hashicorp/go-secure-stdlib/awsutil"
+	"github.com/mitchellh/hashstructure"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+)
+
+const (
+	servicePrefixSSM            = "ssm:"
+	servicePrefixSecretsManager = "secretsmanager:"
+)
+
+// Config for the AWS config source.  Paths have the form `ssm:<parameter
+// name>` for SSM Parameter Store or `secretsmanager:<secret name>` for
+// Secrets Manager.  Both can be globbed.  Credentials are obtained from the
+// same chain used by the Vault `iam` auth method: the explicit keys below,
+// then the standard AWS envvars, shared credentials file, web identity, and
+// finally the EC2 instance role.
+type Config struct {
+	// The AWS region to use.  Defaults to the `AWS_REGION` envvar or the
+	// region of the EC2 instance the agent is running on.
+	Region string `yaml:"region"`
+	// Explicit AWS access key ID
+	AWSAccessKeyID *string `yaml:"awsAccessKeyId"`
+	// Explicit AWS secret access key
+	AWSSecretAccessKey *string `yaml:"awsSecretAccessKey" neverLog:"true"`
+	// Explicit AWS security token for temporary credentials
+	AWSSecurityToken *string `yaml:"awsSecurityToken" neverLog:"true"`
+	// How often to check parameters and secrets for changes.  This can be
+	// any string value that can be parsed by
+	// https://golang.org/pkg/time/#ParseDuration.
+	PollInterval time.Duration `yaml:"pollInterval" default:"60s"`
+}
+
+// New creates a new AWS config source from the target config
+func (c *Config) New() (types.ConfigSource, error) {
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	creds, err := awsutil.RetrieveCreds(deref(c.AWSAccessKeyID), deref(c.AWSSecretAccessKey), deref(c.AWSSecurityToken), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSession(aws.NewConfig().WithCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	region := c.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region, err = ec2metadata.New(sess).Region()
+		if err != nil {
+			return nil, fmt.Errorf("could not determine AWS region, please set the region option: %v", err)
+		}
+	}
+
+	regionConf := aws.NewConfig().WithRegion(region)
+	return New(ssm.New(sess, regionConf), secretsmanager.New(sess, regionConf), c.PollInterval), nil
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("pollInterval must be positive")
+	}
+	if (c.AWSAccessKeyID == nil) != (c.AWSSecretAccessKey == nil) {
+		return fmt.Errorf("awsAccessKeyId and awsSecretAccessKey must be provided together")
+	}
+	return nil
+}
+
+var _ types.ConfigSourceConfig = &Config{}
+
+type awsConfigSource struct {
+	ssm            ssmiface.SSMAPI
+	secretsManager secretsmanageriface.SecretsManagerAPI
+	pollInterval   time.Duration
+}
+
+// New creates a new AWS ConfigSource that uses the given clients
+func New(ssmClient ssmiface.SSMAPI, smClient secretsmanageriface.SecretsManagerAPI, pollInterval time.Duration) types.ConfigSource {
+	return &awsConfigSource{
+		ssm:            ssmClient,
+		secretsManager: smClient,
+		pollInterval:   pollInterval,
+	}
+}
+
+func (s *awsConfigSource) Name() string {
+	return "aws"
+}
+
+// Get returns the content of the matching parameters or secrets.  Neither
+// service has a version that spans multiple values, so the version is a hash
+// of the content.
+func (s *awsConfigSource) Get(path string) (map[string][]byte, uint64, error) {
+	var contentMap map[string][]byte
+	var err error
+
+	switch {
+	case strings.HasPrefix(path, servicePrefixSSM):
+		contentMap, err = s.getParameters(strings.TrimPrefix(path, servicePrefixSSM))
+	case strings.HasPrefix(path, servicePrefixSecretsManager):
+		contentMap, err = s.getSecrets(strings.TrimPrefix(path, servicePrefixSecretsManager))
+	default:
+		return nil, 0, fmt.Errorf("aws path %s must start with either %s or %s", path, servicePrefixSSM, servicePrefixSecretsManager)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(contentMap) == 0 {
+		return nil, 0, types.NewNotFoundError(fmt.Sprintf("no AWS values matched path %s", path))
+	}
+
+	version, err := hashstructure.Hash(contentMap, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contentMap, version, nil
+}
+
+func isAWSErrorCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
+
+func (s *awsConfigSource) getParameters(name string) (map[string][]byte, error) {
+	prefix, g, isGlob, err := types.PrefixAndGlob(name)
+	if err != nil {
+		return nil, err
+	}
+
+	contentMap := make(map[string][]byte)
+
+	if !isGlob {
+		out, err := s.ssm.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			if isAWSErrorCode(err, ssm.ErrCodeParameterNotFound) {
+				return contentMap, nil
+			}
+			return nil, err
+		}
+		contentMap[name] = []byte(aws.StringValue(out.Parameter.Value))
+		return contentMap, nil
+	}
+
+	// Only hierarchical parameters, whose names start with a /, can be
+	// listed by path.  Others have to be found by name.
+	if !strings.HasPrefix(name, "/") {
+		return s.getParametersByName(types.LiteralPrefix(name), g)
+	}
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	err = s.ssm.GetParametersByPathPages(&ssm.GetParametersByPathInput{
+		Path:           aws.String(prefix),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}, func(page *ssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, p := range page.Parameters {
+			if g.Match(aws.StringValue(p.Name)) {
+				contentMap[aws.StringValue(p.Name)] = []byte(aws.StringValue(p.Value))
+			}
+		}
+		return true
+	})
+	return contentMap, err
+}
+
+func (s *awsConfigSource) getParametersByName(prefix string, g glob.Glob) (map[string][]byte, error) {
+	input := &ssm.DescribeParametersInput{}
+	if prefix != "" {
+		input.ParameterFilters = []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Name"),
+				Option: aws.String("BeginsWith"),
+				Values: []*string{aws.String(prefix)},
+			},
+		}
+	}
+
+	var names []string
+	err := s.ssm.DescribeParametersPages(input, func(page *ssm.DescribeParametersOutput, lastPage bool) bool {
+		for _, p := range page.Parameters {
+			if g.Match(aws.StringValue(p.Name)) {
+				names = append(names, aws.StringValue(p.Name))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	contentMap := make(map[string][]byte)
+	for _, n := range names {
+		out, err := s.ssm.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(n),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			if isAWSErrorCode(err, ssm.ErrCodeParameterNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		contentMap[n] = []byte(aws.StringValue(out.Parameter.Value))
+	}
+	return contentMap, nil
+}
+
+func secretContent(out *secretsmanager.GetSecretValueOutput) []byte {
+	if out.SecretString != nil {
+		return []byte(*out.SecretString)
+	}
+	return out.SecretBinary
+}
+
+func (s *awsConfigSource) getSecrets(name string) (map[string][]byte, error) {
+	_, g, isGlob, err := types.PrefixAndGlob(name)
+	if err != nil {
+		return nil, err
+	}
+
+	contentMap := make(map[string][]byte)
+
+	names := []string{name}
+	if isGlob {
+		// Secret names aren't hierarchical so the name filter can use
+		// everything before the first glob character.
+		names, err = s.listSecretNames(types.LiteralPrefix(name), g)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, n := range names {
+		out, err := s.secretsManager.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(n),
+		})
+		if err != nil {
+			if isAWSErrorCode(err, secretsmanager.ErrCodeResourceNotFoundException) {
+				continue
+			}
+			return nil, err
+		}
+		contentMap[n] = secretContent(out)
+	}
+	return contentMap, nil
+}
+
+func (s *awsConfigSource) listSecretNames(prefix string, g glob.Glob) ([]string, error) {
+	input := &secretsmanager.ListSecretsInput{}
+	if prefix != "" {
+		input.Filters = []*secretsmanager.Filter{
+			{
+				Key:    aws.String(secretsmanager.FilterNameStringTypeName),
+				Values: []*string{aws.String(prefix)},
+			},
+		}
+	}
+
+	var names []string
+	err := s.secretsManager.ListSecretsPages(input, func(page *secretsmanager.ListSecretsOutput, lastPage bool) bool {
+		for _, entry := range page.SecretList {
+			if g.Match(aws.StringValue(entry.Name)) {
+				names = append(names, aws.StringValue(entry.Name))
+			}
+		}
+		return true
+	})
+	return names, err
+}
+
+// WaitForChange polls the path until its content hash differs from the
+// given version.
+func (s *awsConfigSource) WaitForChange(path string, version uint64, stop <-chan struct{}) error {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			_, newVersion, err := s.Get(path)
+			if err != nil {
+				if _, ok := err.(types.ErrNotFound); ok {
+					// Values that were present but are now gone count as a
+					// change.
+					if version != 0 {
+						return nil
+					}
+					continue
+				}
+				log.WithError(err).WithField("path", path).Error("Could not poll AWS for changes")
+				continue
+			}
+			if newVersion != version {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package awssecrets
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+)
+
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	sync.Mutex
+	params map[string]string
+}
+
+func (f *fakeSSM) set(name, value string) {
+	f.Lock()
+	defer f.Unlock()
+	f.params[name] = value
+}
+
+func (f *fakeSSM) GetParameter(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+	v, ok := f.params[*in.Name]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: in.Name, Value: aws.String(v)}}, nil
+}
+
+func (f *fakeSSM) GetParametersByPathPages(in *ssm.GetParametersByPathInput, fn func(*ssm.GetParametersByPathOutput, bool) bool) error {
+	f.Lock()
+	defer f.Unlock()
+	out := &ssm.GetParametersByPathOutput{}
+	for k, v := range f.params {
+		if strings.HasPrefix(k, *in.Path) {
+			out.Parameters = append(out.Parameters, &ssm.Parameter{Name: aws.String(k), Value: aws.String(v)})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeSSM) DescribeParametersPages(in *ssm.DescribeParametersInput, fn func(*ssm.DescribeParametersOutput, bool) bool) error {
+	f.Lock()
+	defer f.Unlock()
+	out := &ssm.DescribeParametersOutput{}
+	for k := range f.params {
+		if len(in.ParameterFilters) == 0 || strings.HasPrefix(k, *in.ParameterFilters[0].Values[0]) {
+			out.Parameters = append(out.Parameters, &ssm.ParameterMetadata{Name: aws.String(k)})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+type fakeSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+}
+
+func (f *fakeSecretsManager) GetSecretValue(in *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	v, ok := f.secrets[*in.SecretId]
+	if !ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceNotFoundException, "not found", nil)
+	}
+	return &secretsmanager.GetSecretValueOutput{Name: in.SecretId, SecretString: aws.String(v)}, nil
+}
+
+func (f *fakeSecretsManager) ListSecretsPages(in *secretsmanager.ListSecretsInput, fn func(*secretsmanager.ListSecretsOutput, bool) bool) error {
+	out := &secretsmanager.ListSecretsOutput{}
+	for k := range f.secrets {
+		if len(in.Filters) == 0 || strings.HasPrefix(k, *in.Filters[0].Values[0]) {
+			out.SecretList = append(out.SecretList, &secretsmanager.SecretListEntry{Name: aws.String(k)})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func newTestSource() (*fakeSSM, types.ConfigSource) {
+	ssmClient := &fakeSSM{params: map[string]string{
+		"/prod/db/password": "s3cr3t",
+		"/prod/db/username": "admin",
+		"/prod/other":       "x",
+		"prod-api-key":      "k",
+		"prod-db-host":      "db",
+	}}
+	smClient := &fakeSecretsManager{secrets: map[string]string{
+		"prod/postgres": `{"password": "pg"}`,
+		"prod/mysql":    `{"password": "my"}`,
+		"dev/mysql":     `{"password": "dev"}`,
+		"prod-redis":    `{"password": "rd"}`,
+	}}
+	return ssmClient, New(ssmClient, smClient, 10*time.Millisecond)
+}
+
+func TestGet(t *testing.T) {
+	_, source := newTestSource()
+
+	t.Run("single parameter", func(t *testing.T) {
+		content, _, err := source.Get("ssm:/prod/db/password")
+		require.Nil(t, err)
+		require.Equal(t, map[string][]byte{"/prod/db/password": []byte("s3cr3t")}, content)
+	})
+
+	t.Run("globbed parameters", func(t *testing.T) {
+		content, _, err := source.Get("ssm:/prod/db/*")
+		require.Nil(t, err)
+		require.Len(t, content, 2)
+		require.Equal(t, []byte("admin"), content["/prod/db/username"])
+	})
+
+	t.Run("globbed parameters without a slash", func(t *testing.T) {
+		content, _, err := source.Get("ssm:prod-*")
+		require.Nil(t, err)
+		require.Equal(t, map[string][]byte{"prod-api-key": []byte("k"), "prod-db-host": []byte("db")}, content)
+
+		content, _, err = source.Get("ssm:*")
+		require.Nil(t, err)
+		require.Len(t, content, 5)
+	})
+
+	t.Run("single secret", func(t *testing.T) {
+		content, _, err := source.Get("secretsmanager:prod/postgres")
+		require.Nil(t, err)
+		require.Equal(t, map[string][]byte{"prod/postgres": []byte(`{"password": "pg"}`)}, content)
+	})
+
+	t.Run("globbed secrets", func(t *testing.T) {
+		content, _, err := source.Get("secretsmanager:prod/*")
+		require.Nil(t, err)
+		require.Len(t, content, 2)
+		require.NotContains(t, content, "dev/mysql")
+	})
+
+	t.Run("globbed secrets without a slash", func(t *testing.T) {
+		content, _, err := source.Get("secretsmanager:prod-*")
+		require.Nil(t, err)
+		require.Equal(t, map[string][]byte{"prod-redis": []byte(`{"password": "rd"}`)}, content)
+
+		content, _, err = source.Get("secretsmanager:*")
+		require.Nil(t, err)
+		require.Len(t, content, 4)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, _, err := source.Get("ssm:/prod/missing")
+		require.IsType(t, types.ErrNotFound{}, err)
+		_, _, err = source.Get("secretsmanager:prod/missing")
+		require.IsType(t, types.ErrNotFound{}, err)
+	})
+
+	t.Run("unknown service", func(t *testing.T) {
+		_, _, err := source.Get("/prod/db/password")
+		require.NotNil(t, err)
+		require.NotContains(t, err.Error(), "not found")
+	})
+}
+
+func TestWaitForChange(t *testing.T) {
+	ssmClient, source := newTestSource()
+
+	_, version, err := source.Get("ssm:/prod/db/*")
+	require.Nil(t, err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	changed := make(chan error, 1)
+	go func() {
+		changed <- source.WaitForChange("ssm:/prod/db/*", version, stop)
+	}()
+
+	// A parameter outside of the path shouldn't trigger a change
+	ssmClient.set("/prod/other", "y")
+	select {
+	case <-changed:
+		t.Fatal("WaitForChange returned for a change to a different parameter")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ssmClient.set("/prod/db/password", "n3w")
+	select {
+	case err := <-changed:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after the parameter changed")
+	}
+}
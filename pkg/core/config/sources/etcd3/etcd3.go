@@ -0,0 +1,186 @@
+// Package etcd3 contains a config source that reads values from an Etcd v3
+// cluster.
+package etcd3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/auth"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+type etcd3ConfigSource struct {
+	kv      clientv3.KV
+	watcher clientv3.Watcher
+	timeout time.Duration
+}
+
+// Config for an Etcd3 source
+type Config struct {
+	// A list of Etcd3 servers to use
+	Endpoints []string `yaml:"endpoints"`
+	// An optional username to use when connecting
+	Username string `yaml:"username"`
+	// An optional password to use when connecting
+	Password string `yaml:"password" neverLog:"true"`
+	// Whether to use TLS when connecting.  This is implied if any of the
+	// cert paths below are provided.
+	UseTLS bool `yaml:"useTLS"`
+	// Path to a CA certificate to use when verifying the server's TLS cert,
+	// in addition to the system CAs
+	CACertPath string `yaml:"caCertPath"`
+	// Path to a TLS client cert to authenticate with
+	ClientCertPath string `yaml:"clientCertPath"`
+	// Path to the key of the TLS client cert
+	ClientKeyPath string `yaml:"clientKeyPath"`
+	// Whether to skip verifying the server's TLS cert.  Not recommended.
+	SkipVerify bool `yaml:"skipVerify"`
+	// How long to wait for connections and requests to the cluster.  This
+	// can be any string value that can be parsed by
+	// https://golang.org/pkg/time/#ParseDuration.
+	Timeout time.Duration `yaml:"timeout" default:"10s"`
+}
+
+// New creates a new Etcd3 remote config source from the target config
+func (c *Config) New() (types.ConfigSource, error) {
+	clientConf := clientv3.Config{
+		Endpoints:   c.Endpoints,
+		Username:    c.Username,
+		Password:    c.Password,
+		DialTimeout: c.Timeout,
+	}
+
+	if c.UseTLS || c.CACertPath != "" || c.ClientCertPath != "" {
+		tlsConf, err := auth.TLSConfig(&tls.Config{
+			// nolint: gosec
+			InsecureSkipVerify: c.SkipVerify,
+		}, c.CACertPath, c.ClientCertPath, c.ClientKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		clientConf.TLS = tlsConf
+	}
+
+	client, err := clientv3.New(clientConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(client.KV, client.Watcher, c.Timeout), nil
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return errors.New("at least one etcd3 endpoint is required")
+	}
+	if (c.ClientCertPath == "") != (c.ClientKeyPath == "") {
+		return errors.New("clientCertPath and clientKeyPath must be provided together")
+	}
+	return nil
+}
+
+var _ types.ConfigSourceConfig = &Config{}
+
+// New creates a new etcd3 config source from the given KV and Watcher
+// clients
+func New(kv clientv3.KV, watcher clientv3.Watcher, timeout time.Duration) types.ConfigSource {
+	return &etcd3ConfigSource{
+		kv:      kv,
+		watcher: watcher,
+		timeout: timeout,
+	}
+}
+
+func (e *etcd3ConfigSource) Name() string {
+	return "etcd3"
+}
+
+func (e *etcd3ConfigSource) Get(path string) (map[string][]byte, uint64, error) {
+	_, g, isGlob, err := types.PrefixAndGlob(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var opts []clientv3.OpOption
+	key := path
+	if isGlob {
+		// Etcd3 has no concept of directories so this will also match keys
+		// that merely start with the prefix, which the glob filters out.
+		key = types.LiteralPrefix(path)
+		opts = append(opts, clientv3.WithPrefix())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.kv.Get(ctx, key, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	contentMap := make(map[string][]byte)
+	for _, kv := range resp.Kvs {
+		if g.Match(string(kv.Key)) {
+			contentMap[string(kv.Key)] = kv.Value
+		}
+	}
+
+	if len(contentMap) == 0 {
+		return nil, uint64(resp.Header.GetRevision()), types.NewNotFoundError("etcd3 key not found")
+	}
+
+	return contentMap, uint64(resp.Header.GetRevision()), nil
+}
+
+func (e *etcd3ConfigSource) WaitForChange(path string, version uint64, stop <-chan struct{}) error {
+	_, g, isGlob, err := types.PrefixAndGlob(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	opts := []clientv3.OpOption{clientv3.WithRev(int64(version) + 1)}
+	key := path
+	if isGlob {
+		key = types.LiteralPrefix(path)
+		opts = append(opts, clientv3.WithPrefix())
+	}
+
+	for resp := range e.watcher.Watch(ctx, key, opts...) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+
+		for _, ev := range resp.Events {
+			if !g.Match(string(ev.Kv.Key)) {
+				continue
+			}
+			if ev.Type == mvccpb.DELETE || ev.Kv.ModRevision > int64(version) {
+				return nil
+			}
+		}
+	}
+
+	if utils.IsSignalChanClosed(stop) {
+		return nil
+	}
+	return errors.New("etcd3 watch was closed unexpectedly")
+}
@@ -0,0 +1,156 @@
+package etcd3
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+)
+
+type fakeKV struct {
+	clientv3.KV
+	revision int64
+	data     map[string]string
+}
+
+func (f *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	isPrefix := len(op.RangeBytes()) > 0
+
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.revision}}
+	for k, v := range f.data {
+		if k == key || (isPrefix && strings.HasPrefix(k, key)) {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v), ModRevision: f.revision})
+		}
+	}
+	return resp, nil
+}
+
+type fakeWatcher struct {
+	clientv3.Watcher
+	events chan clientv3.WatchResponse
+	keys   chan string
+}
+
+func (f *fakeWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	f.keys <- key
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp := <-f.events:
+				out <- resp
+			}
+		}
+	}()
+	return out
+}
+
+func putEvent(key string, rev int64) clientv3.WatchResponse {
+	return clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), ModRevision: rev}},
+	}}
+}
+
+func TestGet(t *testing.T) {
+	source := New(&fakeKV{
+		revision: 5,
+		data: map[string]string{
+			"/agent/monitors/cpu":    "- type: cpu",
+			"/agent/monitors/memory": "- type: memory",
+			"/agent/monitorsextra":   "a",
+			"/agent/token":           "abc",
+			"prod-token":             "def",
+			"prod-url":               "https://example.com",
+		},
+	}, nil, time.Second)
+
+	content, version, err := source.Get("/agent/token")
+	require.Nil(t, err)
+	require.Equal(t, uint64(5), version)
+	require.Equal(t, map[string][]byte{"/agent/token": []byte("abc")}, content)
+
+	content, _, err = source.Get("/agent/monitors/*")
+	require.Nil(t, err)
+	require.Len(t, content, 2)
+	require.Equal(t, []byte("- type: memory"), content["/agent/monitors/memory"])
+
+	content, _, err = source.Get("prod-*")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]byte{"prod-token": []byte("def"), "prod-url": []byte("https://example.com")}, content)
+
+	content, _, err = source.Get("*")
+	require.Nil(t, err)
+	require.Len(t, content, 6)
+
+	_, _, err = source.Get("/agent/missing")
+	require.IsType(t, types.ErrNotFound{}, err)
+}
+
+func TestWaitForChange(t *testing.T) {
+	watcher := &fakeWatcher{
+		events: make(chan clientv3.WatchResponse),
+		keys:   make(chan string, 1),
+	}
+	source := New(nil, watcher, time.Second)
+
+	stop := make(chan struct{})
+	changed := make(chan error, 1)
+	go func() {
+		changed <- source.WaitForChange("/agent/monitors/*", 5, stop)
+	}()
+
+	require.Equal(t, "/agent/monitors/", <-watcher.keys)
+
+	// Non-matching keys don't count as a change
+	watcher.events <- putEvent("/agent/monitorsextra", 6)
+	select {
+	case <-changed:
+		t.Fatal("WaitForChange returned for a non-matching key")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	watcher.events <- putEvent("/agent/monitors/cpu", 7)
+	select {
+	case err := <-changed:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after the key changed")
+	}
+
+	go func() {
+		changed <- source.WaitForChange("prod-*", 7, stop)
+	}()
+	require.Equal(t, "prod-", <-watcher.keys)
+
+	watcher.events <- putEvent("prod-token", 8)
+	select {
+	case err := <-changed:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after the key changed")
+	}
+
+	go func() {
+		changed <- source.WaitForChange("/agent/token", 8, stop)
+	}()
+	require.Equal(t, "/agent/token", <-watcher.keys)
+	close(stop)
+
+	select {
+	case err := <-changed:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after stop was closed")
+	}
+}
@@ -0,0 +1,277 @@
+// Package k8s contains a config source that reads values from Kubernetes
+// ConfigMaps and Secrets.
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gobwas/glob"
+	"github.com/mitchellh/hashstructure"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8s "k8s.io/client-go/kubernetes"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/kubernetes"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+)
+
+const (
+	kindConfigMap = "configmap"
+	kindSecret    = "secret"
+)
+
+// Config for the Kubernetes config source.  Paths have the form
+// `[configmap/|secret/]<namespace>/<name>/<key>`, where the kind defaults to
+// `configmap` if not given.  The key can contain globs to match multiple keys
+// in the same ConfigMap or Secret.  The agent's service account must be
+// allowed to `get` and `watch` the referenced ConfigMaps and Secrets.
+type Config struct {
+	kubernetes.APIConfig `yaml:",inline" default:"{}"`
+}
+
+// New creates a new Kubernetes config source from the target config
+func (c *Config) New() (types.ConfigSource, error) {
+	client, err := kubernetes.MakeClient(&c.APIConfig)
+	if err != nil {
+		return nil, err
+	}
+	return New(client), nil
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	return c.APIConfig.Validate()
+}
+
+var _ types.ConfigSourceConfig = &Config{}
+
+type k8sConfigSource struct {
+	client k8s.Interface
+
+	// The hash of the content last returned by Get for each path, used to
+	// avoid reporting changes to other keys of the same object.
+	lock          sync.Mutex
+	contentHashes map[string]uint64
+}
+
+// New creates a new Kubernetes ConfigSource that uses the given client
+func New(client k8s.Interface) types.ConfigSource {
+	return &k8sConfigSource{
+		client:        client,
+		contentHashes: make(map[string]uint64),
+	}
+}
+
+func (s *k8sConfigSource) Name() string {
+	return "k8s"
+}
+
+type objectRef struct {
+	kind      string
+	namespace string
+	name      string
+	// The path without the key, which is prefixed to matched keys
+	prefix  string
+	keyGlob glob.Glob
+}
+
+func parsePath(path string) (*objectRef, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	kind := kindConfigMap
+	switch {
+	case len(parts) == 4 && (parts[0] == kindConfigMap || parts[0] == kindSecret):
+		kind = parts[0]
+		parts = parts[1:]
+	case len(parts) != 3:
+		return nil, fmt.Errorf("k8s path %s must be of the form [configmap/|secret/]<namespace>/<name>/<key>", path)
+	}
+
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("k8s path %s has an empty part", path)
+		}
+	}
+
+	g, err := glob.Compile(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectRef{
+		kind:      kind,
+		namespace: parts[0],
+		name:      parts[1],
+		prefix:    strings.TrimSuffix(strings.Trim(path, "/"), parts[2]),
+		keyGlob:   g,
+	}, nil
+}
+
+// matchContent pulls the keys matching the path out of a ConfigMap or Secret
+func (r *objectRef) matchContent(obj runtime.Object) map[string][]byte {
+	contentMap := make(map[string][]byte)
+	switch o := obj.(type) {
+	case *v1.ConfigMap:
+		for k, v := range o.Data {
+			if r.keyGlob.Match(k) {
+				contentMap[r.prefix+k] = []byte(v)
+			}
+		}
+		for k, v := range o.BinaryData {
+			if r.keyGlob.Match(k) {
+				contentMap[r.prefix+k] = v
+			}
+		}
+	case *v1.Secret:
+		for k, v := range o.Data {
+			if r.keyGlob.Match(k) {
+				contentMap[r.prefix+k] = v
+			}
+		}
+	}
+	return contentMap
+}
+
+func (s *k8sConfigSource) getObject(ref *objectRef) (runtime.Object, string, error) {
+	if ref.kind == kindSecret {
+		secret, err := s.client.CoreV1().Secrets(ref.namespace).Get(context.Background(), ref.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", err
+		}
+		return secret, secret.ResourceVersion, nil
+	}
+
+	cm, err := s.client.CoreV1().ConfigMaps(ref.namespace).Get(context.Background(), ref.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	return cm, cm.ResourceVersion, nil
+}
+
+func contentHash(contentMap map[string][]byte) uint64 {
+	hash, _ := hashstructure.Hash(contentMap, nil)
+	return hash
+}
+
+func (s *k8sConfigSource) Get(path string) (map[string][]byte, uint64, error) {
+	ref, err := parsePath(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	obj, resourceVersion, err := s.getObject(ref)
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, 0, types.NewNotFoundError(fmt.Sprintf("k8s %s %s/%s not found", ref.kind, ref.namespace, ref.name))
+		}
+		return nil, 0, err
+	}
+
+	contentMap := ref.matchContent(obj)
+	if len(contentMap) == 0 {
+		return nil, 0, types.NewNotFoundError(fmt.Sprintf("no keys in k8s %s %s/%s matched path %s", ref.kind, ref.namespace, ref.name, path))
+	}
+
+	s.lock.Lock()
+	s.contentHashes[path] = contentHash(contentMap)
+	s.lock.Unlock()
+
+	// Resource versions are opaque strings but are integers in practice
+	// since they come from etcd revisions.
+	version, _ := strconv.ParseUint(resourceVersion, 10, 64)
+	return contentMap, version, nil
+}
+
+func (s *k8sConfigSource) watch(ctx context.Context, ref *objectRef, version uint64) (watch.Interface, error) {
+	opts := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", ref.name).String(),
+	}
+	if version > 0 {
+		opts.ResourceVersion = strconv.FormatUint(version, 10)
+	}
+
+	if ref.kind == kindSecret {
+		return s.client.CoreV1().Secrets(ref.namespace).Watch(ctx, opts)
+	}
+	return s.client.CoreV1().ConfigMaps(ref.namespace).Watch(ctx, opts)
+}
+
+func (s *k8sConfigSource) WaitForChange(path string, version uint64, stop <-chan struct{}) error {
+	ref, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	lastHash, haveHash := s.contentHashes[path]
+	s.lock.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		watcher, err := s.watch(ctx, ref, version)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		changed, err := s.processEvents(ctx, watcher, ref, lastHash, haveHash)
+		watcher.Stop()
+		if changed || err != nil || ctx.Err() != nil {
+			return err
+		}
+		// The API server closes watches periodically, so just start a new
+		// one from the same version.
+	}
+}
+
+// processEvents reads events from the watcher until the content of the path
+// changes or the watch ends.
+func (s *k8sConfigSource) processEvents(ctx context.Context, watcher watch.Interface, ref *objectRef, lastHash uint64, haveHash bool) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case ev, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+
+			if ev.Type == watch.Error {
+				return false, k8serrors.FromObject(ev.Object)
+			}
+			if accessor, err := meta.Accessor(ev.Object); err != nil || accessor.GetName() != ref.name {
+				continue
+			}
+
+			switch ev.Type {
+			case watch.Deleted:
+				return true, nil
+			case watch.Added, watch.Modified:
+				if !haveHash || contentHash(ref.matchContent(ev.Object)) != lastHash {
+					return true, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
+)
+
+func TestGet(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "monitoring", ResourceVersion: "12"},
+			Data:       map[string]string{"monitors.yaml": "- type: cpu", "extra.yaml": "a: b", "other": "c"},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent-token", Namespace: "monitoring"},
+			Data:       map[string][]byte{"token": []byte("s3cr3t")},
+		},
+	)
+	source := New(client)
+
+	t.Run("configmap key", func(t *testing.T) {
+		content, version, err := source.Get("monitoring/agent/monitors.yaml")
+		require.Nil(t, err)
+		require.Equal(t, uint64(12), version)
+		require.Equal(t, map[string][]byte{"monitoring/agent/monitors.yaml": []byte("- type: cpu")}, content)
+	})
+
+	t.Run("explicit configmap kind with glob", func(t *testing.T) {
+		content, _, err := source.Get("configmap/monitoring/agent/*.yaml")
+		require.Nil(t, err)
+		require.Len(t, content, 2)
+		require.Equal(t, []byte("a: b"), content["configmap/monitoring/agent/extra.yaml"])
+	})
+
+	t.Run("secret key", func(t *testing.T) {
+		content, _, err := source.Get("secret/monitoring/agent-token/token")
+		require.Nil(t, err)
+		require.Equal(t, map[string][]byte{"secret/monitoring/agent-token/token": []byte("s3cr3t")}, content)
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		_, _, err := source.Get("monitoring/missing/token")
+		require.IsType(t, types.ErrNotFound{}, err)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, _, err := source.Get("secret/monitoring/agent-token/password")
+		require.IsType(t, types.ErrNotFound{}, err)
+	})
+
+	t.Run("bad path", func(t *testing.T) {
+		_, _, err := source.Get("monitoring/agent")
+		require.NotNil(t, err)
+		_, _, err = source.Get("service/monitoring/agent/key")
+		require.NotNil(t, err)
+	})
+}
+
+func TestWaitForChange(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "monitoring"},
+		Data:       map[string]string{"token": "a", "other": "b"},
+	}
+	client := fake.NewSimpleClientset(cm)
+	source := New(client)
+
+	path := "monitoring/agent/token"
+	_, version, err := source.Get(path)
+	require.Nil(t, err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	changed := make(chan error, 1)
+	go func() {
+		changed <- source.WaitForChange(path, version, stop)
+	}()
+
+	update := func(data map[string]string) {
+		// Give the watch time to be established since the fake client
+		// doesn't replay events from before the watch was started
+		time.Sleep(200 * time.Millisecond)
+		cm = cm.DeepCopy()
+		cm.Data = data
+		_, err := client.CoreV1().ConfigMaps("monitoring").Update(context.Background(), cm, metav1.UpdateOptions{})
+		require.Nil(t, err)
+	}
+
+	// Changing another key shouldn't trigger a change
+	update(map[string]string{"token": "a", "other": "c"})
+	select {
+	case <-changed:
+		t.Fatal("WaitForChange returned for a change to a different key")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	update(map[string]string{"token": "z", "other": "c"})
+	select {
+	case err := <-changed:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after the key changed")
+	}
+}
+
+func TestWaitForChangeStops(t *testing.T) {
+	source := New(fake.NewSimpleClientset())
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- source.WaitForChange("monitoring/agent/token", 0, stop)
+	}()
+
+	close(stop)
+	select {
+	case err := <-done:
+		require.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForChange did not return after stop was closed")
+	}
+}
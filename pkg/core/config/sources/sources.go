@@ -12,10 +12,13 @@ import (
 	"github.com/mitchellh/hashstructure"
 	"github.com/pkg/errors"
 	"github.com/signalfx/defaults"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/awssecrets"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/consul"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/env"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/etcd2"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/etcd3"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/file"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/k8s"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/vault"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/sources/zookeeper"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/types"
@@ -53,10 +56,17 @@ type SourceConfig struct {
 	Zookeeper *zookeeper.Config `yaml:"zookeeper"`
 	// Configuration for an Etcd 2 remote config source
 	Etcd2 *etcd2.Config `yaml:"etcd2"`
+	// Configuration for an Etcd 3 remote config source
+	Etcd3 *etcd3.Config `yaml:"etcd3"`
 	// Configuration for a Consul remote config source
 	Consul *consul.Config `yaml:"consul"`
 	// Configuration for a Hashicorp Vault remote config source
 	Vault *vault.Config `yaml:"vault"`
+	// Configuration for a Kubernetes ConfigMap/Secret remote config source
+	Kubernetes *k8s.Config `yaml:"kubernetes"`
+	// Configuration for an AWS SSM Parameter Store/Secrets Manager remote
+	// config source
+	AWS *awssecrets.Config `yaml:"aws"`
 }
 
 // Hash calculates a unique hash value for this config struct
@@ -82,8 +92,11 @@ func (sc *SourceConfig) SourceInstances() (map[string]types.ConfigSource, error)
 	for _, csc := range []types.ConfigSourceConfig{
 		sc.Zookeeper,
 		sc.Etcd2,
+		sc.Etcd3,
 		sc.Consul,
 		sc.Vault,
+		sc.Kubernetes,
+		sc.AWS,
 	} {
 		if !reflect.ValueOf(csc).IsNil() {
 			err := defaults.Set(csc)
@@ -99,3 +99,82 @@ func ToString(conf interface{}) string {
 	}
 	return out
 }
+
+// ToMap converts a config struct to generic maps and slices that can be
+// serialized as JSON or YAML.  Fields with the 'neverLog' tag are redacted or
+// omitted in the same way as ToString.
+func ToMap(conf interface{}) interface{} {
+	if conf == nil {
+		return nil
+	}
+
+	confValue := reflect.Indirect(reflect.ValueOf(conf))
+	if !confValue.IsValid() {
+		return nil
+	}
+
+	if confValue.Type().Kind() == reflect.Slice {
+		out := make([]interface{}, confValue.Len())
+		for j := 0; j < confValue.Len(); j++ {
+			out[j] = ToMap(confValue.Index(j).Interface())
+		}
+		return out
+	}
+
+	if !utils.IsStructOrPointerToStruct(confValue.Type()) {
+		// Round trip through YAML so that custom marshalers are respected
+		yamlBytes, err := yaml.Marshal(conf)
+		if err != nil {
+			log.WithError(err).Error("Could not marshal yaml for diagnostic conversion")
+			return nil
+		}
+		var out interface{}
+		if err := yaml.Unmarshal(yamlBytes, &out); err != nil {
+			log.WithError(err).Error("Could not unmarshal yaml for diagnostic conversion")
+			return nil
+		}
+		return utils.ConvertYAMLValueForJSON(out)
+	}
+
+	out := map[string]interface{}{}
+	confStruct := confValue.Type()
+
+	for i := 0; i < confStruct.NumField(); i++ {
+		field := confStruct.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldName := utils.YAMLNameOfField(field)
+		if fieldName == "" && !field.Anonymous {
+			continue
+		}
+
+		var val interface{}
+		if neverLogVal, neverLogPresent := field.Tag.Lookup("neverLog"); neverLogPresent {
+			if neverLogVal == "omit" {
+				continue
+			}
+			if v, ok := confValue.Field(i).Interface().(string); ok && v == "" {
+				val = ""
+			} else {
+				val = "***************"
+			}
+		} else {
+			val = ToMap(confValue.Field(i).Interface())
+		}
+
+		// Flatten embedded struct's representation
+		if field.Anonymous {
+			if embedded, ok := val.(map[string]interface{}); ok {
+				for k, v := range embedded {
+					out[k] = v
+				}
+			}
+			continue
+		}
+
+		out[fieldName] = val
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToMap(t *testing.T) {
+	type inner struct {
+		Port int `yaml:"port"`
+	}
+	type conf struct {
+		Host     string            `yaml:"host"`
+		Password string            `yaml:"password" neverLog:"true"`
+		Token    string            `yaml:"token" neverLog:"omit"`
+		Extra    map[string]string `yaml:"extra"`
+		Inner    []inner           `yaml:"inner"`
+	}
+
+	out := ToMap(&conf{
+		Host:     "localhost",
+		Password: "s3cr3t",
+		Token:    "abc",
+		Extra:    map[string]string{"a": "b"},
+		Inner:    []inner{{Port: 80}},
+	})
+
+	asMap, ok := out.(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, "localhost", asMap["host"])
+	require.NotEqual(t, "s3cr3t", asMap["password"])
+	require.NotContains(t, asMap, "token")
+	require.Equal(t, map[string]interface{}{"a": "b"}, asMap["extra"])
+	require.Equal(t, []interface{}{map[string]interface{}{"port": 80}}, asMap["inner"])
+
+	_, err := json.Marshal(out)
+	require.Nil(t, err)
+}
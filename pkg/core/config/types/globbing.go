@@ -29,3 +29,18 @@ func PrefixAndGlob(path string) (string, glob.Glob, bool, error) {
 	g, err := glob.Compile(path)
 	return prefix, g, quoted != path, err
 }
+
+// LiteralPrefix returns the part of a potentially globbed path before the
+// first globbing character.  Unlike the prefix from PrefixAndGlob it is not
+// cut back to a slash, so it is what should be used to filter stores that
+// match on arbitrary key prefixes.  E.g. if the path is "prod-*", it would
+// return "prod-".
+func LiteralPrefix(path string) string {
+	quoted := glob.QuoteMeta(path)
+	for i := 0; i < len(path); i++ {
+		if quoted[i] != path[i] {
+			return path[:i]
+		}
+	}
+	return path
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
 	"github.com/signalfx/signalfx-agent/pkg/core/propfilters"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
 	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
 	log "github.com/sirupsen/logrus"
 )
@@ -30,7 +31,8 @@ type WriterConfig struct {
 	MaxDatapointsBuffered int `yaml:"maxDatapointsBuffered" default:"25000"`
 	// The analogue of `datapointMaxBatchSize` for trace spans.
 	TraceSpanMaxBatchSize int `yaml:"traceSpanMaxBatchSize" default:"1000"`
-	// Format to export traces in. Choices are "zipkin" and "sapm"
+	// Format to export traces in. Choices are "zipkin" and "sapm".  To send
+	// traces with OTLP, configure an `otlp` output in `outputs` instead.
 	TraceExportFormat string `yaml:"traceExportFormat" default:"zipkin"`
 	// Deprecated: use `maxRequests` instead.
 	DatapointMaxRequests int `yaml:"datapointMaxRequests"`
@@ -123,10 +125,35 @@ type WriterConfig struct {
 	// handle the volume of trace spans and should be upgraded to more powerful
 	// hardware/networking.
 	MaxTraceSpansInFlight uint `yaml:"maxTraceSpansInFlight" default:"100000"`
+	// Configures the writer to persist datapoints and trace spans to disk when
+	// they cannot be sent to SignalFx so that they are not lost during ingest
+	// outages or agent restarts.
+	DiskBuffer DiskBufferConfig `yaml:"diskBuffer" default:"{}"`
 	// Configures the writer specifically writing to Splunk.
 	Splunk *SplunkConfig `yaml:"splunk"`
 	// If set to `false`, output to SignalFx will be disabled.
 	SignalFxEnabled *bool `yaml:"signalFxEnabled" default:"true"`
+	// A list of outputs that the writer should send data to simultaneously.
+	// Each output receives its own copy of all datapoints, events and trace
+	// spans.  If this is set, the `signalFxEnabled` and `splunk` options are
+	// ignored and only the outputs listed here are used.  If not set, the
+	// outputs are determined by the `signalFxEnabled` and `splunk` options.
+	Outputs []OutputConfig `yaml:"outputs" default:"[]"`
+	// Rules for rolling up datapoints into fewer time series before they are
+	// sent to any output, e.g. to sum a container metric per pod.  Datapoints
+	// matched by a rule are only sent in aggregated form.  The first rule
+	// that matches a datapoint is used.
+	DatapointAggregations []AggregationConfig `yaml:"datapointAggregations" default:"[]"`
+	// The maximum number of distinct time series (unique combinations of
+	// metric name and dimensions) that a single monitor instance can send.
+	// Datapoints for new time series beyond this are dropped, and an event
+	// and internal metrics are emitted naming the monitor.  Time series that
+	// have not been seen for `timeSeriesExpiry` no longer count towards the
+	// limit.  If 0, there is no limit.
+	MaxTimeSeriesPerMonitor int `yaml:"maxTimeSeriesPerMonitor"`
+	// How long a time series has to go without any datapoints before it no
+	// longer counts towards `maxTimeSeriesPerMonitor`.
+	TimeSeriesExpiry timeutil.Duration `yaml:"timeSeriesExpiry" default:"1h"`
 	// Additional headers to add to any outgoing HTTP requests from the agent.
 	ExtraHeaders map[string]string `yaml:"extraHeaders"`
 	// The following are propagated from elsewhere
@@ -141,6 +168,8 @@ type WriterConfig struct {
 	MetricsToInclude    []MetricFilter         `yaml:"-"`
 	MetricsToExclude    []MetricFilter         `yaml:"-"`
 	PropertiesToExclude []PropertyFilterConfig `yaml:"-"`
+	// The output that this config was made for by ForOutput, if any
+	Output *OutputConfig `yaml:"-"`
 }
 
 func (wc *WriterConfig) initialize() {
@@ -163,6 +192,58 @@ func (wc *WriterConfig) initialize() {
 	}
 }
 
+// OutputConfigs returns the configs of all of the outputs that the writer
+// should use, taking into account the legacy `signalFxEnabled` and `splunk`
+// options if `outputs` is not set.
+func (wc *WriterConfig) OutputConfigs() []OutputConfig {
+	if len(wc.Outputs) > 0 {
+		return wc.Outputs
+	}
+
+	var outputs []OutputConfig
+	if wc.IsSignalFxOutputEnabled() {
+		outputs = append(outputs, OutputConfig{
+			Type:        "signalfx",
+			OtherConfig: map[string]interface{}{},
+		})
+	}
+	if wc.IsSplunkOutputEnabled() {
+		// Pass the Splunk config through as generic config so that it can be
+		// decoded like it would be in the `outputs` list.
+		splunkConf, err := utils.ConvertToMapViaYAML(wc.Splunk)
+		if err != nil {
+			log.WithError(err).Error("Could not convert Splunk writer config")
+			splunkConf = map[string]interface{}{}
+		}
+		delete(splunkConf, "enabled")
+
+		outputs = append(outputs, OutputConfig{
+			Type:        "splunk",
+			OtherConfig: splunkConf,
+		})
+	}
+	return outputs
+}
+
+// ForOutput returns a copy of the writer config with the batching and
+// concurrency options overridden by the given output config, where set.
+func (wc *WriterConfig) ForOutput(oc *OutputConfig) *WriterConfig {
+	out := *wc
+	if oc.MaxBatchSize > 0 {
+		out.DatapointMaxBatchSize = oc.MaxBatchSize
+		out.TraceSpanMaxBatchSize = oc.MaxBatchSize
+	}
+	if oc.MaxRequests > 0 {
+		out.MaxRequests = oc.MaxRequests
+		out.DatapointMaxRequests = oc.MaxRequests
+	}
+	if oc.MaxBuffered > 0 {
+		out.MaxDatapointsBuffered = oc.MaxBuffered
+	}
+	out.Output = oc
+	return &out
+}
+
 func (wc *WriterConfig) IsSplunkOutputEnabled() bool {
 	return wc.Splunk != nil && wc.Splunk.Enabled
 }
@@ -171,11 +252,44 @@ func (wc *WriterConfig) IsSignalFxOutputEnabled() bool {
 	return wc.SignalFxEnabled == nil || *wc.SignalFxEnabled
 }
 
+// ValidateTraceExportFormat returns an error if the given format is not one
+// that the SignalFx output can send trace spans in.
+func ValidateTraceExportFormat(format string) error {
+	switch strings.ToLower(format) {
+	case TraceExportFormatZipkin, TraceExportFormatSAPM:
+		return nil
+	case "otlp":
+		return errors.New("traceExportFormat does not support otlp, add an output with `type: otlp` to `writer.outputs` to send trace spans with OTLP")
+	default:
+		return fmt.Errorf("traceExportFormat '%s' is not supported, it must be either zipkin or sapm", format)
+	}
+}
+
 func (wc *WriterConfig) Validate() error {
-	if !wc.IsSplunkOutputEnabled() && !wc.IsSignalFxOutputEnabled() {
+	if len(wc.Outputs) == 0 && !wc.IsSplunkOutputEnabled() && !wc.IsSignalFxOutputEnabled() {
 		return errors.New("both SignalFx and Splunk output are disabled, at least one must be enabled")
 	}
 
+	seenOutputs := map[string]bool{}
+	for i := range wc.Outputs {
+		if wc.Outputs[i].Type == "" {
+			return errors.New("writer outputs must have a `type`")
+		}
+		name := wc.Outputs[i].OutputName()
+		if seenOutputs[name] {
+			return fmt.Errorf("writer output name '%s' is used more than once, set a unique `name` on each output", name)
+		}
+		seenOutputs[name] = true
+
+		if _, err := wc.Outputs[i].DatapointFilters(); err != nil {
+			return fmt.Errorf("datapoint filters of writer output '%s' are invalid: %v", name, err)
+		}
+	}
+
+	if err := ValidateTraceExportFormat(wc.TraceExportFormat); err != nil {
+		return err
+	}
+
 	if !httpguts.ValidHeaderFieldValue(wc.SignalFxAccessToken) {
 		return errors.New("the SignalFx Access Token does not pass http header validation and is likely malformed")
 	}
@@ -184,6 +298,12 @@ func (wc *WriterConfig) Validate() error {
 		return fmt.Errorf("datapoint filters are invalid: %v", err)
 	}
 
+	for i := range wc.DatapointAggregations {
+		if err := wc.DatapointAggregations[i].Validate(); err != nil {
+			return fmt.Errorf("datapoint aggregation #%d is invalid: %v", i+1, err)
+		}
+	}
+
 	return nil
 }
 
@@ -257,6 +377,73 @@ func (wc *WriterConfig) DefaultTraceEndpointPath() string {
 	return "/v1/trace"
 }
 
+// OutputConfig is the generic config for a single writer output.  Any other
+// options are specific to the output type.
+type OutputConfig struct {
+	// The type of the output.  The built-in types are `signalfx`, `splunk`,
+	// `prometheus-remote-write` and `otlp`.
+	Type string `yaml:"type"`
+	// A unique name for this output that is used in logs and internal
+	// metrics.  Defaults to the output type, so it must be set if there are
+	// multiple outputs of the same type.
+	Name string `yaml:"name"`
+	// The maximum number of datapoints, events or trace spans to send in a
+	// single request.  Defaults to the writer's `datapointMaxBatchSize`.
+	MaxBatchSize int `yaml:"maxBatchSize"`
+	// The maximum number of concurrent requests made by this output.
+	// Defaults to the writer's `maxRequests`.
+	MaxRequests int `yaml:"maxRequests"`
+	// The maximum number of datapoints to buffer in this output before the
+	// oldest are overwritten.  Defaults to the writer's
+	// `maxDatapointsBuffered`.
+	MaxBuffered int `yaml:"maxBuffered"`
+	// How many batches of datapoints or trace spans, or individual events,
+	// can be waiting to be picked up by this output before they are dropped
+	// for this output only.  This keeps a slow output from holding up the
+	// others.
+	QueueSize int `yaml:"queueSize"`
+	// Filters for datapoints that should not be sent by this output, in the
+	// same format as the top-level `metricsToExclude`.  These are applied in
+	// addition to the top-level filters, so a datapoint that is excluded
+	// globally can't be re-included here.  Use `negated: true` to only send a
+	// specific subset of metrics through this output.
+	MetricsToExclude []MetricFilter `yaml:"metricsToExclude"`
+	// Filters that override `metricsToExclude` for this output, in the same
+	// format as the top-level `metricsToInclude`.
+	MetricsToInclude []MetricFilter `yaml:"metricsToInclude"`
+	// Dimensions to add to all datapoints sent by this output.  These
+	// override any existing dimensions of the same name.
+	ExtraDimensions map[string]string `yaml:"extraDimensions"`
+	// A mapping of dimension names to new names for datapoints sent by this
+	// output.  If the new name is an empty string the dimension is removed.
+	// This is applied after `extraDimensions` and the global and host
+	// dimensions are added, and filtering is done on the original dimension
+	// names.  All of the renames apply to the original dimensions, so e.g.
+	// `a: b` and `b: a` swap the two dimensions.  If several dimensions are
+	// renamed to the same name, the one whose original name sorts last wins.
+	DimensionTransformations map[string]string `yaml:"dimensionTransformations"`
+	// Any other config specific to the output type
+	OtherConfig map[string]interface{} `yaml:",inline" default:"{}"`
+}
+
+var _ CustomConfigurable = &OutputConfig{}
+
+// ExtraConfig returns generic config as a map
+func (oc *OutputConfig) ExtraConfig() (map[string]interface{}, error) {
+	return oc.OtherConfig, nil
+}
+
+// OutputName returns the name of the output, which defaults to its type.
+func (oc *OutputConfig) OutputName() string {
+	return utils.FirstNonEmpty(oc.Name, oc.Type)
+}
+
+// DatapointFilters creates the filter set for datapoints that are specific to
+// this output.
+func (oc *OutputConfig) DatapointFilters() (*dpfilters.FilterSet, error) {
+	return makeOldFilterSet(oc.MetricsToExclude, oc.MetricsToInclude)
+}
+
 // SplunkConfig configures the writer specifically writing to Splunk.
 type SplunkConfig struct {
 	// Enable logging to a Splunk Enterprise instance
@@ -291,3 +478,31 @@ type SplunkConfig struct {
 	// HEC
 	MaxBatchSize int `yaml:"maxBatchSize"`
 }
+
+// DiskBufferConfig configures the on-disk buffer of the SignalFx output.
+// Datapoints and trace spans that fail to send are written to the buffer and
+// are replayed, oldest first, once ingest is reachable again.  While the
+// buffer is replaying, newly generated data is also written to the buffer so
+// that it is sent in order and does not overwrite data held in memory.
+type DiskBufferConfig struct {
+	// The directory in which to store buffered data.  Datapoints and trace
+	// spans are stored in separate subdirectories.  The disk buffer is
+	// disabled if this is not set.
+	Directory string `yaml:"directory"`
+	// The maximum size in megabytes of the buffered data of each type
+	// (datapoints and trace spans).  The oldest data will be dropped when this
+	// is exceeded.
+	MaxSizeMB int `yaml:"maxSizeMB" default:"512"`
+	// Buffered data older than this will be dropped without being sent.  This
+	// should be a duration string that is accepted by
+	// https://golang.org/pkg/time/#ParseDuration.
+	MaxAge timeutil.Duration `yaml:"maxAge" default:"1h"`
+	// How frequently to try and resend buffered data while ingest is
+	// unreachable.
+	RetryInterval timeutil.Duration `yaml:"retryInterval" default:"5s"`
+}
+
+// Enabled returns whether the disk buffer should be used.
+func (dbc *DiskBufferConfig) Enabled() bool {
+	return dbc.Directory != ""
+}
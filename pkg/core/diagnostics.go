@@ -20,6 +20,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/signalfx/signalfx-agent/pkg/core/promexport"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/tap"
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
@@ -38,7 +39,12 @@ func (a *Agent) serveDiagnosticInfo(host string, port uint16) {
 	mux := http.NewServeMux()
 	mux.Handle("/", http.HandlerFunc(a.diagnosticTextHandler))
 	mux.Handle("/metrics", http.HandlerFunc(a.internalMetricsHandler))
+	mux.Handle("/metrics/prometheus", http.HandlerFunc(a.prometheusMetricsHandler))
 	mux.Handle("/tap-dps", http.HandlerFunc(a.datapointTapHandler))
+	mux.Handle("/tap-events", http.HandlerFunc(a.eventTapHandler))
+	mux.Handle("/tap-spans", http.HandlerFunc(a.spanTapHandler))
+	mux.Handle("/tap-dims", http.HandlerFunc(a.dimensionTapHandler))
+	mux.Handle("/discovery-rule", http.HandlerFunc(a.discoveryRuleHandler))
 
 	a.diagnosticServer = &http.Server{
 		Addr:        fmt.Sprintf("%s:%d", host, port),
@@ -69,14 +75,21 @@ func (a *Agent) serveDiagnosticInfo(host string, port uint16) {
 	}()
 }
 
-func readStatusInfo(host string, port uint16, section string) ([]byte, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s:%d/?section=%s", host, port, section))
+func readStatusInfo(host string, port uint16, section string, format string) ([]byte, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s:%d/?section=%s&format=%s", host, port, url.QueryEscape(section), url.QueryEscape(format)))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("status request failed (%d): %s", resp.StatusCode, string(body))
+	}
+	return body, nil
 }
 
 func (a *Agent) internalMetricsHandler(rw http.ResponseWriter, req *http.Request) {
@@ -94,6 +107,12 @@ func (a *Agent) internalMetricsHandler(rw http.ResponseWriter, req *http.Request
 	_, _ = rw.Write(jsonOut)
 }
 
+// Serves the same metrics as internalMetricsHandler but in the Prometheus text
+// or OpenMetrics exposition format, depending on the Accept header.
+func (a *Agent) prometheusMetricsHandler(rw http.ResponseWriter, req *http.Request) {
+	promexport.ServeHTTP(rw, req, a.InternalMetrics())
+}
+
 // InternalMetrics aggregates internal metrics from subcomponents and returns a
 // list of datapoints that represent the instaneous state of the agent
 func (a *Agent) InternalMetrics() []*datapoint.Datapoint {
@@ -154,7 +173,15 @@ func (a *Agent) ensureProfileServerRunning(host string, port int) {
 	}
 }
 
-func (a *Agent) datapointTapHandler(rw http.ResponseWriter, req *http.Request) {
+// tapFilterFromRequest makes a filter from the `metric` and `dims` query
+// params of a tap request, as well as the output format from the `format`
+// param.
+func tapFilterFromRequest(req *http.Request) (dpfilters.DatapointFilter, tap.Format, error) {
+	format, err := tap.ParseFormat(req.URL.Query().Get("format"))
+	if err != nil {
+		return nil, "", err
+	}
+
 	metricQuery := utils.DecodeValueGenerically(req.URL.Query().Get("metric"))
 	dimQuery := utils.DecodeValueGenerically(req.URL.Query().Get("dims"))
 
@@ -166,9 +193,7 @@ func (a *Agent) datapointTapHandler(rw http.ResponseWriter, req *http.Request) {
 		case []string:
 			metricFilter = v
 		default:
-			rw.WriteHeader(400)
-			_, _ = rw.Write([]byte("bad metric query: " + spew.Sdump(v)))
-			return
+			return nil, "", fmt.Errorf("bad metric query: %s", spew.Sdump(v))
 		}
 	}
 
@@ -189,27 +214,31 @@ func (a *Agent) datapointTapHandler(rw http.ResponseWriter, req *http.Request) {
 				dimFilter[fmt.Sprintf("%v", v[i].Key)] = vals
 			}
 		default:
-			rw.WriteHeader(400)
-			_, _ = rw.Write([]byte("bad dims query: " + spew.Sdump(v)))
-			return
+			return nil, "", fmt.Errorf("bad dims query: %s", spew.Sdump(v))
 		}
 	}
 
-	var filter dpfilters.DatapointFilter
 	if metricFilter == nil && dimFilter == nil {
-		filter = &dpfilters.AlwaysMatchFilter{}
-	} else {
-		var err error
-		filter, err = dpfilters.NewOverridable(metricFilter, dimFilter)
-		if err != nil {
-			rw.WriteHeader(400)
-			_, _ = rw.Write([]byte("could not make filter: " + err.Error()))
-			return
-		}
+		return &dpfilters.AlwaysMatchFilter{}, format, nil
+	}
+
+	filter, err := dpfilters.NewOverridable(metricFilter, dimFilter)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not make filter: %v", err)
+	}
+	return filter, format, nil
+}
+
+func (a *Agent) datapointTapHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, format, err := tapFilterFromRequest(req)
+	if err != nil {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
 	}
 
 	rw.WriteHeader(200)
-	dpTap := tap.New(filter, rw)
+	dpTap := tap.New(filter, rw, format)
 
 	log.Infof("Datapoint tap started")
 	a.writer.SetTap(dpTap)
@@ -220,17 +249,84 @@ func (a *Agent) datapointTapHandler(rw http.ResponseWriter, req *http.Request) {
 	log.Infof("Datapoint tap cleared")
 }
 
-func streamDatapoints(host string, port uint16, metric string, dims string) (io.ReadCloser, error) {
+func (a *Agent) eventTapHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, format, err := tapFilterFromRequest(req)
+	if err != nil {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+
+	rw.WriteHeader(200)
+	eventTap := tap.NewEventTap(filter, rw, format)
+
+	log.Infof("Event tap started")
+	a.writer.SetEventTap(eventTap)
+
+	eventTap.Run(req.Context())
+
+	a.writer.SetEventTap(nil)
+	log.Infof("Event tap cleared")
+}
+
+func (a *Agent) spanTapHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, format, err := tapFilterFromRequest(req)
+	if err != nil {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+
+	rw.WriteHeader(200)
+	spanTap := tap.NewSpanTap(filter, rw, format)
+
+	log.Infof("Trace span tap started")
+	a.writer.SetSpanTap(spanTap)
+
+	spanTap.Run(req.Context())
+
+	a.writer.SetSpanTap(nil)
+	log.Infof("Trace span tap cleared")
+}
+
+func (a *Agent) dimensionTapHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, format, err := tapFilterFromRequest(req)
+	if err != nil {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+
+	rw.WriteHeader(200)
+	dimTap := tap.NewDimensionTap(filter, rw, format)
+
+	log.Infof("Dimension update tap started")
+	a.writer.SetDimensionTap(dimTap)
+
+	dimTap.Run(req.Context())
+
+	a.writer.SetDimensionTap(nil)
+	log.Infof("Dimension update tap cleared")
+}
+
+func streamTap(host string, port uint16, path string, metric string, dims string, format string) (io.ReadCloser, error) {
 	c := http.Client{
 		Timeout: 0,
 	}
 	qs := url.Values{}
 	qs.Set("metric", metric)
 	qs.Set("dims", dims)
-	resp, err := c.Get(fmt.Sprintf("http://%s:%d/tap-dps?%s", host, port, qs.Encode())) // nolint:bodyclose
+	qs.Set("format", format)
+	resp, err := c.Get(fmt.Sprintf("http://%s:%d%s?%s", host, port, path, qs.Encode())) // nolint:bodyclose
 	if err != nil {
 		return nil, err
 	}
 
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("tap request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
 	return resp.Body, nil
 }
@@ -1,10 +1,14 @@
 package core
 
-// Do an import of all of the built-in observers and monitors
+// Do an import of all of the built-in writer outputs, observers and monitors
 // that apply to all platforms until we get a proper plugin system
 
 import (
 	// Import everything that isn't referenced anywhere else
+	_ "github.com/signalfx/signalfx-agent/pkg/core/writer/otlp"
+	_ "github.com/signalfx/signalfx-agent/pkg/core/writer/promremotewrite"
+	_ "github.com/signalfx/signalfx-agent/pkg/core/writer/signalfx"
+	_ "github.com/signalfx/signalfx-agent/pkg/core/writer/splunk"
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/appmesh"
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/aspdotnet"
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/cadvisor"
@@ -92,6 +96,7 @@ import (
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/vsphere"
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/windowsiis"
 	_ "github.com/signalfx/signalfx-agent/pkg/monitors/windowslegacy"
+	_ "github.com/signalfx/signalfx-agent/pkg/observers/cri"
 	_ "github.com/signalfx/signalfx-agent/pkg/observers/docker"
 	_ "github.com/signalfx/signalfx-agent/pkg/observers/ecs"
 	_ "github.com/signalfx/signalfx-agent/pkg/observers/host"
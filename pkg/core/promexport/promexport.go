@@ -0,0 +1,152 @@
+// Package promexport converts the agent's internal datapoints to the
+// Prometheus data model so that they can be served in the Prometheus text or
+// OpenMetrics exposition formats.
+package promexport
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/signalfx/golib/v3/datapoint"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+var invalidNameCharRE = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+var invalidLabelCharRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// SanitizeMetricName makes a SignalFx metric name into a valid Prometheus
+// metric name by replacing all invalid characters with underscores.
+func SanitizeMetricName(name string) string {
+	out := invalidNameCharRE.ReplaceAllString(name, "_")
+	if len(out) > 0 && out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
+
+// SanitizeLabelName makes a dimension name into a valid Prometheus label name
+func SanitizeLabelName(name string) string {
+	out := invalidLabelCharRE.ReplaceAllString(name, "_")
+	if len(out) > 0 && out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
+
+func metricType(t datapoint.MetricType) dto.MetricType {
+	switch t {
+	case datapoint.Gauge, datapoint.Enum:
+		return dto.MetricType_GAUGE
+	case datapoint.Counter:
+		return dto.MetricType_COUNTER
+	default:
+		// Delta counters have no equivalent in Prometheus
+		return dto.MetricType_UNTYPED
+	}
+}
+
+func numericValue(v datapoint.Value) (float64, bool) {
+	switch val := v.(type) {
+	case datapoint.IntValue:
+		return float64(val.Int()), true
+	case datapoint.FloatValue:
+		return val.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func labelPairs(dims map[string]string) []*dto.LabelPair {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]*dto.LabelPair, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, &dto.LabelPair{
+			Name:  proto.String(SanitizeLabelName(k)),
+			Value: proto.String(dims[k]),
+		})
+	}
+	return pairs
+}
+
+// ToMetricFamilies groups the datapoints by sanitized metric name and
+// converts them to Prometheus metric families, sorted by name.  Cumulative
+// counters get the conventional `_total` suffix added if missing.  Datapoints
+// with non-numeric values are skipped, as are datapoints whose type conflicts
+// with an earlier datapoint of the same name.  Timestamps are not included
+// since the datapoints are assumed to be generated at scrape time.
+func ToMetricFamilies(dps []*datapoint.Datapoint) []*dto.MetricFamily {
+	familiesByName := map[string]*dto.MetricFamily{}
+
+	for _, dp := range dps {
+		val, ok := numericValue(dp.Value)
+		if !ok {
+			continue
+		}
+
+		name := SanitizeMetricName(dp.Metric)
+		typ := metricType(dp.MetricType)
+		if typ == dto.MetricType_COUNTER && !strings.HasSuffix(name, "_total") {
+			name += "_total"
+		}
+
+		family, ok := familiesByName[name]
+		if !ok {
+			family = &dto.MetricFamily{
+				Name: proto.String(name),
+				Type: typ.Enum(),
+			}
+			familiesByName[name] = family
+		} else if family.GetType() != typ {
+			continue
+		}
+
+		m := &dto.Metric{Label: labelPairs(dp.Dimensions)}
+		switch typ {
+		case dto.MetricType_GAUGE:
+			m.Gauge = &dto.Gauge{Value: proto.Float64(val)}
+		case dto.MetricType_COUNTER:
+			m.Counter = &dto.Counter{Value: proto.Float64(val)}
+		default:
+			m.Untyped = &dto.Untyped{Value: proto.Float64(val)}
+		}
+		family.Metric = append(family.Metric, m)
+	}
+
+	out := make([]*dto.MetricFamily, 0, len(familiesByName))
+	for _, family := range familiesByName {
+		out = append(out, family)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].GetName() < out[j].GetName()
+	})
+	return out
+}
+
+// ServeHTTP writes the datapoints to the response in the exposition format
+// negotiated from the request's Accept header.  OpenMetrics is used if the
+// client accepts it, otherwise the Prometheus text format is used.
+func ServeHTTP(rw http.ResponseWriter, req *http.Request, dps []*datapoint.Datapoint) {
+	format := expfmt.NegotiateIncludingOpenMetrics(req.Header)
+	rw.Header().Set("Content-Type", string(format))
+
+	enc := expfmt.NewEncoder(rw, format)
+	for _, family := range ToMetricFamilies(dps) {
+		if err := enc.Encode(family); err != nil {
+			log.WithError(err).WithField("metric", family.GetName()).Error("Could not encode internal metric")
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		_ = closer.Close()
+	}
+}
@@ -0,0 +1,78 @@
+package promexport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeNames(t *testing.T) {
+	require.Equal(t, "cpu_utilization", SanitizeMetricName("cpu.utilization"))
+	require.Equal(t, "_9lives", SanitizeMetricName("9lives"))
+	require.Equal(t, "a:b", SanitizeMetricName("a:b"))
+	require.Equal(t, "a_b", SanitizeLabelName("a:b"))
+}
+
+func TestToMetricFamilies(t *testing.T) {
+	families := ToMetricFamilies([]*datapoint.Datapoint{
+		sfxclient.Gauge("sfxagent.active_monitors", map[string]string{"host": "a"}, 5),
+		sfxclient.Cumulative("sfxagent.datapoints_sent", map[string]string{"output.name": "sfx"}, 10),
+		sfxclient.GaugeF("sfxagent.go_gc_cpu_fraction", nil, 0.5),
+		// Conflicting type for the same name is dropped
+		datapoint.New("sfxagent.active_monitors", nil, datapoint.NewIntValue(1), datapoint.Count, time.Now()),
+		datapoint.New("sfxagent.string", nil, datapoint.NewStringValue("a"), datapoint.Gauge, time.Now()),
+		datapoint.New("sfxagent.delta", nil, datapoint.NewIntValue(3), datapoint.Count, time.Now()),
+	})
+
+	require.Len(t, families, 4)
+
+	require.Equal(t, "sfxagent_active_monitors", families[0].GetName())
+	require.Equal(t, dto.MetricType_GAUGE, families[0].GetType())
+	require.Len(t, families[0].Metric, 1)
+	require.Equal(t, 5.0, families[0].Metric[0].GetGauge().GetValue())
+	require.Equal(t, "host", families[0].Metric[0].Label[0].GetName())
+
+	require.Equal(t, "sfxagent_datapoints_sent_total", families[1].GetName())
+	require.Equal(t, dto.MetricType_COUNTER, families[1].GetType())
+	require.Equal(t, "output_name", families[1].Metric[0].Label[0].GetName())
+
+	require.Equal(t, "sfxagent_delta", families[2].GetName())
+	require.Equal(t, dto.MetricType_UNTYPED, families[2].GetType())
+
+	require.Equal(t, "sfxagent_go_gc_cpu_fraction", families[3].GetName())
+	require.Equal(t, 0.5, families[3].Metric[0].GetGauge().GetValue())
+}
+
+func TestServeHTTP(t *testing.T) {
+	dps := []*datapoint.Datapoint{
+		sfxclient.Cumulative("sfxagent.datapoints_sent", map[string]string{"host": "a"}, 10),
+	}
+
+	t.Run("prometheus text", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/prometheus", nil), dps)
+
+		require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+		require.Contains(t, rec.Body.String(), "# TYPE sfxagent_datapoints_sent_total counter")
+		require.Contains(t, rec.Body.String(), `sfxagent_datapoints_sent_total{host="a"} 10`)
+	})
+
+	t.Run("openmetrics", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/metrics/prometheus", nil)
+		req.Header = http.Header{"Accept": []string{"application/openmetrics-text; version=0.0.1"}}
+		rec := httptest.NewRecorder()
+		ServeHTTP(rec, req, dps)
+
+		require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "application/openmetrics-text"))
+		require.Contains(t, rec.Body.String(), "# TYPE sfxagent_datapoints_sent counter")
+		require.Contains(t, rec.Body.String(), `sfxagent_datapoints_sent_total{host="a"} 10`)
+		require.True(t, strings.HasSuffix(rec.Body.String(), "# EOF\n"))
+	})
+}
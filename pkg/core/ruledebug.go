@@ -0,0 +1,108 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// Evaluates the discovery rule in the `rule` query param against all of the
+// currently discovered endpoints and writes out the results in the format
+// given by the `format` param.
+func (a *Agent) discoveryRuleHandler(rw http.ResponseWriter, req *http.Request) {
+	rule := req.URL.Query().Get("rule")
+	if strings.TrimSpace(rule) == "" {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte("the rule query param is required"))
+		return
+	}
+
+	results, err := a.monitors.DebugDiscoveryRule(rule)
+	if err != nil {
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+
+	var out []byte
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "text":
+		out = []byte(ruleEvaluationsToText(results))
+	case "json":
+		out, err = json.MarshalIndent(results, "", "  ")
+		rw.Header().Add("Content-Type", "application/json")
+	case "yaml":
+		out, err = yaml.Marshal(results)
+		rw.Header().Add("Content-Type", "application/yaml")
+	default:
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(fmt.Sprintf("unknown format %q, must be one of text, json or yaml", format)))
+		return
+	}
+	if err != nil {
+		rw.WriteHeader(500)
+		_, _ = rw.Write([]byte(err.Error()))
+		return
+	}
+	_, _ = rw.Write(out)
+}
+
+func ruleEvaluationsToText(results []*services.RuleEvaluation) string {
+	if len(results) == 0 {
+		return "No endpoints have been discovered"
+	}
+
+	var matchCount int
+	var out []string
+	for _, res := range results {
+		items := []string{"internalId: " + string(res.EndpointID)}
+		if res.Matched {
+			matchCount++
+			items[0] += " (MATCHED)"
+		}
+		if res.Result != nil {
+			items = append(items, fmt.Sprintf("result: %v", res.Result))
+		}
+		if len(res.MissingIdentifiers) > 0 {
+			items = append(items, "missing identifiers: "+strings.Join(res.MissingIdentifiers, ", "))
+		}
+		if res.Error != "" {
+			items = append(items, "error: "+res.Error)
+		}
+		items = append(items, "variables:")
+		for _, k := range utils.SortMapKeys(res.Variables) {
+			items = append(items, fmt.Sprintf("  %s: %v", k, res.Variables[k]))
+		}
+		out = append(out, " - "+strings.Join(items, "\n   "))
+	}
+
+	return fmt.Sprintf("Rule matched %d of %d endpoints:\n\n%s", matchCount, len(results), strings.Join(out, "\n\n"))
+}
+
+func readDiscoveryRuleResults(host string, port uint16, rule string, format string) ([]byte, error) {
+	qs := url.Values{}
+	qs.Set("rule", rule)
+	qs.Set("format", format)
+	resp, err := http.Get(fmt.Sprintf("http://%s:%d/discovery-rule?%s", host, port, qs.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("discovery rule request failed (%d): %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
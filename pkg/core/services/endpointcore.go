@@ -16,6 +16,7 @@ const (
 	TargetTypeHostPort       TargetType = "hostport"
 	TargetTypeContainer      TargetType = "container"
 	TargetTypeKubernetesNode TargetType = "k8s-node"
+	TargetTypeUnixSocket     TargetType = "unix-socket"
 )
 
 // PortType represents the transport protocol used to communicate with this port
@@ -50,8 +51,8 @@ type EndpointCore struct {
 	// The type of the thing that this endpoint directly refers to.  If the
 	// endpoint has a host and port associated with it (most common), the value
 	// will be `hostport`.  Other possible values are: `pod`, `container`,
-	// `host`.  See the docs for the specific observer you are using for more
-	// details on what types that observer emits.
+	// `host`, `unix-socket`.  See the docs for the specific observer you are
+	// using for more details on what types that observer emits.
 	Target TargetType `yaml:"target"`
 	// The observer that discovered this endpoint
 	DiscoveredBy  string                 `yaml:"discovered_by"`
@@ -59,6 +59,19 @@ var ruleFunctions = map[string]interface{}{
 	"Getenv":  os.Getenv,
 }
 
+// The functions available to rules that are evaluated by DebugRule.  Getenv
+// is left out since the results are served over HTTP and could otherwise be
+// used to read secrets out of the agent's environment.
+var debugRuleFunctions = func() map[string]interface{} {
+	out := make(map[string]interface{}, len(ruleFunctions))
+	for k, v := range ruleFunctions {
+		if k != "Getenv" {
+			out[k] = v
+		}
+	}
+	return out
+}()
+
 func parseRuleText(text string) (*parser.Tree, error) {
 	return parser.Parse(text)
 }
@@ -95,7 +108,11 @@ func EvaluateRule(si Endpoint, originalText string, errorOnMissing bool, doValid
 }
 
 func ExecuteRule(originalText string, variables map[string]interface{}) (interface{}, error) {
-	env := utils.MergeInterfaceMaps(ruleFunctions, variables)
+	return executeRule(originalText, ruleFunctions, variables)
+}
+
+func executeRule(originalText string, functions map[string]interface{}, variables map[string]interface{}) (interface{}, error) {
+	env := utils.MergeInterfaceMaps(functions, variables)
 	ruleProg, err := expr.Compile(preprocessRuleText(originalText), expr.Env(env))
 	if err != nil {
 		return nil, err
@@ -132,6 +149,61 @@ func DoesServiceMatchRule(si Endpoint, ruleText string, doValidation bool) bool
 	return exprVal
 }
 
+// RuleEvaluation is the detailed result of evaluating a discovery rule against
+// a single endpoint, meant to help users debug their rules.
+type RuleEvaluation struct {
+	EndpointID ID `json:"endpointId" yaml:"endpointId"`
+	// Whether the rule matched the endpoint, i.e. would cause a monitor to
+	// be created for it
+	Matched bool `json:"matched" yaml:"matched"`
+	// The value that the rule evaluated to, if it could be evaluated to a
+	// true/false value.  Other values are left out so that the rule can't be
+	// used to dump arbitrary data.
+	Result interface{} `json:"result" yaml:"result"`
+	// Identifiers in the rule that are not variables of the endpoint.  Rules
+	// with missing identifiers never match.
+	MissingIdentifiers []string `json:"missingIdentifiers,omitempty" yaml:"missingIdentifiers,omitempty"`
+	Error              string   `json:"error,omitempty" yaml:"error,omitempty"`
+	// The variables available to the rule for the endpoint
+	Variables map[string]interface{} `json:"variables" yaml:"variables"`
+}
+
+// DebugRule evaluates the rule against the endpoint in the same way as
+// DoesServiceMatchRule but returns the details of the evaluation instead of
+// logging them.
+func DebugRule(si Endpoint, ruleText string) *RuleEvaluation {
+	out := &RuleEvaluation{
+		EndpointID: si.Core().ID,
+		Variables:  EndpointAsMap(si),
+	}
+
+	asMap := utils.DuplicateInterfaceMapKeysAsCamelCase(out.Variables)
+	missing, err := findMissingIdentifiers(ruleText, asMap)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if len(missing) > 0 {
+		out.MissingIdentifiers = missing
+		return out
+	}
+
+	result, err := executeRule(ruleText, debugRuleFunctions, asMap)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+
+	matched, ok := result.(bool)
+	if !ok {
+		out.Error = "rule did not evaluate to a true/false value"
+		return out
+	}
+	out.Result = matched
+	out.Matched = matched
+	return out
+}
+
 // ValidateDiscoveryRule takes a discovery rule string and returns false if it
 // can be determined to be invalid.  It does not guarantee validity but can be
 // used to give upfront feedback to the user if there are syntax errors in the
@@ -30,6 +30,51 @@ func TestDoesServiceMatchRule(t *testing.T) {
 	})
 }
 
+func TestDebugRule(t *testing.T) {
+	endpoint := NewEndpointCore("abcd", "test", "test", nil)
+	endpoint.Host = "10.0.0.1"
+	endpoint.Port = 6379
+
+	t.Run("Matches", func(t *testing.T) {
+		res := DebugRule(endpoint, `host == "10.0.0.1" && port == 6379`)
+		require.True(t, res.Matched)
+		require.Equal(t, true, res.Result)
+		require.Equal(t, ID("abcd"), res.EndpointID)
+		require.Equal(t, "10.0.0.1", res.Variables["host"])
+		require.Empty(t, res.Error)
+	})
+
+	t.Run("Does not match", func(t *testing.T) {
+		res := DebugRule(endpoint, `port == 5432`)
+		require.False(t, res.Matched)
+		require.Equal(t, false, res.Result)
+	})
+
+	t.Run("Reports missing identifiers", func(t *testing.T) {
+		res := DebugRule(endpoint, `container_image =~ "redis" && port == 6379`)
+		require.False(t, res.Matched)
+		require.Equal(t, []string{"container_image"}, res.MissingIdentifiers)
+	})
+
+	t.Run("Reports non-boolean results", func(t *testing.T) {
+		res := DebugRule(endpoint, `port`)
+		require.False(t, res.Matched)
+		require.Nil(t, res.Result)
+		require.NotEmpty(t, res.Error)
+	})
+
+	t.Run("Does not allow Getenv", func(t *testing.T) {
+		t.Setenv("RULE_TEST_SECRET", "s3cret")
+
+		res := DebugRule(endpoint, `Getenv("RULE_TEST_SECRET") != ""`)
+		require.False(t, res.Matched)
+		require.Nil(t, res.Result)
+		require.NotEmpty(t, res.Error)
+
+		require.True(t, DoesServiceMatchRule(endpoint, `Getenv("RULE_TEST_SECRET") != ""`, true))
+	})
+}
+
 func TestRuleEvaluation(t *testing.T) {
 	env := map[string]interface{}{
 		"container_id":    "abcdef",
@@ -1,19 +1,91 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
+	yaml "gopkg.in/yaml.v2"
+
 	"github.com/signalfx/signalfx-agent/pkg/core/common/constants"
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/monitors"
 	"github.com/signalfx/signalfx-agent/pkg/monitors/kubernetes/leadership"
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
 
+// StatusInfo is a structured form of the agent status.  Only the fields
+// relevant to the requested section are populated.
+type StatusInfo struct {
+	Version          string                         `json:"version,omitempty" yaml:"version,omitempty"`
+	UptimeSeconds    int64                          `json:"uptimeSeconds,omitempty" yaml:"uptimeSeconds,omitempty"`
+	Observers        []string                       `json:"observers,omitempty" yaml:"observers,omitempty"`
+	MonitorsSummary  *monitors.MonitorsSummary      `json:"monitorsSummary,omitempty" yaml:"monitorsSummary,omitempty"`
+	Writer           []writer.OutputStatus          `json:"writer,omitempty" yaml:"writer,omitempty"`
+	KubernetesLeader string                         `json:"kubernetesLeader,omitempty" yaml:"kubernetesLeader,omitempty"`
+	Config           interface{}                    `json:"config,omitempty" yaml:"config,omitempty"`
+	Monitors         []monitors.ActiveMonitorStatus `json:"monitors,omitempty" yaml:"monitors,omitempty"`
+	Endpoints        []monitors.EndpointStatus      `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+}
+
 func (a *Agent) diagnosticTextHandler(rw http.ResponseWriter, req *http.Request) {
 	section := req.URL.Query().Get("section")
-	_, _ = rw.Write([]byte(a.DiagnosticText(section)))
+
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "text":
+		_, _ = rw.Write([]byte(a.DiagnosticText(section)))
+	case "json", "yaml":
+		var out []byte
+		var err error
+		if format == "json" {
+			out, err = json.MarshalIndent(a.Status(section), "", "  ")
+			rw.Header().Add("Content-Type", "application/json")
+		} else {
+			out, err = yaml.Marshal(a.Status(section))
+			rw.Header().Add("Content-Type", "application/yaml")
+		}
+		if err != nil {
+			rw.WriteHeader(500)
+			_, _ = rw.Write([]byte(err.Error()))
+			return
+		}
+		_, _ = rw.Write(out)
+	default:
+		rw.WriteHeader(400)
+		_, _ = rw.Write([]byte(fmt.Sprintf("unknown status format %q, must be one of text, json or yaml", format)))
+	}
+}
+
+// Status returns the same information as DiagnosticText for the given section
+// but in a structured form suitable for serialization.
+func (a *Agent) Status(section string) *StatusInfo {
+	showAll := section == "all"
+	status := &StatusInfo{}
+
+	if section == "" || showAll {
+		status.Version = constants.Version
+		status.UptimeSeconds = int64(time.Since(a.startTime).Seconds())
+		status.Observers = a.observers.ObserverTypes()
+		status.MonitorsSummary = a.monitors.SummaryStatus()
+		status.Writer = a.writer.Status()
+		status.KubernetesLeader = leadership.CurrentLeader()
+	}
+
+	if section == "config" || showAll {
+		status.Config = config.ToMap(a.lastConfig)
+	}
+
+	if section == "monitors" || showAll {
+		status.Monitors = a.monitors.ActiveMonitorsStatus()
+	}
+
+	if section == "endpoints" || showAll {
+		status.Endpoints = a.monitors.EndpointsStatus()
+	}
+
+	return status
 }
 
 // DiagnosticText returns a simple textual output of the agent's status
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/monitors"
+	"github.com/signalfx/signalfx-agent/pkg/observers"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// ValidateConfig loads the config at the given path, resolving all remote
+// config values, and checks it in the same way as the agent would upon
+// startup, without actually starting anything.  It returns all of the
+// problems found, or nil if the config is valid.
+func ValidateConfig(configPath string) []error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configLoads, err := config.LoadConfig(ctx, configPath)
+	if err != nil {
+		return []error{err}
+	}
+	conf := <-configLoads
+
+	var errs []error
+
+	outputs := conf.Writer.OutputConfigs()
+	for i := range outputs {
+		if err := writer.ValidateOutputConfig(&outputs[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := range conf.Observers {
+		obsConf := &conf.Observers[i]
+		if err := observers.ValidateObserverConfig(obsConf); err != nil {
+			errs = append(errs, fmt.Errorf("observers[%d] (type %s): %v", i, obsConf.Type, err))
+		}
+	}
+
+	singleInstanceTypes := map[string]bool{}
+	for i := range conf.Monitors {
+		monConf := &conf.Monitors[i]
+		// This is done by the monitor manager when the agent is running
+		monConf.IntervalSeconds = utils.FirstNonZero(monConf.IntervalSeconds, conf.IntervalSeconds)
+
+		if err := monitors.ValidateMonitorConfig(monConf); err != nil {
+			errs = append(errs, fmt.Errorf("monitors[%d] (type %s): %v", i, monConf.Type, err))
+			continue
+		}
+
+		if monitors.OnlyAllowsSingleInstance(monConf.Type) {
+			if singleInstanceTypes[monConf.Type] {
+				errs = append(errs, fmt.Errorf("monitors[%d] (type %s): monitor type only allows a single instance at a time", i, monConf.Type))
+			}
+			singleInstanceTypes[monConf.Type] = true
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,258 @@
+// Package diskbuffer contains a simple FIFO queue of opaque payloads that is
+// persisted to a directory on disk.  It is used by writers to hold on to data
+// that could not be sent downstream so that it survives long outages and
+// agent restarts.
+package diskbuffer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+)
+
+const entrySuffix = ".entry"
+
+type entry struct {
+	name    string
+	size    int64
+	created time.Time
+}
+
+// Queue is a FIFO queue of byte payloads, with one file per entry in a single
+// directory.  File names are derived from the creation time of the entry so
+// that ordering survives a restart.  The total size of the queue is capped and
+// the oldest entries will be evicted to make room for new ones.  It is safe
+// for concurrent use.
+type Queue struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	lock       sync.Mutex
+	entries    []entry
+	totalBytes int64
+	lastID     int64
+
+	// Number of entries that were removed without being successfully
+	// processed because of the size cap or max age, or that were given to
+	// Drop
+	TotalDropped int64
+	// Number of entries that were removed after being processed
+	TotalProcessed int64
+}
+
+// Open creates the given directory if it doesn't exist and loads any
+// entries that are already in it from a previous run.  A maxBytes or maxAge
+// of zero means that the respective limit is not enforced.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create disk buffer directory %s: %v", dir, err)
+	}
+
+	q := &Queue{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read disk buffer directory %s: %v", dir, err)
+	}
+
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), entrySuffix+".tmp") {
+			// Left over from a write that was interrupted
+			_ = os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		if f.IsDir() || !strings.HasSuffix(f.Name(), entrySuffix) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), entrySuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.entries = append(q.entries, entry{
+			name:    f.Name(),
+			size:    f.Size(),
+			created: time.Unix(0, id),
+		})
+		q.totalBytes += f.Size()
+		if id > q.lastID {
+			q.lastID = id
+		}
+	}
+
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].created.Before(q.entries[j].created)
+	})
+
+	return q, nil
+}
+
+// nextName must be called while holding the lock.
+func (q *Queue) nextName() (string, time.Time) {
+	id := time.Now().UnixNano()
+	// Make sure names are strictly increasing even if the clock doesn't
+	// advance between calls or goes backwards.
+	if id <= q.lastID {
+		id = q.lastID + 1
+	}
+	q.lastID = id
+	return strconv.FormatInt(id, 10) + entrySuffix, time.Unix(0, id)
+}
+
+// Push adds the payload to the end of the queue, evicting the oldest entries
+// if necessary to stay within the size cap.
+func (q *Queue) Push(payload []byte) error {
+	size := int64(len(payload))
+	if q.maxBytes > 0 && size > q.maxBytes {
+		atomic.AddInt64(&q.TotalDropped, 1)
+		return fmt.Errorf("payload of %d bytes is larger than the disk buffer size cap", size)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for q.maxBytes > 0 && len(q.entries) > 0 && q.totalBytes+size > q.maxBytes {
+		q.removeHead()
+		atomic.AddInt64(&q.TotalDropped, 1)
+	}
+
+	name, created := q.nextName()
+
+	tmpPath := filepath.Join(q.dir, name+".tmp")
+	if err := ioutil.WriteFile(tmpPath, payload, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Rename so that a partially written file is never picked up on restart
+	if err := os.Rename(tmpPath, filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	q.entries = append(q.entries, entry{
+		name:    name,
+		size:    size,
+		created: created,
+	})
+	q.totalBytes += size
+
+	return nil
+}
+
+// Peek returns the oldest payload in the queue without removing it, along
+// with a name that should be passed to Remove once the payload has been
+// processed.  The last return value will be false if the queue is empty.
+func (q *Queue) Peek() (string, []byte, bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.entries) == 0 {
+		return "", nil, false, nil
+	}
+
+	head := q.entries[0]
+	payload, err := ioutil.ReadFile(filepath.Join(q.dir, head.name))
+	if err != nil {
+		// The entry is unreadable so it is never going to be useful.
+		q.removeHead()
+		atomic.AddInt64(&q.TotalDropped, 1)
+		return "", nil, false, fmt.Errorf("could not read disk buffer entry %s: %v", head.name, err)
+	}
+	return head.name, payload, true, nil
+}
+
+// Remove deletes the entry with the given name, as returned by Peek, after it
+// has been processed.
+func (q *Queue) Remove(name string) {
+	q.removeNamed(name, &q.TotalProcessed)
+}
+
+// Drop deletes the entry with the given name, as returned by Peek, when it
+// could not be processed and should not be retried.
+func (q *Queue) Drop(name string) {
+	q.removeNamed(name, &q.TotalDropped)
+}
+
+func (q *Queue) removeNamed(name string, counter *int64) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i := range q.entries {
+		if q.entries[i].name == name {
+			q.removeAt(i)
+			atomic.AddInt64(counter, 1)
+			return
+		}
+	}
+}
+
+// ExpireOld removes any entries that are older than the configured max age.
+// It returns the number of entries that were removed.
+func (q *Queue) ExpireOld() int {
+	if q.maxAge <= 0 {
+		return 0
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	cutoff := time.Now().Add(-q.maxAge)
+	expired := 0
+	for len(q.entries) > 0 && q.entries[0].created.Before(cutoff) {
+		q.removeHead()
+		expired++
+	}
+	atomic.AddInt64(&q.TotalDropped, int64(expired))
+	return expired
+}
+
+// Len returns the number of entries currently in the queue.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.entries)
+}
+
+// Bytes returns the total size of all entries currently in the queue.
+func (q *Queue) Bytes() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.totalBytes
+}
+
+// removeHead must be called while holding the lock.
+func (q *Queue) removeHead() {
+	q.removeAt(0)
+}
+
+// removeAt must be called while holding the lock.
+func (q *Queue) removeAt(i int) {
+	e := q.entries[i]
+	_ = os.Remove(filepath.Join(q.dir, e.name))
+	q.totalBytes -= e.size
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+}
+
+// InternalMetrics returns datapoints describing the state of the queue.
+func (q *Queue) InternalMetrics(prefix string) []*datapoint.Datapoint {
+	return []*datapoint.Datapoint{
+		sfxclient.Gauge(prefix+"disk_buffer_entries", nil, int64(q.Len())),
+		sfxclient.Gauge(prefix+"disk_buffer_bytes", nil, q.Bytes()),
+		sfxclient.CumulativeP(prefix+"disk_buffer_dropped", nil, &q.TotalDropped),
+		sfxclient.CumulativeP(prefix+"disk_buffer_replayed", nil, &q.TotalProcessed),
+	}
+}
@@ -0,0 +1,93 @@
+package diskbuffer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskbuffer")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Entries come out in order", func(t *testing.T) {
+		q, err := Open(dir, 0, 0)
+		require.Nil(t, err)
+
+		require.Nil(t, q.Push([]byte("a")))
+		require.Nil(t, q.Push([]byte("bb")))
+		require.Equal(t, 2, q.Len())
+		require.Equal(t, int64(3), q.Bytes())
+
+		name, payload, ok, err := q.Peek()
+		require.Nil(t, err)
+		require.True(t, ok)
+		require.Equal(t, "a", string(payload))
+		q.Remove(name)
+
+		_, payload, ok, _ = q.Peek()
+		require.True(t, ok)
+		require.Equal(t, "bb", string(payload))
+	})
+
+	t.Run("Entries survive reopening", func(t *testing.T) {
+		q, err := Open(dir, 0, 0)
+		require.Nil(t, err)
+		require.Equal(t, 1, q.Len())
+
+		name, payload, ok, _ := q.Peek()
+		require.True(t, ok)
+		require.Equal(t, "bb", string(payload))
+		q.Remove(name)
+
+		_, _, ok, _ = q.Peek()
+		require.False(t, ok)
+		require.Equal(t, int64(0), q.Bytes())
+	})
+
+	t.Run("Dropped entries are not counted as processed", func(t *testing.T) {
+		q, err := Open(dir, 0, 0)
+		require.Nil(t, err)
+
+		require.Nil(t, q.Push([]byte("a")))
+		name, _, _, _ := q.Peek()
+		q.Drop(name)
+
+		require.Equal(t, 0, q.Len())
+		require.Equal(t, int64(1), q.TotalDropped)
+		require.Equal(t, int64(0), q.TotalProcessed)
+	})
+
+	t.Run("Oldest entries are evicted when over the size cap", func(t *testing.T) {
+		q, err := Open(dir, 5, 0)
+		require.Nil(t, err)
+
+		require.Nil(t, q.Push([]byte("123")))
+		require.Nil(t, q.Push([]byte("456")))
+		require.Equal(t, 1, q.Len())
+		require.Equal(t, int64(1), q.TotalDropped)
+
+		name, payload, _, _ := q.Peek()
+		require.Equal(t, "456", string(payload))
+		q.Remove(name)
+
+		require.NotNil(t, q.Push([]byte("too big")))
+	})
+
+	t.Run("Old entries expire", func(t *testing.T) {
+		q, err := Open(dir, 0, 50*time.Millisecond)
+		require.Nil(t, err)
+
+		require.Nil(t, q.Push([]byte("old")))
+		time.Sleep(100 * time.Millisecond)
+		require.Nil(t, q.Push([]byte("new")))
+
+		require.Equal(t, 1, q.ExpireOld())
+		_, payload, _, _ := q.Peek()
+		require.Equal(t, "new", string(payload))
+	})
+}
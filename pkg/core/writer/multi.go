@@ -2,139 +2,402 @@ package writer
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/signalfx/golib/v3/datapoint"
 	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
 	"github.com/signalfx/golib/v3/trace"
+	log "github.com/sirupsen/logrus"
+
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
-	"github.com/signalfx/signalfx-agent/pkg/core/writer/signalfx"
-	"github.com/signalfx/signalfx-agent/pkg/core/writer/splunk"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/processor"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/tap"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/tracetracker"
 	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
 
-// MultiWriter combines the SignalFx and Splunk outputs.
+// An output along with the channels that feed it
+type outputInstance struct {
+	name   string
+	output Output
+
+	dpChan        chan []*datapoint.Datapoint
+	eventChan     chan *event.Event
+	dimensionChan chan *types.Dimension
+	spanChan      chan []*trace.Span
+
+	// Whether the output's name should be added as a dimension to its
+	// internal metrics to distinguish it from other outputs
+	addNameDim bool
+
+	dpsDropped        int64
+	eventsDropped     int64
+	spansDropped      int64
+	dimensionsDropped int64
+}
+
+// MultiWriter receives all of the data generated by the agent and broadcasts
+// it to all of the configured outputs.
 type MultiWriter struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	logger *utils.ThrottledLogger
 
-	signalFxWriter *signalfx.Writer
-	splunkWriter   *splunk.Output
+	dpChan        chan []*datapoint.Datapoint
+	eventChan     chan *event.Event
+	dimensionChan chan *types.Dimension
+	spanChan      chan []*trace.Span
+
+	aggregator         *processor.Aggregator
+	cardinalityLimiter *processor.CardinalityLimiter
+	// Receives the datapoints generated by the aggregator
+	aggregatedChan chan []*datapoint.Datapoint
+
+	outputs []*outputInstance
+
+	tapLock      sync.Mutex
+	eventTap     *tap.EventTap
+	spanTap      *tap.SpanTap
+	dimensionTap *tap.DimensionTap
 }
 
+// New creates a writer with all of the outputs specified in the config.  The
+// given channels are read from once Start is called.
 func New(conf *config.WriterConfig, dpChan chan []*datapoint.Datapoint, eventChan chan *event.Event,
 	dimensionChan chan *types.Dimension, spanChan chan []*trace.Span,
 	spanSourceTracker *tracetracker.SpanSourceTracker) (*MultiWriter, error) {
 
-	w := new(MultiWriter)
+	w := &MultiWriter{
+		logger:        utils.NewThrottledLogger(log.WithFields(log.Fields{"component": "writer"}), 20*time.Second),
+		dpChan:        dpChan,
+		eventChan:     eventChan,
+		dimensionChan: dimensionChan,
+		spanChan:      spanChan,
+		// This only gets a batch per aggregation rule per interval
+		aggregatedChan: make(chan []*datapoint.Datapoint, len(conf.DatapointAggregations)),
+	}
 	w.ctx, w.cancel = context.WithCancel(context.Background())
 
-	bothEnabled := conf.IsSignalFxOutputEnabled() && conf.IsSplunkOutputEnabled()
-
-	signalFxDPChan := dpChan
-	splunkDPChan := dpChan
-	signalFxEventChan := eventChan
-	splunkEventChan := eventChan
-	signalFxSpanChan := spanChan
-	splunkSpanChan := spanChan
-
-	// The channel handling is a bit hacky but we have to broadcast the
-	// datapoints to both writers if they are both present given our existing
-	// structure of sending datapoints through a channel.  If we ever get more
-	// than two writers, definitely refactor all of this.
-	if bothEnabled {
-		signalFxDPChan = make(chan []*datapoint.Datapoint, cap(dpChan))
-		splunkDPChan = make(chan []*datapoint.Datapoint, cap(dpChan))
-		signalFxEventChan = make(chan *event.Event, cap(eventChan))
-		splunkEventChan = make(chan *event.Event, cap(eventChan))
-		splunkSpanChan = make(chan []*trace.Span, cap(spanChan))
-
-		go func() {
-			for {
-				select {
-				case <-w.ctx.Done():
-					return
-				case dps := <-dpChan:
-					signalFxDPChan <- utils.CloneDatapointSlice(dps)
-					splunkDPChan <- dps
-				case ev := <-eventChan:
-					signalFxEventChan <- utils.CloneEvent(ev)
-					splunkEventChan <- ev
-				case span := <-spanChan:
-					signalFxSpanChan <- utils.CloneSpanSlice(span)
-					splunkSpanChan <- span
-				}
-			}
-		}()
+	var err error
+	w.aggregator, err = processor.NewAggregator(conf.DatapointAggregations)
+	if err != nil {
+		return nil, err
 	}
+	w.cardinalityLimiter = processor.NewCardinalityLimiter(conf.MaxTimeSeriesPerMonitor, conf.TimeSeriesExpiry.AsDuration())
 
-	if conf.IsSignalFxOutputEnabled() {
-		var err error
-		w.signalFxWriter, err = signalfx.New(conf, signalFxDPChan, signalFxEventChan, dimensionChan, signalFxSpanChan, spanSourceTracker)
-		if err != nil {
-			return nil, err
+	outputConfs := conf.OutputConfigs()
+	for i := range outputConfs {
+		oc := &outputConfs[i]
+
+		queueSize := func(defaultSize int) int {
+			if oc.QueueSize > 0 {
+				return oc.QueueSize
+			}
+			return defaultSize
+		}
+
+		inst := &outputInstance{
+			name:          oc.OutputName(),
+			dpChan:        make(chan []*datapoint.Datapoint, queueSize(cap(dpChan))),
+			eventChan:     make(chan *event.Event, queueSize(cap(eventChan))),
+			dimensionChan: make(chan *types.Dimension, queueSize(cap(dimensionChan))),
+			spanChan:      make(chan []*trace.Span, queueSize(cap(spanChan))),
+			addNameDim:    len(conf.Outputs) > 0,
 		}
-	}
 
-	if conf.IsSplunkOutputEnabled() {
-		var err error
-		w.splunkWriter, err = splunk.New(conf, splunkDPChan, splunkEventChan, splunkSpanChan)
+		inst.output, err = newOutput(oc, &OutputParams{
+			WriterConfig:      conf.ForOutput(oc),
+			DPs:               inst.dpChan,
+			Events:            inst.eventChan,
+			Dimensions:        inst.dimensionChan,
+			Spans:             inst.spanChan,
+			SpanSourceTracker: spanSourceTracker,
+		})
 		if err != nil {
+			w.Shutdown()
 			return nil, err
 		}
+
+		if do, ok := inst.output.(DimensionOutput); !ok || !do.AcceptsDimensionUpdates() {
+			inst.dimensionChan = nil
+		}
+
+		w.outputs = append(w.outputs, inst)
 	}
 
 	return w, nil
 }
 
+// Start all of the outputs and start broadcasting data to them.
 func (w *MultiWriter) Start() {
-	if w.signalFxWriter != nil {
-		w.signalFxWriter.Start()
+	for _, o := range w.outputs {
+		o.output.Start()
+	}
+
+	w.aggregator.Run(w.ctx, func(dps []*datapoint.Datapoint) {
+		select {
+		case w.aggregatedChan <- dps:
+		case <-w.ctx.Done():
+		}
+	})
+
+	w.cardinalityLimiter.Run(w.ctx)
+
+	go w.broadcast()
+}
+
+// broadcast sends everything that comes in on the input channels to each
+// output.  Each output gets its own copy of the data since outputs modify it
+// in place.  If an output's channel is full, the data is dropped for that
+// output only so that a slow output doesn't block the others.
+func (w *MultiWriter) broadcast() {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case dps := <-w.dpChan:
+			w.broadcastDatapoints(w.aggregator.Process(dps))
+		case dps := <-w.aggregatedChan:
+			w.broadcastDatapoints(dps)
+		case ev := <-w.eventChan:
+			w.broadcastEvent(ev)
+		case spans := <-w.spanChan:
+			w.tapLock.Lock()
+			if w.spanTap != nil {
+				w.spanTap.Accept(utils.CloneSpanSlice(spans))
+			}
+			w.tapLock.Unlock()
+
+			for i, o := range w.outputs {
+				// The last output gets the original
+				toSend := spans
+				if i < len(w.outputs)-1 {
+					toSend = utils.CloneSpanSlice(spans)
+				}
+				select {
+				case o.spanChan <- toSend:
+				default:
+					atomic.AddInt64(&o.spansDropped, int64(len(spans)))
+					w.logger.WithField("output", o.name).ThrottledWarning("Dropping trace spans for writer output that is not keeping up")
+				}
+			}
+		case dim := <-w.dimensionChan:
+			w.tapLock.Lock()
+			w.dimensionTap.Accept(dim)
+			w.tapLock.Unlock()
+
+			for _, o := range w.outputs {
+				if o.dimensionChan == nil {
+					continue
+				}
+				select {
+				case o.dimensionChan <- dim:
+				default:
+					atomic.AddInt64(&o.dimensionsDropped, 1)
+					w.logger.WithField("output", o.name).ThrottledWarning("Dropping dimension update for writer output that is not keeping up")
+				}
+			}
+		}
+	}
+}
+
+func (w *MultiWriter) broadcastDatapoints(dps []*datapoint.Datapoint) {
+	dps, events := w.cardinalityLimiter.Process(dps)
+	for _, ev := range events {
+		w.logger.Error(ev.Properties["message"])
+		w.broadcastEvent(ev)
+	}
+	if len(dps) == 0 {
+		return
 	}
 
-	if w.splunkWriter != nil {
-		w.splunkWriter.Start()
+	for i, o := range w.outputs {
+		// The last output gets the original
+		toSend := dps
+		if i < len(w.outputs)-1 {
+			toSend = utils.CloneDatapointSlice(dps)
+		}
+		select {
+		case o.dpChan <- toSend:
+		default:
+			atomic.AddInt64(&o.dpsDropped, int64(len(dps)))
+			w.logger.WithField("output", o.name).ThrottledWarning("Dropping datapoints for writer output that is not keeping up")
+		}
+	}
+}
+
+func (w *MultiWriter) broadcastEvent(ev *event.Event) {
+	w.tapLock.Lock()
+	if w.eventTap != nil {
+		w.eventTap.Accept(utils.CloneEvent(ev))
+	}
+	w.tapLock.Unlock()
+
+	for i, o := range w.outputs {
+		// The last output gets the original
+		toSend := ev
+		if i < len(w.outputs)-1 {
+			toSend = utils.CloneEvent(ev)
+		}
+		select {
+		case o.eventChan <- toSend:
+		default:
+			atomic.AddInt64(&o.eventsDropped, 1)
+			w.logger.WithField("output", o.name).ThrottledWarning("Dropping event for writer output that is not keeping up")
+		}
 	}
 }
 
+// Shutdown stops broadcasting and shuts down all of the outputs.
 func (w *MultiWriter) Shutdown() {
 	if w.cancel != nil {
 		w.cancel()
 	}
-	if w.signalFxWriter != nil {
-		w.signalFxWriter.Shutdown()
-	}
-	if w.splunkWriter != nil {
-		w.splunkWriter.Shutdown()
+	for _, o := range w.outputs {
+		o.output.Shutdown()
 	}
 }
 
+// InternalMetrics returns the internal metrics of all of the outputs, as
+// well as how much data has been dropped for each of them, how much has
+// been aggregated and how many time series each monitor is sending.
 func (w *MultiWriter) InternalMetrics() []*datapoint.Datapoint {
-	var dps []*datapoint.Datapoint
+	dps := append(w.aggregator.InternalMetrics(), w.cardinalityLimiter.InternalMetrics()...)
 
-	if w.signalFxWriter != nil {
-		dps = append(dps, w.signalFxWriter.InternalMetrics()...)
-	}
-	if w.splunkWriter != nil {
-		dps = append(dps, w.splunkWriter.InternalMetrics()...)
+	for _, o := range w.outputs {
+		outputDims := map[string]string{"output": o.name}
+		dps = append(dps,
+			sfxclient.CumulativeP("sfxagent.writer_output_datapoints_dropped", outputDims, &o.dpsDropped),
+			sfxclient.CumulativeP("sfxagent.writer_output_events_dropped", outputDims, &o.eventsDropped),
+			sfxclient.CumulativeP("sfxagent.writer_output_trace_spans_dropped", outputDims, &o.spansDropped),
+			sfxclient.CumulativeP("sfxagent.writer_output_dimension_updates_dropped", outputDims, &o.dimensionsDropped),
+		)
+
+		for _, dp := range o.output.InternalMetrics() {
+			if o.addNameDim {
+				dp.Dimensions = utils.MergeStringMaps(dp.Dimensions, outputDims)
+			}
+			dps = append(dps, dp)
+		}
 	}
 
 	return dps
 }
 
+// DiagnosticText returns the diagnostic text of all of the outputs that
+// provide it.
 func (w *MultiWriter) DiagnosticText() string {
-	if w.signalFxWriter != nil {
-		return w.signalFxWriter.DiagnosticText()
+	var sections []string
+	for _, o := range w.outputs {
+		do, ok := o.output.(DiagnosticOutput)
+		if !ok {
+			continue
+		}
+		if len(w.outputs) == 1 {
+			return do.DiagnosticText()
+		}
+		sections = append(sections, fmt.Sprintf("Output %s:\n%s", o.name, utils.IndentLines(do.DiagnosticText(), 2)))
 	}
-	return "No writer information available"
+
+	if len(sections) == 0 {
+		return "No writer information available"
+	}
+	return strings.Join(sections, "\n")
+}
+
+// OutputStatus holds the internal stats of a single output in a structured
+// form.  Stats are keyed by internal metric name, with the dimensions of the
+// metric appended if it has any.
+type OutputStatus struct {
+	Name  string                 `json:"name" yaml:"name"`
+	Stats map[string]interface{} `json:"stats" yaml:"stats"`
+}
+
+func dimensionsKey(dims map[string]string) string {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + dims[k]
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Status returns the stats of each output as a structured value.  It contains
+// the same information as the writer's internal metrics.
+func (w *MultiWriter) Status() []OutputStatus {
+	out := make([]OutputStatus, 0, len(w.outputs))
+	for _, o := range w.outputs {
+		stats := map[string]interface{}{
+			"sfxagent.writer_output_datapoints_dropped":        atomic.LoadInt64(&o.dpsDropped),
+			"sfxagent.writer_output_events_dropped":            atomic.LoadInt64(&o.eventsDropped),
+			"sfxagent.writer_output_trace_spans_dropped":       atomic.LoadInt64(&o.spansDropped),
+			"sfxagent.writer_output_dimension_updates_dropped": atomic.LoadInt64(&o.dimensionsDropped),
+		}
+
+		for _, dp := range o.output.InternalMetrics() {
+			key := dp.Metric
+			if len(dp.Dimensions) > 0 {
+				key += dimensionsKey(dp.Dimensions)
+			}
+			switch v := dp.Value.(type) {
+			case datapoint.IntValue:
+				stats[key] = v.Int()
+			case datapoint.FloatValue:
+				stats[key] = v.Float()
+			default:
+				stats[key] = dp.Value.String()
+			}
+		}
+		out = append(out, OutputStatus{Name: o.name, Stats: stats})
+	}
+	return out
 }
 
 // SetTap allows you to set one datapoint tap at a time to inspect datapoints
-// going out of the agent.
+// going out of the agent.  The tap is attached to the first output that
+// supports it.
 func (w *MultiWriter) SetTap(dpTap *tap.DatapointTap) {
-	if w.signalFxWriter != nil {
-		w.signalFxWriter.SetTap(dpTap)
+	for _, o := range w.outputs {
+		if to, ok := o.output.(TappableOutput); ok {
+			to.SetTap(dpTap)
+			return
+		}
 	}
 }
+
+// SetEventTap sets a tap that sees all events that come into the writer, or
+// clears it if nil.  Only one event tap can be set at a time.
+func (w *MultiWriter) SetEventTap(eventTap *tap.EventTap) {
+	w.tapLock.Lock()
+	defer w.tapLock.Unlock()
+	w.eventTap = eventTap
+}
+
+// SetSpanTap sets a tap that sees all trace spans that come into the writer,
+// or clears it if nil.  Only one span tap can be set at a time.
+func (w *MultiWriter) SetSpanTap(spanTap *tap.SpanTap) {
+	w.tapLock.Lock()
+	defer w.tapLock.Unlock()
+	w.spanTap = spanTap
+}
+
+// SetDimensionTap sets a tap that sees all dimension updates that come into
+// the writer, or clears it if nil.  Only one dimension tap can be set at a
+// time.
+func (w *MultiWriter) SetDimensionTap(dimensionTap *tap.DimensionTap) {
+	w.tapLock.Lock()
+	defer w.tapLock.Unlock()
+	w.dimensionTap = dimensionTap
+}
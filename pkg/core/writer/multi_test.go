@@ -0,0 +1,116 @@
+package writer
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+)
+
+type fakeOutputConfig struct {
+	Paused bool `yaml:"paused"`
+}
+
+type fakeOutput struct {
+	params   *OutputParams
+	received chan *datapoint.Datapoint
+}
+
+func (f *fakeOutput) Start() {
+	if f.params.Config.(*fakeOutputConfig).Paused {
+		return
+	}
+	go func() {
+		for dps := range f.params.DPs {
+			for _, dp := range dps {
+				f.received <- dp
+			}
+		}
+	}()
+}
+
+func (f *fakeOutput) Shutdown() {}
+
+func (f *fakeOutput) InternalMetrics() []*datapoint.Datapoint {
+	return nil
+}
+
+func (f *fakeOutput) AcceptsDimensionUpdates() bool {
+	return true
+}
+
+var fakeOutputs = map[string]*fakeOutput{}
+
+func init() {
+	RegisterOutput("fake", func(params *OutputParams) (Output, error) {
+		out := &fakeOutput{
+			params:   params,
+			received: make(chan *datapoint.Datapoint, 100),
+		}
+		fakeOutputs[params.OutputConfig.OutputName()] = out
+		return out, nil
+	}, &fakeOutputConfig{})
+}
+
+func TestMultiWriter(t *testing.T) {
+	dpChan := make(chan []*datapoint.Datapoint, 10)
+	dimChan := make(chan *types.Dimension, 10)
+
+	w, err := New(&config.WriterConfig{
+		Outputs: []config.OutputConfig{
+			{Type: "fake", Name: "a"},
+			{Type: "fake", Name: "b", QueueSize: 1, OtherConfig: map[string]interface{}{"paused": true}},
+		},
+	}, dpChan, make(chan *event.Event), dimChan, make(chan []*trace.Span), nil)
+	require.Nil(t, err)
+
+	w.Start()
+	defer w.Shutdown()
+
+	for i := 0; i < 5; i++ {
+		dpChan <- []*datapoint.Datapoint{datapoint.New("test", map[string]string{}, datapoint.NewIntValue(int64(i)), datapoint.Gauge, time.Now())}
+	}
+
+	// The paused output should not hold up the other one
+	for i := 0; i < 5; i++ {
+		select {
+		case dp := <-fakeOutputs["a"].received:
+			require.Equal(t, int64(i), dp.Value.(datapoint.IntValue).Int())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Datapoint %d was not received", i)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		dimChan <- &types.Dimension{Name: "host", Value: "a", Properties: map[string]string{"i": strconv.Itoa(i)}}
+	}
+
+	dropped := func(metric string, expected int64) func() bool {
+		return func() bool {
+			for _, dp := range w.InternalMetrics() {
+				if dp.Metric == metric && dp.Dimensions["output"] == "b" {
+					return dp.Value.(datapoint.IntValue).Int() == expected
+				}
+			}
+			return false
+		}
+	}
+
+	require.Eventually(t, dropped("sfxagent.writer_output_datapoints_dropped", 4), 5*time.Second, 10*time.Millisecond)
+	// The paused output only has room for one dimension update
+	require.Eventually(t, dropped("sfxagent.writer_output_dimension_updates_dropped", 2), 5*time.Second, 10*time.Millisecond)
+}
+
+func TestUnknownOutputType(t *testing.T) {
+	_, err := New(&config.WriterConfig{
+		Outputs: []config.OutputConfig{{Type: "nope"}},
+	}, nil, nil, nil, nil, nil)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,355 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/trace"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/constants"
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
+)
+
+const scopeName = "signalfx-agent"
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// attributesFromMap converts a string map to OTLP attributes, sorted by key
+// so that the output is deterministic.
+func attributesFromMap(m map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, stringAttr(k, m[k]))
+	}
+	return attrs
+}
+
+// splitHostIDDims separates the host id dimensions out of the given
+// dimensions.  If all of the host id dims are present with the expected
+// values, they are returned separately from the rest of the dims so they can
+// be put on the resource.  Otherwise the datapoint or span is not
+// host-specific and the dims are returned unchanged with no resource dims.
+func splitHostIDDims(dims map[string]string, hostIDDims map[string]string) (resourceDims map[string]string, rest map[string]string) {
+	if len(hostIDDims) == 0 {
+		return nil, dims
+	}
+	for k, v := range hostIDDims {
+		if dims[k] != v {
+			return nil, dims
+		}
+	}
+
+	rest = make(map[string]string, len(dims))
+	for k, v := range dims {
+		if _, ok := hostIDDims[k]; !ok {
+			rest[k] = v
+		}
+	}
+	return hostIDDims, rest
+}
+
+func newScope() *commonpb.InstrumentationScope {
+	return &commonpb.InstrumentationScope{
+		Name:    scopeName,
+		Version: constants.Version,
+	}
+}
+
+// numberDataPoint converts the value of the datapoint to an OTLP number data
+// point, or returns false if the value is not numeric.
+func numberDataPoint(dp *datapoint.Datapoint, attrs map[string]string) (*metricspb.NumberDataPoint, bool) {
+	ts := dp.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	ndp := &metricspb.NumberDataPoint{
+		Attributes:   attributesFromMap(attrs),
+		TimeUnixNano: uint64(ts.UnixNano()),
+	}
+
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		ndp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v.Int()}
+	case datapoint.FloatValue:
+		ndp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v.Float()}
+	default:
+		return nil, false
+	}
+
+	if ex, ok := dp.Meta[dpmeta.ExemplarMeta].(*dpmeta.Exemplar); ok {
+		ndp.Exemplars = []*metricspb.Exemplar{convertExemplar(ex)}
+	}
+	return ndp, true
+}
+
+func convertExemplar(ex *dpmeta.Exemplar) *metricspb.Exemplar {
+	out := &metricspb.Exemplar{
+		FilteredAttributes: attributesFromMap(ex.Labels),
+		Value:              &metricspb.Exemplar_AsDouble{AsDouble: ex.Value},
+	}
+	if ex.TraceID != "" {
+		out.TraceId = decodeID(ex.TraceID, 16)
+	}
+	if ex.SpanID != "" {
+		out.SpanId = decodeID(ex.SpanID, 8)
+	}
+	if !ex.Timestamp.IsZero() {
+		out.TimeUnixNano = uint64(ex.Timestamp.UnixNano())
+	}
+	return out
+}
+
+// newMetric creates an empty OTLP metric of the type that best matches the
+// SignalFx metric type.  Cumulative counters are monotonic sums with
+// cumulative temporality and (delta) counters are monotonic sums with delta
+// temporality.  Everything else is a gauge.
+func newMetric(name string, mt datapoint.MetricType) *metricspb.Metric {
+	m := &metricspb.Metric{Name: name}
+	switch mt {
+	case datapoint.Counter:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	case datapoint.Count:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+		}}
+	default:
+		m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+	}
+	return m
+}
+
+func appendDataPoint(m *metricspb.Metric, ndp *metricspb.NumberDataPoint) {
+	switch d := m.Data.(type) {
+	case *metricspb.Metric_Sum:
+		d.Sum.DataPoints = append(d.Sum.DataPoints, ndp)
+	case *metricspb.Metric_Gauge:
+		d.Gauge.DataPoints = append(d.Gauge.DataPoints, ndp)
+	}
+}
+
+type metricKey struct {
+	name string
+	mt   datapoint.MetricType
+}
+
+// convertDatapoints converts a batch of datapoints to OTLP resource metrics.
+// Datapoints that have the host id dimensions are grouped under a resource
+// with those dimensions as attributes, and all others are put under a
+// resource with no attributes.  The number of datapoints that were skipped
+// because they have non-numeric values is also returned.
+func convertDatapoints(dps []*datapoint.Datapoint, hostIDDims map[string]string) ([]*metricspb.ResourceMetrics, int) {
+	var hostRM, otherRM *metricspb.ResourceMetrics
+	metricsByRM := map[*metricspb.ResourceMetrics]map[metricKey]*metricspb.Metric{}
+	skipped := 0
+
+	for _, dp := range dps {
+		resourceDims, attrs := splitHostIDDims(dp.Dimensions, hostIDDims)
+
+		ndp, ok := numberDataPoint(dp, attrs)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		rm := &otherRM
+		if resourceDims != nil {
+			rm = &hostRM
+		}
+		if *rm == nil {
+			*rm = &metricspb.ResourceMetrics{
+				Resource: &resourcepb.Resource{Attributes: attributesFromMap(resourceDims)},
+				ScopeMetrics: []*metricspb.ScopeMetrics{
+					{Scope: newScope()},
+				},
+			}
+			metricsByRM[*rm] = map[metricKey]*metricspb.Metric{}
+		}
+
+		key := metricKey{name: dp.Metric, mt: dp.MetricType}
+		m := metricsByRM[*rm][key]
+		if m == nil {
+			m = newMetric(dp.Metric, dp.MetricType)
+			metricsByRM[*rm][key] = m
+			(*rm).ScopeMetrics[0].Metrics = append((*rm).ScopeMetrics[0].Metrics, m)
+		}
+		appendDataPoint(m, ndp)
+	}
+
+	var out []*metricspb.ResourceMetrics
+	for _, rm := range []*metricspb.ResourceMetrics{hostRM, otherRM} {
+		if rm != nil {
+			out = append(out, rm)
+		}
+	}
+	return out, skipped
+}
+
+// decodeID converts a hex trace or span id to bytes of the given length,
+// left padding shorter ids with zeros (e.g. 64-bit Zipkin trace ids).
+func decodeID(id string, length int) []byte {
+	if len(id)%2 == 1 {
+		id = "0" + id
+	}
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) > length {
+		return nil
+	}
+	if len(b) < length {
+		b = append(make([]byte, length-len(b)), b...)
+	}
+	return b
+}
+
+func spanKind(kind *string) tracepb.Span_SpanKind {
+	if kind == nil {
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+	switch strings.ToUpper(*kind) {
+	case "SERVER":
+		return tracepb.Span_SPAN_KIND_SERVER
+	case "CLIENT":
+		return tracepb.Span_SPAN_KIND_CLIENT
+	case "PRODUCER":
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case "CONSUMER":
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	default:
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+}
+
+// endpointTags returns the attributes that describe the remote endpoint of a
+// span, using the OpenTelemetry semantic conventions.
+func endpointTags(ep *trace.Endpoint) map[string]string {
+	tags := map[string]string{}
+	if ep == nil {
+		return tags
+	}
+	if ep.ServiceName != nil && *ep.ServiceName != "" {
+		tags["peer.service"] = *ep.ServiceName
+	}
+	if ep.Ipv4 != nil && *ep.Ipv4 != "" {
+		tags["net.peer.ip"] = *ep.Ipv4
+	} else if ep.Ipv6 != nil && *ep.Ipv6 != "" {
+		tags["net.peer.ip"] = *ep.Ipv6
+	}
+	if ep.Port != nil && *ep.Port != 0 {
+		tags["net.peer.port"] = strconv.Itoa(int(*ep.Port))
+	}
+	return tags
+}
+
+func convertSpan(span *trace.Span, tags map[string]string) *tracepb.Span {
+	out := &tracepb.Span{
+		TraceId: decodeID(span.TraceID, 16),
+		SpanId:  decodeID(span.ID, 8),
+		Kind:    spanKind(span.Kind),
+	}
+	if span.ParentID != nil {
+		out.ParentSpanId = decodeID(*span.ParentID, 8)
+	}
+	if span.Name != nil {
+		out.Name = *span.Name
+	}
+
+	// Zipkin timestamps and durations are in microseconds
+	if span.Timestamp != nil {
+		out.StartTimeUnixNano = uint64(*span.Timestamp * 1000)
+		out.EndTimeUnixNano = out.StartTimeUnixNano
+		if span.Duration != nil {
+			out.EndTimeUnixNano += uint64(*span.Duration * 1000)
+		}
+	}
+
+	attrs := endpointTags(span.RemoteEndpoint)
+	for k, v := range tags {
+		attrs[k] = v
+	}
+	if strings.EqualFold(attrs["error"], "true") {
+		out.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR}
+	}
+	out.Attributes = attributesFromMap(attrs)
+
+	for _, a := range span.Annotations {
+		if a == nil || a.Value == nil {
+			continue
+		}
+		ev := &tracepb.Span_Event{Name: *a.Value}
+		if a.Timestamp != nil {
+			ev.TimeUnixNano = uint64(*a.Timestamp * 1000)
+		}
+		out.Events = append(out.Events, ev)
+	}
+
+	return out
+}
+
+type resourceKey struct {
+	serviceName string
+	hostDims    bool
+}
+
+// convertSpans converts a batch of spans to OTLP resource spans.  Spans are
+// grouped by service name (taken from the local endpoint) and by whether they
+// have the host id dimensions as tags, which are moved to the resource.
+func convertSpans(spans []*trace.Span, hostIDDims map[string]string) []*tracepb.ResourceSpans {
+	var out []*tracepb.ResourceSpans
+	rsByKey := map[resourceKey]*tracepb.ResourceSpans{}
+
+	for _, span := range spans {
+		resourceDims, tags := splitHostIDDims(span.Tags, hostIDDims)
+
+		key := resourceKey{hostDims: resourceDims != nil}
+		if span.LocalEndpoint != nil && span.LocalEndpoint.ServiceName != nil {
+			key.serviceName = *span.LocalEndpoint.ServiceName
+		}
+
+		rs := rsByKey[key]
+		if rs == nil {
+			resourceAttrs := map[string]string{}
+			for k, v := range resourceDims {
+				resourceAttrs[k] = v
+			}
+			if key.serviceName != "" {
+				resourceAttrs["service.name"] = key.serviceName
+			}
+
+			rs = &tracepb.ResourceSpans{
+				Resource: &resourcepb.Resource{Attributes: attributesFromMap(resourceAttrs)},
+				ScopeSpans: []*tracepb.ScopeSpans{
+					{Scope: newScope()},
+				},
+			}
+			rsByKey[key] = rs
+			out = append(out, rs)
+		}
+
+		rs.ScopeSpans[0].Spans = append(rs.ScopeSpans[0].Spans, convertSpan(span, tags))
+	}
+
+	return out
+}
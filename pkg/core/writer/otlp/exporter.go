@@ -0,0 +1,160 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/auth"
+)
+
+// exporter sends OTLP export requests with a particular transport
+type exporter interface {
+	exportMetrics(context.Context, *colmetricspb.ExportMetricsServiceRequest) error
+	exportTraces(context.Context, *coltracepb.ExportTraceServiceRequest) error
+	close()
+}
+
+type grpcExporter struct {
+	conn          *grpc.ClientConn
+	metricsClient colmetricspb.MetricsServiceClient
+	traceClient   coltracepb.TraceServiceClient
+	headers       metadata.MD
+	timeout       time.Duration
+}
+
+func newGRPCExporter(conf *Config) (*grpcExporter, error) {
+	creds := insecure.NewCredentials()
+	if conf.UseHTTPS {
+		tlsConfig, err := auth.TLSConfig(&tls.Config{
+			InsecureSkipVerify: conf.SkipVerify,
+			ServerName:         conf.SNIServerName,
+		}, conf.CACertPath, conf.ClientCertPath, conf.ClientKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	// This doesn't block so the collector doesn't have to be up yet
+	conn, err := grpc.Dial(conf.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := metadata.MD{}
+	for k, v := range conf.HTTPHeaders {
+		headers.Append(strings.ToLower(k), v)
+	}
+
+	return &grpcExporter{
+		conn:          conn,
+		metricsClient: colmetricspb.NewMetricsServiceClient(conn),
+		traceClient:   coltracepb.NewTraceServiceClient(conn),
+		headers:       headers,
+		timeout:       conf.HTTPTimeout.AsDuration(),
+	}, nil
+}
+
+func (e *grpcExporter) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = metadata.NewOutgoingContext(ctx, e.headers)
+	if e.timeout > 0 {
+		return context.WithTimeout(ctx, e.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (e *grpcExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	ctx, cancel := e.requestContext(ctx)
+	defer cancel()
+
+	_, err := e.metricsClient.Export(ctx, req)
+	return err
+}
+
+func (e *grpcExporter) exportTraces(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	ctx, cancel := e.requestContext(ctx)
+	defer cancel()
+
+	_, err := e.traceClient.Export(ctx, req)
+	return err
+}
+
+func (e *grpcExporter) close() {
+	_ = e.conn.Close()
+}
+
+type httpExporter struct {
+	client     *http.Client
+	metricsURL string
+	tracesURL  string
+}
+
+func newHTTPExporter(conf *Config) (*httpExporter, error) {
+	conf.UseHTTPS = strings.HasPrefix(conf.Endpoint, "https")
+
+	client, err := conf.HTTPConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(conf.Endpoint, "/")
+	return &httpExporter{
+		client:     client,
+		metricsURL: base + "/v1/metrics",
+		tracesURL:  base + "/v1/traces",
+	}, nil
+}
+
+func (e *httpExporter) post(ctx context.Context, url string, msg proto.Message) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("non-2xx response received (%d): %s", resp.StatusCode, string(respBody))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+func (e *httpExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	return e.post(ctx, e.metricsURL, req)
+}
+
+func (e *httpExporter) exportTraces(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) error {
+	return e.post(ctx, e.tracesURL, req)
+}
+
+func (e *httpExporter) close() {
+	e.client.CloseIdleConnections()
+}
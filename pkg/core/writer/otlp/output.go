@@ -0,0 +1,202 @@
+// Package otlp contains a writer output that sends datapoints and trace spans
+// to an OpenTelemetry Protocol (OTLP) receiver, such as the OpenTelemetry
+// Collector, over either gRPC or HTTP/protobuf.  Events have no OTLP
+// equivalent and are ignored.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	sfxwriter "github.com/signalfx/signalfx-go/writer"
+	"github.com/sirupsen/logrus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/httpclient"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/processor"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+const outputType = "otlp"
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+)
+
+// Config for the OTLP output
+type Config struct {
+	// The `useHTTPS` option enables TLS for the `grpc` protocol.  With the
+	// `http` protocol it is inferred from the scheme of `endpoint`.  The
+	// `httpHeaders` are sent as gRPC metadata when using `grpc`.
+	httpclient.HTTPConfig `yaml:",inline"`
+	// The protocol to use to send data, either `grpc` or `http` (which
+	// means HTTP with protobuf payloads).
+	Protocol string `yaml:"protocol" default:"grpc"`
+	// Where to send data.  For the `grpc` protocol this is a `host:port`
+	// pair, e.g. `otel-collector:4317`.  For the `http` protocol this is the
+	// base URL of the receiver, e.g. `http://otel-collector:4318`, and the
+	// standard `/v1/metrics` and `/v1/traces` paths are appended to it.
+	Endpoint string `yaml:"endpoint" validate:"required"`
+}
+
+// Validate the config
+func (c *Config) Validate() error {
+	if c.Protocol != protocolGRPC && c.Protocol != protocolHTTP {
+		return fmt.Errorf("protocol must be either '%s' or '%s'", protocolGRPC, protocolHTTP)
+	}
+	return nil
+}
+
+// Output sends datapoints and spans to an OTLP receiver.
+type Output struct {
+	*processor.Processor
+
+	endpoint   string
+	exporter   exporter
+	hostIDDims map[string]string
+	dpWriter   *sfxwriter.DatapointWriter
+	spanWriter *sfxwriter.SpanWriter
+	logger     *utils.ThrottledLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	eventChan chan *event.Event
+
+	// Datapoints that could not be converted because their values are not
+	// numeric
+	dpsSkipped int64
+}
+
+func init() {
+	writer.RegisterOutput(outputType, func(params *writer.OutputParams) (writer.Output, error) {
+		return New(params.Config.(*Config), params)
+	}, &Config{})
+}
+
+// New creates a new OTLP output
+func New(conf *Config, params *writer.OutputParams) (*Output, error) {
+	var exp exporter
+	var err error
+	switch conf.Protocol {
+	case protocolHTTP:
+		exp, err = newHTTPExporter(conf)
+	default:
+		exp, err = newGRPCExporter(conf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wc := params.WriterConfig
+	out := &Output{
+		Processor:  processor.New(wc),
+		endpoint:   conf.Endpoint,
+		exporter:   exp,
+		hostIDDims: wc.HostIDDims,
+		logger: utils.NewThrottledLogger(logrus.WithFields(logrus.Fields{
+			"component": "writer",
+			"output":    params.OutputConfig.OutputName(),
+		}), 20*time.Second),
+		eventChan: params.Events,
+	}
+	out.ctx, out.cancel = context.WithCancel(context.Background())
+
+	out.dpWriter = &sfxwriter.DatapointWriter{
+		PreprocessFunc: out.PreprocessDatapoint,
+		SendFunc:       out.sendDatapoints,
+		OverwriteFunc: func() {
+			out.logger.ThrottledWarning("A datapoint was overwritten in the OTLP buffer, please consider increasing the maxBuffered option of the output")
+		},
+		MaxBatchSize: wc.DatapointMaxBatchSize,
+		MaxRequests:  wc.MaxRequests,
+		MaxBuffered:  wc.MaxDatapointsBuffered,
+		InputChan:    params.DPs,
+	}
+
+	out.spanWriter = &sfxwriter.SpanWriter{
+		PreprocessFunc: out.PreprocessSpan,
+		SendFunc:       out.sendSpans,
+		MaxBatchSize:   wc.TraceSpanMaxBatchSize,
+		MaxRequests:    wc.MaxRequests,
+		MaxBuffered:    int(wc.MaxTraceSpansInFlight),
+		InputChan:      params.Spans,
+	}
+
+	return out, nil
+}
+
+// Start sending datapoints and spans
+func (o *Output) Start() {
+	o.dpWriter.Start(o.ctx)
+	o.spanWriter.Start(o.ctx)
+
+	o.logger.Infof("Sending datapoints and trace spans to OTLP endpoint %s", o.endpoint)
+
+	// Events aren't supported so just drain them.
+	go func() {
+		for {
+			select {
+			case <-o.ctx.Done():
+				return
+			case <-o.eventChan:
+			}
+		}
+	}()
+}
+
+func (o *Output) sendDatapoints(ctx context.Context, dps []*datapoint.Datapoint) error {
+	rms, skipped := convertDatapoints(dps, o.hostIDDims)
+	if skipped > 0 {
+		atomic.AddInt64(&o.dpsSkipped, int64(skipped))
+	}
+	if len(rms) == 0 {
+		return nil
+	}
+
+	err := o.exporter.exportMetrics(ctx, &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: rms})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		o.logger.WithError(utils.SanitizeHTTPError(err)).ThrottledError("Failed to send datapoints to OTLP endpoint")
+	}
+	return err
+}
+
+func (o *Output) sendSpans(ctx context.Context, spans []*trace.Span) error {
+	rss := convertSpans(spans, o.hostIDDims)
+	if len(rss) == 0 {
+		return nil
+	}
+
+	err := o.exporter.exportTraces(ctx, &coltracepb.ExportTraceServiceRequest{ResourceSpans: rss})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		o.logger.WithError(utils.SanitizeHTTPError(err)).ThrottledError("Failed to send trace spans to OTLP endpoint")
+	}
+	return err
+}
+
+// Shutdown the output
+func (o *Output) Shutdown() {
+	if o.cancel != nil {
+		o.cancel()
+	}
+	o.exporter.close()
+}
+
+// InternalMetrics returns a set of metrics showing how the output is
+// currently doing.
+func (o *Output) InternalMetrics() []*datapoint.Datapoint {
+	return append(append(
+		o.dpWriter.InternalMetrics("otlp."),
+		o.spanWriter.InternalMetrics("otlp.")...),
+		sfxclient.CumulativeP("otlp.datapoints_skipped", nil, &o.dpsSkipped))
+}
@@ -0,0 +1,214 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+)
+
+func attrMap(attrs []*commonpb.KeyValue) map[string]string {
+	out := map[string]string{}
+	for _, kv := range attrs {
+		out[kv.Key] = kv.Value.GetStringValue()
+	}
+	return out
+}
+
+func TestConvertDatapoints(t *testing.T) {
+	hostIDDims := map[string]string{"host": "myhost"}
+	ts := time.Unix(1000, 0)
+
+	rms, skipped := convertDatapoints([]*datapoint.Datapoint{
+		datapoint.New("cpu.utilization", map[string]string{"host": "myhost", "cpu": "0"}, datapoint.NewFloatValue(50.5), datapoint.Gauge, ts),
+		datapoint.New("requests", map[string]string{"host": "myhost"}, datapoint.NewIntValue(10), datapoint.Counter, ts),
+		datapoint.New("errors", map[string]string{"host": "myhost"}, datapoint.NewIntValue(2), datapoint.Count, ts),
+		datapoint.New("cluster.nodes", map[string]string{"cluster": "a"}, datapoint.NewIntValue(3), datapoint.Gauge, ts),
+		datapoint.New("info", nil, datapoint.NewStringValue("x"), datapoint.Gauge, ts),
+	}, hostIDDims)
+
+	require.Equal(t, 1, skipped)
+	require.Len(t, rms, 2)
+
+	t.Run("host-specific datapoints", func(t *testing.T) {
+		require.Equal(t, hostIDDims, attrMap(rms[0].Resource.Attributes))
+		metrics := rms[0].ScopeMetrics[0].Metrics
+		require.Len(t, metrics, 3)
+
+		gauge := metrics[0].GetGauge()
+		require.NotNil(t, gauge)
+		require.Equal(t, 50.5, gauge.DataPoints[0].GetAsDouble())
+		require.Equal(t, map[string]string{"cpu": "0"}, attrMap(gauge.DataPoints[0].Attributes))
+		require.Equal(t, uint64(ts.UnixNano()), gauge.DataPoints[0].TimeUnixNano)
+
+		cumulative := metrics[1].GetSum()
+		require.NotNil(t, cumulative)
+		require.True(t, cumulative.IsMonotonic)
+		require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, cumulative.AggregationTemporality)
+		require.Equal(t, int64(10), cumulative.DataPoints[0].GetAsInt())
+
+		delta := metrics[2].GetSum()
+		require.NotNil(t, delta)
+		require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, delta.AggregationTemporality)
+	})
+
+	t.Run("non host-specific datapoints", func(t *testing.T) {
+		require.Len(t, rms[1].Resource.Attributes, 0)
+		metrics := rms[1].ScopeMetrics[0].Metrics
+		require.Len(t, metrics, 1)
+		require.Equal(t, map[string]string{"cluster": "a"}, attrMap(metrics[0].GetGauge().DataPoints[0].Attributes))
+	})
+}
+
+func TestConvertExemplars(t *testing.T) {
+	ts := time.Unix(1000, 0)
+	dp := datapoint.New("requests_total", nil, datapoint.NewFloatValue(10), datapoint.Counter, ts)
+	dp.Meta[dpmeta.ExemplarMeta] = &dpmeta.Exemplar{
+		TraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:    "00f067aa0ba902b7",
+		Value:     0.5,
+		Timestamp: ts,
+		Labels:    map[string]string{"path": "/"},
+	}
+
+	rms, _ := convertDatapoints([]*datapoint.Datapoint{dp}, nil)
+	exemplars := rms[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints[0].Exemplars
+	require.Len(t, exemplars, 1)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(exemplars[0].TraceId))
+	require.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(exemplars[0].SpanId))
+	require.Equal(t, 0.5, exemplars[0].GetAsDouble())
+	require.Equal(t, uint64(ts.UnixNano()), exemplars[0].TimeUnixNano)
+	require.Equal(t, map[string]string{"path": "/"}, attrMap(exemplars[0].FilteredAttributes))
+}
+
+func TestConvertSpans(t *testing.T) {
+	rss := convertSpans([]*trace.Span{
+		{
+			TraceID:        "abcdef0123456789",
+			ID:             "0123456789abcdef",
+			ParentID:       pointer.String("1111111111111111"),
+			Name:           pointer.String("get"),
+			Kind:           pointer.String("SERVER"),
+			Timestamp:      pointer.Int64(1000),
+			Duration:       pointer.Int64(500),
+			LocalEndpoint:  &trace.Endpoint{ServiceName: pointer.String("api")},
+			RemoteEndpoint: &trace.Endpoint{Ipv4: pointer.String("10.0.0.1"), Port: pointer.Int32(80)},
+			Annotations:    []*trace.Annotation{{Timestamp: pointer.Int64(1200), Value: pointer.String("retry")}},
+			Tags:           map[string]string{"host": "myhost", "error": "true"},
+		},
+	}, map[string]string{"host": "myhost"})
+
+	require.Len(t, rss, 1)
+	require.Equal(t, map[string]string{"host": "myhost", "service.name": "api"}, attrMap(rss[0].Resource.Attributes))
+
+	span := rss[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67, 0x89}, span.TraceId)
+	require.Len(t, span.SpanId, 8)
+	require.Len(t, span.ParentSpanId, 8)
+	require.Equal(t, "get", span.Name)
+	require.Equal(t, tracepb.Span_SPAN_KIND_SERVER, span.Kind)
+	require.Equal(t, uint64(1000000), span.StartTimeUnixNano)
+	require.Equal(t, uint64(1500000), span.EndTimeUnixNano)
+	require.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	require.Equal(t, map[string]string{"error": "true", "net.peer.ip": "10.0.0.1", "net.peer.port": "80"}, attrMap(span.Attributes))
+	require.Equal(t, "retry", span.Events[0].Name)
+}
+
+func TestHTTPOutput(t *testing.T) {
+	metricReqs := make(chan *colmetricspb.ExportMetricsServiceRequest, 10)
+	traceReqs := make(chan *coltracepb.ExportTraceServiceRequest, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.Nil(t, err)
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		switch r.URL.Path {
+		case "/v1/metrics":
+			req := &colmetricspb.ExportMetricsServiceRequest{}
+			require.Nil(t, proto.Unmarshal(body, req))
+			metricReqs <- req
+		case "/v1/traces":
+			req := &coltracepb.ExportTraceServiceRequest{}
+			require.Nil(t, proto.Unmarshal(body, req))
+			traceReqs <- req
+		default:
+			rw.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	dpChan := make(chan []*datapoint.Datapoint, 10)
+	spanChan := make(chan []*trace.Span, 10)
+
+	w, err := writer.New(&config.WriterConfig{
+		DatapointMaxBatchSize: 10,
+		TraceSpanMaxBatchSize: 10,
+		MaxRequests:           1,
+		MaxDatapointsBuffered: 100,
+		MaxTraceSpansInFlight: 100,
+		Outputs: []config.OutputConfig{{
+			Type: outputType,
+			OtherConfig: map[string]interface{}{
+				"protocol": "http",
+				"endpoint": server.URL,
+			},
+		}},
+	}, dpChan, make(chan *event.Event), nil, spanChan, nil)
+	require.Nil(t, err)
+
+	w.Start()
+	defer w.Shutdown()
+
+	dpChan <- []*datapoint.Datapoint{datapoint.New("test", map[string]string{"a": "b"}, datapoint.NewIntValue(5), datapoint.Gauge, time.Now())}
+	spanChan <- []*trace.Span{{TraceID: "1", ID: "2", Name: pointer.String("op"), Tags: map[string]string{}}}
+
+	select {
+	case req := <-metricReqs:
+		metric := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+		require.Equal(t, "test", metric.Name)
+		require.Equal(t, int64(5), metric.GetGauge().DataPoints[0].GetAsInt())
+	case <-time.After(5 * time.Second):
+		t.Fatal("Metrics were not received")
+	}
+
+	select {
+	case req := <-traceReqs:
+		span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+		require.Equal(t, "op", span.Name)
+		require.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 2}, span.SpanId)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Spans were not received")
+	}
+}
+
+func TestInvalidProtocol(t *testing.T) {
+	_, err := writer.New(&config.WriterConfig{
+		Outputs: []config.OutputConfig{{
+			Type: outputType,
+			OtherConfig: map[string]interface{}{
+				"protocol": "udp",
+				"endpoint": "localhost:4317",
+			},
+		}},
+	}, nil, nil, nil, nil, nil)
+	require.NotNil(t, err)
+}
@@ -0,0 +1,128 @@
+package writer
+
+import (
+	"fmt"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/trace"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/config/validation"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/tap"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/tracetracker"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// Output is what all writer outputs must implement.  Outputs receive data on
+// the channels given to them in OutputParams and should not start reading
+// from them until Start is called.  Shutdown must be safe to call even if
+// Start never was, since the writer shuts down the outputs it has already
+// created if a later one fails to be created.
+type Output interface {
+	Start()
+	Shutdown()
+	InternalMetrics() []*datapoint.Datapoint
+}
+
+// DiagnosticOutput can be implemented by outputs that want to contribute to
+// the writer section of the status output.
+type DiagnosticOutput interface {
+	DiagnosticText() string
+}
+
+// TappableOutput can be implemented by outputs that support a datapoint tap.
+type TappableOutput interface {
+	SetTap(*tap.DatapointTap)
+}
+
+// DimensionOutput should be implemented by outputs that consume dimension
+// property updates.  Other outputs will not receive anything on their
+// dimension channel.
+type DimensionOutput interface {
+	AcceptsDimensionUpdates() bool
+}
+
+// OutputParams are given to output factories when creating an output.
+type OutputParams struct {
+	// A copy of the writer config with any per-output overrides already
+	// applied.
+	WriterConfig *config.WriterConfig
+	// The generic config of the output
+	OutputConfig *config.OutputConfig
+	// The output-specific config, which will be a pointer to the same type
+	// as the config template given to RegisterOutput.
+	Config interface{}
+
+	DPs        chan []*datapoint.Datapoint
+	Events     chan *event.Event
+	Dimensions chan *types.Dimension
+	Spans      chan []*trace.Span
+
+	SpanSourceTracker *tracetracker.SpanSourceTracker
+}
+
+// OutputFactory creates a new output, which should not start doing anything
+// until Start is called on it.
+type OutputFactory func(*OutputParams) (Output, error)
+
+var outputFactories = map[string]OutputFactory{}
+
+// OutputConfigTemplates are blank (zero-value) instances of the
+// output-specific configuration struct for a particular output type.
+var OutputConfigTemplates = map[string]interface{}{}
+
+// RegisterOutput makes a new output type available to the writer.  This is
+// intended to be called from the init function of the package of a specific
+// output.  configTemplate should be a zero-valued struct that holds the
+// output-specific config, i.e. everything except the fields in
+// config.OutputConfig.
+func RegisterOutput(_type string, factory OutputFactory, configTemplate interface{}) {
+	if _, ok := outputFactories[_type]; ok {
+		panic("Writer output type '" + _type + "' already registered")
+	}
+	outputFactories[_type] = factory
+	OutputConfigTemplates[_type] = configTemplate
+}
+
+// Decodes the output specific config into a clone of the registered template
+// for the output type and validates it.
+func decodeOutputConfig(outputConf *config.OutputConfig) (interface{}, error) {
+	if _, ok := outputFactories[outputConf.Type]; !ok {
+		return nil, fmt.Errorf("writer output type '%s' is not supported", outputConf.Type)
+	}
+
+	conf := utils.CloneInterface(OutputConfigTemplates[outputConf.Type])
+	if err := config.DecodeExtraConfigStrict(outputConf, conf); err != nil {
+		return nil, fmt.Errorf("config for writer output '%s' is invalid: %v", outputConf.OutputName(), err)
+	}
+
+	if err := validation.ValidateStruct(conf); err != nil {
+		return nil, fmt.Errorf("config for writer output '%s' is invalid: %v", outputConf.OutputName(), err)
+	}
+
+	if err := validation.ValidateCustomConfig(conf); err != nil {
+		return nil, fmt.Errorf("config for writer output '%s' is invalid: %v", outputConf.OutputName(), err)
+	}
+	return conf, nil
+}
+
+// ValidateOutputConfig checks the output specific config of the given output
+// without creating the output.
+func ValidateOutputConfig(outputConf *config.OutputConfig) error {
+	_, err := decodeOutputConfig(outputConf)
+	return err
+}
+
+func newOutput(outputConf *config.OutputConfig, params *OutputParams) (Output, error) {
+	conf, err := decodeOutputConfig(outputConf)
+	if err != nil {
+		return nil, err
+	}
+
+	params.OutputConfig = outputConf
+	params.Config = conf
+
+	return outputFactories[outputConf.Type](params)
+}
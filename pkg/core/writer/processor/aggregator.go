@@ -0,0 +1,334 @@
+package processor
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// Aggregator rolls up datapoints into fewer time series according to a set
+// of aggregation rules.  Datapoints that match a rule are held back and the
+// aggregated datapoints are emitted once per the rule's interval.
+type Aggregator struct {
+	sync.Mutex
+	rules []*aggregationRule
+
+	dpsAggregated int64
+	dpsEmitted    int64
+}
+
+type aggregationRule struct {
+	conf     *config.AggregationConfig
+	filter   dpfilters.DatapointFilter
+	groupBy  map[string]bool
+	dropDims map[string]bool
+
+	// Keyed by the metric name and the dimensions left after aggregation
+	groups map[string]*aggregationGroup
+}
+
+// How many intervals a series that isn't updated keeps contributing its last
+// value to its group before it is forgotten.  This keeps aggregates of
+// cumulative values from dipping when a series misses an interval.
+const seriesExpiryIntervals = 5
+
+type aggregationGroup struct {
+	metric     string
+	metricType datapoint.MetricType
+	dims       map[string]string
+	meta       map[interface{}]interface{}
+	// The original series in the group, keyed by their full dimension set
+	series map[string]*aggregatedSeries
+	// Whether any series was updated since the last flush
+	updated bool
+}
+
+type aggregatedSeries struct {
+	value datapoint.Value
+	// The number of flushes since the series was last updated
+	missedIntervals int
+}
+
+// NewAggregator creates an aggregator from the given config.  The configs
+// should already be validated.
+func NewAggregator(confs []config.AggregationConfig) (*Aggregator, error) {
+	a := &Aggregator{}
+	for i := range confs {
+		conf := &confs[i]
+		filter, err := conf.Filter()
+		if err != nil {
+			return nil, err
+		}
+		a.rules = append(a.rules, &aggregationRule{
+			conf:     conf,
+			filter:   filter,
+			groupBy:  utils.StringSliceToMap(conf.GroupBy),
+			dropDims: utils.StringSliceToMap(conf.DropDimensions),
+			groups:   map[string]*aggregationGroup{},
+		})
+	}
+	return a, nil
+}
+
+// Process takes the datapoints that match any of the aggregation rules out of
+// dps and returns the rest, which should be sent as usual.  dps is modified
+// in place.
+func (a *Aggregator) Process(dps []*datapoint.Datapoint) []*datapoint.Datapoint {
+	if len(a.rules) == 0 {
+		return dps
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	n := 0
+	for _, dp := range dps {
+		if a.aggregate(dp) {
+			a.dpsAggregated++
+			continue
+		}
+		dps[n] = dp
+		n++
+	}
+	return dps[:n]
+}
+
+func (a *Aggregator) aggregate(dp *datapoint.Datapoint) bool {
+	for _, r := range a.rules {
+		if !r.filter.Matches(dp) {
+			continue
+		}
+
+		dims := r.aggregatedDims(dp.Dimensions)
+		key := dp.Metric + "|" + dimsKey(dims)
+		g := r.groups[key]
+		if g == nil {
+			g = &aggregationGroup{
+				metric:     dp.Metric,
+				metricType: dp.MetricType,
+				dims:       dims,
+				series:     map[string]*aggregatedSeries{},
+			}
+			r.groups[key] = g
+		}
+		g.meta = dp.Meta
+		g.updated = true
+
+		seriesKey := dimsKey(dp.Dimensions)
+		if prev, ok := g.series[seriesKey]; ok && dp.MetricType == datapoint.Count {
+			// Delta counters are only meaningful for the interval they were
+			// sent for, so add up all of them within the aggregation interval.
+			prev.value = addValues(prev.value, dp.Value)
+		} else {
+			g.series[seriesKey] = &aggregatedSeries{value: dp.Value}
+		}
+		return true
+	}
+	return false
+}
+
+func (r *aggregationRule) aggregatedDims(dims map[string]string) map[string]string {
+	out := make(map[string]string, len(dims))
+	for k, v := range dims {
+		if len(r.groupBy) > 0 && !r.groupBy[k] {
+			continue
+		}
+		if r.dropDims[k] {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func dimsKey(dims map[string]string) string {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(dims[k])
+		sb.WriteByte(',')
+	}
+	return sb.String()
+}
+
+func addValues(a, b datapoint.Value) datapoint.Value {
+	ai, aIsInt := a.(datapoint.IntValue)
+	bi, bIsInt := b.(datapoint.IntValue)
+	if aIsInt && bIsInt {
+		return datapoint.NewIntValue(ai.Int() + bi.Int())
+	}
+	af, aOK := floatValue(a)
+	bf, bOK := floatValue(b)
+	if !aOK || !bOK {
+		return b
+	}
+	return datapoint.NewFloatValue(af + bf)
+}
+
+func floatValue(v datapoint.Value) (float64, bool) {
+	switch n := v.(type) {
+	case datapoint.IntValue:
+		return float64(n.Int()), true
+	case datapoint.FloatValue:
+		return n.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// flush computes the aggregated datapoints of a rule for the groups that
+// were updated in the last interval.  Series that weren't updated keep their
+// last value until they expire, except for delta counters, which are reset
+// every interval.
+func (a *Aggregator) flush(r *aggregationRule, now time.Time) []*datapoint.Datapoint {
+	a.Lock()
+	defer a.Unlock()
+
+	out := make([]*datapoint.Datapoint, 0, len(r.groups))
+	for key, g := range r.groups {
+		val, ok := g.aggregate(r.conf.Function)
+		g.expireSeries()
+		if len(g.series) == 0 {
+			delete(r.groups, key)
+		}
+		if !ok {
+			continue
+		}
+
+		metricType := g.metricType
+		if r.conf.Function != config.AggregationSum {
+			metricType = datapoint.Gauge
+		}
+
+		dp := datapoint.New(g.metric, g.dims, val, metricType, now)
+		dp.Meta = g.meta
+		out = append(out, dp)
+	}
+
+	a.dpsEmitted += int64(len(out))
+
+	return out
+}
+
+func (g *aggregationGroup) aggregate(function string) (datapoint.Value, bool) {
+	if !g.updated {
+		return nil, false
+	}
+	g.updated = false
+
+	values := make([]datapoint.Value, 0, len(g.series))
+	for _, s := range g.series {
+		values = append(values, s.value)
+	}
+	return aggregateValues(function, values)
+}
+
+func (g *aggregationGroup) expireSeries() {
+	for key, s := range g.series {
+		s.missedIntervals++
+		if g.metricType == datapoint.Count || s.missedIntervals > seriesExpiryIntervals {
+			delete(g.series, key)
+		}
+	}
+}
+
+func aggregateValues(function string, series []datapoint.Value) (datapoint.Value, bool) {
+	if function == config.AggregationCount {
+		return datapoint.NewIntValue(int64(len(series))), true
+	}
+
+	allInts := true
+	var intTotal, intMax, intMin int64 = 0, math.MinInt64, math.MaxInt64
+	var floatTotal, floatMax, floatMin float64 = 0, math.Inf(-1), math.Inf(1)
+	count := 0
+
+	for _, v := range series {
+		f, ok := floatValue(v)
+		if !ok {
+			continue
+		}
+		count++
+		floatTotal += f
+		floatMax = math.Max(floatMax, f)
+		floatMin = math.Min(floatMin, f)
+
+		if iv, ok := v.(datapoint.IntValue); ok {
+			i := iv.Int()
+			intTotal += i
+			if i > intMax {
+				intMax = i
+			}
+			if i < intMin {
+				intMin = i
+			}
+		} else {
+			allInts = false
+		}
+	}
+
+	if count == 0 {
+		return nil, false
+	}
+
+	switch function {
+	case config.AggregationSum:
+		if allInts {
+			return datapoint.NewIntValue(intTotal), true
+		}
+		return datapoint.NewFloatValue(floatTotal), true
+	case config.AggregationMax:
+		if allInts {
+			return datapoint.NewIntValue(intMax), true
+		}
+		return datapoint.NewFloatValue(floatMax), true
+	case config.AggregationMin:
+		if allInts {
+			return datapoint.NewIntValue(intMin), true
+		}
+		return datapoint.NewFloatValue(floatMin), true
+	case config.AggregationAvg:
+		return datapoint.NewFloatValue(floatTotal / float64(count)), true
+	}
+	return nil, false
+}
+
+// Run flushes the aggregated datapoints of each rule on its interval and
+// passes them to send until ctx is cancelled.
+func (a *Aggregator) Run(ctx context.Context, send func([]*datapoint.Datapoint)) {
+	for i := range a.rules {
+		r := a.rules[i]
+		utils.RunOnInterval(ctx, func() {
+			if dps := a.flush(r, time.Now()); len(dps) > 0 {
+				send(dps)
+			}
+		}, r.conf.IntervalOrDefault())
+	}
+}
+
+// InternalMetrics returns metrics about how many datapoints have been
+// aggregated.
+func (a *Aggregator) InternalMetrics() []*datapoint.Datapoint {
+	a.Lock()
+	defer a.Unlock()
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("sfxagent.datapoints_aggregated", nil, a.dpsAggregated),
+		sfxclient.Cumulative("sfxagent.datapoints_emitted_by_aggregation", nil, a.dpsEmitted),
+	}
+}
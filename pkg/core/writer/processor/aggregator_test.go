@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+)
+
+func TestAggregator(t *testing.T) {
+	a, err := NewAggregator([]config.AggregationConfig{
+		{
+			MetricNames:    []string{"container_cpu_*"},
+			DropDimensions: []string{"container_id"},
+			Function:       config.AggregationSum,
+		},
+		{
+			MetricNames: []string{"container_memory_usage_bytes"},
+			GroupBy:     []string{"kubernetes_pod_name"},
+			Function:    config.AggregationMax,
+		},
+		{
+			MetricNames: []string{"requests"},
+			GroupBy:     []string{"service"},
+			Function:    config.AggregationAvg,
+		},
+	})
+	require.Nil(t, err)
+
+	now := time.Now()
+	dp := func(metric string, dims map[string]string, val datapoint.Value, mt datapoint.MetricType) *datapoint.Datapoint {
+		return datapoint.New(metric, dims, val, mt, now)
+	}
+
+	rest := a.Process([]*datapoint.Datapoint{
+		dp("container_cpu_usage", map[string]string{"container_id": "a", "kubernetes_pod_name": "p1"}, datapoint.NewIntValue(10), datapoint.Counter),
+		dp("container_cpu_usage", map[string]string{"container_id": "b", "kubernetes_pod_name": "p1"}, datapoint.NewIntValue(5), datapoint.Counter),
+		dp("container_cpu_usage", map[string]string{"container_id": "c", "kubernetes_pod_name": "p2"}, datapoint.NewIntValue(1), datapoint.Counter),
+		// A later value of the same series replaces the earlier one
+		dp("container_cpu_usage", map[string]string{"container_id": "a", "kubernetes_pod_name": "p1"}, datapoint.NewIntValue(12), datapoint.Counter),
+		dp("container_memory_usage_bytes", map[string]string{"container_id": "a", "kubernetes_pod_name": "p1", "image": "x"}, datapoint.NewIntValue(100), datapoint.Gauge),
+		dp("container_memory_usage_bytes", map[string]string{"container_id": "b", "kubernetes_pod_name": "p1", "image": "y"}, datapoint.NewIntValue(300), datapoint.Gauge),
+		// Delta counters are summed within the interval
+		dp("requests", map[string]string{"service": "api", "instance": "1"}, datapoint.NewIntValue(2), datapoint.Count),
+		dp("requests", map[string]string{"service": "api", "instance": "1"}, datapoint.NewIntValue(4), datapoint.Count),
+		dp("requests", map[string]string{"service": "api", "instance": "2"}, datapoint.NewIntValue(3), datapoint.Count),
+		dp("other", map[string]string{"container_id": "a"}, datapoint.NewIntValue(1), datapoint.Gauge),
+	})
+
+	require.Len(t, rest, 1)
+	require.Equal(t, "other", rest[0].Metric)
+
+	findDP := func(dps []*datapoint.Datapoint, metric string, dims map[string]string) *datapoint.Datapoint {
+		for _, dp := range dps {
+			if dp.Metric == metric && len(dp.Dimensions) == len(dims) {
+				match := true
+				for k, v := range dims {
+					if dp.Dimensions[k] != v {
+						match = false
+					}
+				}
+				if match {
+					return dp
+				}
+			}
+		}
+		t.Fatalf("No datapoint %s %v in %v", metric, dims, dps)
+		return nil
+	}
+
+	t.Run("sum drops dimensions", func(t *testing.T) {
+		dps := a.flush(a.rules[0], now)
+		require.Len(t, dps, 2)
+
+		p1 := findDP(dps, "container_cpu_usage", map[string]string{"kubernetes_pod_name": "p1"})
+		require.Equal(t, int64(17), p1.Value.(datapoint.IntValue).Int())
+		require.Equal(t, datapoint.Counter, p1.MetricType)
+
+		p2 := findDP(dps, "container_cpu_usage", map[string]string{"kubernetes_pod_name": "p2"})
+		require.Equal(t, int64(1), p2.Value.(datapoint.IntValue).Int())
+	})
+
+	t.Run("max keeps group by dimensions", func(t *testing.T) {
+		dps := a.flush(a.rules[1], now)
+		require.Len(t, dps, 1)
+		mem := findDP(dps, "container_memory_usage_bytes", map[string]string{"kubernetes_pod_name": "p1"})
+		require.Equal(t, int64(300), mem.Value.(datapoint.IntValue).Int())
+		require.Equal(t, datapoint.Gauge, mem.MetricType)
+	})
+
+	t.Run("avg of delta counters", func(t *testing.T) {
+		dps := a.flush(a.rules[2], now)
+		require.Len(t, dps, 1)
+		req := findDP(dps, "requests", map[string]string{"service": "api"})
+		require.Equal(t, 4.5, req.Value.(datapoint.FloatValue).Float())
+	})
+
+	t.Run("nothing is sent without new datapoints", func(t *testing.T) {
+		require.Len(t, a.flush(a.rules[0], now), 0)
+	})
+
+	t.Run("missing series keep their last value until they expire", func(t *testing.T) {
+		for i := 0; i < seriesExpiryIntervals; i++ {
+			a.Process([]*datapoint.Datapoint{
+				dp("container_cpu_usage", map[string]string{"container_id": "a", "kubernetes_pod_name": "p1"}, datapoint.NewIntValue(int64(20+i)), datapoint.Counter),
+			})
+			dps := a.flush(a.rules[0], now)
+			require.Len(t, dps, 1)
+			p1 := findDP(dps, "container_cpu_usage", map[string]string{"kubernetes_pod_name": "p1"})
+			if i < seriesExpiryIntervals-1 {
+				// b was last seen with a value of 5
+				require.Equal(t, int64(25+i), p1.Value.(datapoint.IntValue).Int())
+			} else {
+				require.Equal(t, int64(20+i), p1.Value.(datapoint.IntValue).Int())
+			}
+		}
+	})
+
+	t.Run("delta counters are reset after flushing", func(t *testing.T) {
+		a.Process([]*datapoint.Datapoint{
+			dp("requests", map[string]string{"service": "api", "instance": "1"}, datapoint.NewIntValue(8), datapoint.Count),
+		})
+		dps := a.flush(a.rules[2], now)
+		require.Len(t, dps, 1)
+		req := findDP(dps, "requests", map[string]string{"service": "api"})
+		require.Equal(t, 8.0, req.Value.(datapoint.FloatValue).Float())
+	})
+}
+
+func TestAggregationConfigValidation(t *testing.T) {
+	require.NotNil(t, (&config.AggregationConfig{MetricNames: []string{"a"}, Function: "sum"}).Validate())
+	require.NotNil(t, (&config.AggregationConfig{MetricNames: []string{"a"}, GroupBy: []string{"x"}, Function: "median"}).Validate())
+	require.NotNil(t, (&config.AggregationConfig{MetricNames: []string{"a"}, GroupBy: []string{"x"}, DropDimensions: []string{"y"}, Function: "sum"}).Validate())
+	require.Nil(t, (&config.AggregationConfig{MetricNames: []string{"a"}, GroupBy: []string{"x"}, Function: "sum"}).Validate())
+}
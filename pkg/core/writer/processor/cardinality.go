@@ -0,0 +1,207 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// CardinalityLimitEventType is the type of the event that is sent when a
+// monitor first goes over the time series limit.
+const CardinalityLimitEventType = "signalfx-agent.time-series-limit-exceeded"
+
+// CardinalityLimiter keeps track of the distinct time series sent by each
+// monitor and drops datapoints for new time series once a monitor has
+// reached its limit.
+type CardinalityLimiter struct {
+	sync.Mutex
+	maxSeries int
+	expiry    time.Duration
+
+	monitors map[types.MonitorID]*monitorSeries
+}
+
+type monitorSeries struct {
+	monitorType string
+	// When each time series was last seen, keyed by a hash of the metric name
+	// and dimensions
+	lastSeen map[uint64]time.Time
+	dropped  int64
+	// Whether the limit has been hit since the monitor was last under it, so
+	// that only one event is sent per incident
+	overLimit bool
+}
+
+// NewCardinalityLimiter creates a limiter that allows each monitor to send at
+// most maxSeries distinct time series.  Series that aren't seen for expiry
+// stop counting towards the limit.  If maxSeries is 0, nothing is limited.
+func NewCardinalityLimiter(maxSeries int, expiry time.Duration) *CardinalityLimiter {
+	return &CardinalityLimiter{
+		maxSeries: maxSeries,
+		expiry:    expiry,
+		monitors:  map[types.MonitorID]*monitorSeries{},
+	}
+}
+
+func seriesHash(dp *datapoint.Datapoint) uint64 {
+	keys := make([]string, 0, len(dp.Dimensions))
+	for k := range dp.Dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(dp.Metric))
+	for _, k := range keys {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(dp.Dimensions[k]))
+	}
+	return h.Sum64()
+}
+
+func monitorIDOf(dp *datapoint.Datapoint) (types.MonitorID, string) {
+	var monitorID types.MonitorID
+	switch id := dp.Meta[dpmeta.MonitorIDMeta].(type) {
+	case types.MonitorID:
+		monitorID = id
+	case string:
+		monitorID = types.MonitorID(id)
+	}
+	monitorType, _ := dp.Meta[dpmeta.MonitorTypeMeta].(string)
+	return monitorID, monitorType
+}
+
+// Process removes datapoints for new time series from monitors that are over
+// their limit and returns the rest.  dps is modified in place.  An event is
+// returned for each monitor that just went over its limit.
+func (cl *CardinalityLimiter) Process(dps []*datapoint.Datapoint) ([]*datapoint.Datapoint, []*event.Event) {
+	if cl.maxSeries <= 0 {
+		return dps, nil
+	}
+
+	cl.Lock()
+	defer cl.Unlock()
+
+	var events []*event.Event
+	now := time.Now()
+
+	n := 0
+	for _, dp := range dps {
+		monitorID, monitorType := monitorIDOf(dp)
+		// Datapoints that don't come from a monitor (e.g. the agent's own
+		// internal metrics) aren't limited.
+		if monitorID == "" {
+			dps[n] = dp
+			n++
+			continue
+		}
+
+		ms := cl.monitors[monitorID]
+		if ms == nil {
+			ms = &monitorSeries{
+				monitorType: monitorType,
+				lastSeen:    map[uint64]time.Time{},
+			}
+			cl.monitors[monitorID] = ms
+		}
+
+		hash := seriesHash(dp)
+		if _, ok := ms.lastSeen[hash]; !ok && len(ms.lastSeen) >= cl.maxSeries {
+			ms.dropped++
+			if !ms.overLimit {
+				ms.overLimit = true
+				events = append(events, cl.limitEvent(monitorID, ms))
+			}
+			continue
+		}
+		ms.lastSeen[hash] = now
+
+		dps[n] = dp
+		n++
+	}
+	return dps[:n], events
+}
+
+func (cl *CardinalityLimiter) limitEvent(monitorID types.MonitorID, ms *monitorSeries) *event.Event {
+	return event.NewWithProperties(
+		CardinalityLimitEventType,
+		event.AGENT,
+		map[string]string{
+			"monitor_id":   string(monitorID),
+			"monitor_type": ms.monitorType,
+		},
+		map[string]interface{}{
+			"limit": cl.maxSeries,
+			"message": fmt.Sprintf("Monitor %s (type %s) has reached the limit of %d time series, datapoints for new time series from it will be dropped",
+				monitorID, ms.monitorType, cl.maxSeries),
+		},
+		time.Now())
+}
+
+// expire forgets time series that haven't been seen within the expiry
+// duration so that they no longer count towards the limit.
+func (cl *CardinalityLimiter) expire(now time.Time) {
+	cl.Lock()
+	defer cl.Unlock()
+
+	for monitorID, ms := range cl.monitors {
+		for hash, lastSeen := range ms.lastSeen {
+			if now.Sub(lastSeen) > cl.expiry {
+				delete(ms.lastSeen, hash)
+			}
+		}
+		if len(ms.lastSeen) < cl.maxSeries {
+			ms.overLimit = false
+		}
+		if len(ms.lastSeen) == 0 && ms.dropped == 0 {
+			delete(cl.monitors, monitorID)
+		}
+	}
+}
+
+// Run expires old time series periodically until ctx is cancelled.
+func (cl *CardinalityLimiter) Run(ctx context.Context) {
+	if cl.maxSeries <= 0 {
+		return
+	}
+
+	interval := cl.expiry / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	utils.RunOnInterval(ctx, func() {
+		cl.expire(time.Now())
+	}, interval)
+}
+
+// InternalMetrics returns the number of time series and dropped datapoints
+// for each monitor that is being limited.
+func (cl *CardinalityLimiter) InternalMetrics() []*datapoint.Datapoint {
+	cl.Lock()
+	defer cl.Unlock()
+
+	var dps []*datapoint.Datapoint
+	for monitorID, ms := range cl.monitors {
+		dims := map[string]string{
+			"monitor_id":   string(monitorID),
+			"monitor_type": ms.monitorType,
+		}
+		dps = append(dps,
+			sfxclient.Gauge("sfxagent.monitor_time_series", dims, int64(len(ms.lastSeen))),
+			sfxclient.Cumulative("sfxagent.monitor_datapoints_dropped_by_time_series_limit", dims, ms.dropped))
+	}
+	return dps
+}
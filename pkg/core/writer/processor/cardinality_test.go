@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+)
+
+func monitorDP(monitorID string, metric string, dims map[string]string) *datapoint.Datapoint {
+	dp := datapoint.New(metric, dims, datapoint.NewIntValue(1), datapoint.Gauge, time.Now())
+	if monitorID != "" {
+		dp.Meta = map[interface{}]interface{}{
+			dpmeta.MonitorIDMeta:   types.MonitorID(monitorID),
+			dpmeta.MonitorTypeMeta: "prometheus-exporter",
+		}
+	}
+	return dp
+}
+
+func TestCardinalityLimiter(t *testing.T) {
+	cl := NewCardinalityLimiter(3, time.Minute)
+
+	var dps []*datapoint.Datapoint
+	for i := 0; i < 5; i++ {
+		dps = append(dps, monitorDP("a", "requests", map[string]string{"path": fmt.Sprintf("/%d", i)}))
+	}
+	dps = append(dps, monitorDP("b", "requests", nil), monitorDP("", "internal", nil))
+
+	out, events := cl.Process(dps)
+	require.Len(t, out, 5)
+	require.Len(t, events, 1)
+	require.Equal(t, CardinalityLimitEventType, events[0].EventType)
+	require.Equal(t, "a", events[0].Dimensions["monitor_id"])
+	require.Equal(t, "prometheus-exporter", events[0].Dimensions["monitor_type"])
+
+	t.Run("existing series are still sent", func(t *testing.T) {
+		out, events := cl.Process([]*datapoint.Datapoint{
+			monitorDP("a", "requests", map[string]string{"path": "/0"}),
+			monitorDP("a", "requests", map[string]string{"path": "/9"}),
+		})
+		require.Len(t, out, 1)
+		require.Equal(t, "/0", out[0].Dimensions["path"])
+		// Only one event per incident
+		require.Len(t, events, 0)
+	})
+
+	t.Run("internal metrics name the monitor", func(t *testing.T) {
+		var found bool
+		for _, dp := range cl.InternalMetrics() {
+			if dp.Metric == "sfxagent.monitor_datapoints_dropped_by_time_series_limit" && dp.Dimensions["monitor_id"] == "a" {
+				require.Equal(t, int64(3), dp.Value.(datapoint.IntValue).Int())
+				found = true
+			}
+		}
+		require.True(t, found)
+	})
+
+	t.Run("expired series stop counting", func(t *testing.T) {
+		cl.expire(time.Now().Add(2 * time.Minute))
+
+		out, events := cl.Process([]*datapoint.Datapoint{
+			monitorDP("a", "requests", map[string]string{"path": "/9"}),
+		})
+		require.Len(t, out, 1)
+		require.Len(t, events, 0)
+	})
+}
+
+func TestCardinalityLimiterDisabled(t *testing.T) {
+	cl := NewCardinalityLimiter(0, time.Minute)
+
+	out, events := cl.Process([]*datapoint.Datapoint{
+		monitorDP("a", "requests", map[string]string{"path": "/0"}),
+		monitorDP("a", "requests", map[string]string{"path": "/1"}),
+	})
+	require.Len(t, out, 2)
+	require.Len(t, events, 0)
+}
@@ -1,6 +1,8 @@
 package processor
 
 import (
+	"sort"
+
 	"github.com/signalfx/golib/v3/datapoint"
 	"github.com/signalfx/golib/v3/event"
 	"github.com/signalfx/golib/v3/trace"
@@ -16,22 +18,44 @@ type Processor struct {
 	addGlobalDimensionsAsSpanTags bool
 	hostIDDims                    map[string]string
 	datapointFilters              *dpfilters.FilterSet
+	// The following only apply to a single output
+	outputDatapointFilters   *dpfilters.FilterSet
+	outputExtraDims          map[string]string
+	dimensionTransformations map[string]string
+	// The original names in dimensionTransformations, sorted so that the
+	// transformations are applied in a fixed order
+	transformedDimNames []string
 }
 
 func New(conf *config.WriterConfig) *Processor {
 	datapointFilters, _ := conf.DatapointFilters()
 
-	return &Processor{
+	p := &Processor{
 		hostIDDims:                    conf.HostIDDims,
 		globalDims:                    conf.GlobalDimensions,
 		globalSpanTags:                conf.GlobalSpanTags,
 		addGlobalDimensionsAsSpanTags: conf.AddGlobalDimensionsAsSpanTags,
 		datapointFilters:              datapointFilters,
 	}
+
+	if conf.Output != nil {
+		p.outputDatapointFilters, _ = conf.Output.DatapointFilters()
+		p.outputExtraDims = conf.Output.ExtraDimensions
+		p.dimensionTransformations = conf.Output.DimensionTransformations
+		for name := range p.dimensionTransformations {
+			p.transformedDimNames = append(p.transformedDimNames, name)
+		}
+		sort.Strings(p.transformedDimNames)
+	}
+
+	return p
 }
 
 func (p *Processor) ShouldSendDatapoint(dp *datapoint.Datapoint) bool {
-	return p.datapointFilters == nil || !p.datapointFilters.Matches(dp)
+	if p.datapointFilters != nil && p.datapointFilters.Matches(dp) {
+		return false
+	}
+	return p.outputDatapointFilters == nil || !p.outputDatapointFilters.Matches(dp)
 }
 
 func (p *Processor) PreprocessDatapoint(dp *datapoint.Datapoint) bool {
@@ -47,6 +71,12 @@ func (p *Processor) PreprocessDatapoint(dp *datapoint.Datapoint) bool {
 		dp.Dimensions = p.addhostIDFields(dp.Dimensions)
 	}
 
+	for k, v := range p.outputExtraDims {
+		dp.Dimensions[k] = v
+	}
+
+	p.transformDimensions(dp.Dimensions)
+
 	return true
 }
 
@@ -124,6 +154,30 @@ func (p *Processor) addGlobalDims(dims map[string]string) map[string]string {
 	return dims
 }
 
+// Renames or removes dimensions in place according to the output's dimension
+// transformations.  The transformations all apply to the original dimensions,
+// so that renames can't feed into each other.
+func (p *Processor) transformDimensions(dims map[string]string) {
+	var renamed map[string]string
+	for _, origName := range p.transformedDimNames {
+		v, ok := dims[origName]
+		if !ok {
+			continue
+		}
+		delete(dims, origName)
+		// If the new name is not an empty string transform the dimension
+		if newName := p.dimensionTransformations[origName]; len(newName) > 0 {
+			if renamed == nil {
+				renamed = make(map[string]string)
+			}
+			renamed[newName] = v
+		}
+	}
+	for k, v := range renamed {
+		dims[k] = v
+	}
+}
+
 // Adds the host ids to the given map (e.g. dimensions/span tags), forcibly
 // overridding any existing fields of the same name.
 func (p *Processor) addhostIDFields(fields map[string]string) map[string]string {
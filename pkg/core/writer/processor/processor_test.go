@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+)
+
+func newDP(metric string, dims map[string]string) *datapoint.Datapoint {
+	return datapoint.New(metric, dims, datapoint.NewIntValue(1), datapoint.Gauge, time.Now())
+}
+
+func TestOutputSpecificProcessing(t *testing.T) {
+	wc := &config.WriterConfig{
+		HostIDDims:       map[string]string{"host": "myhost"},
+		MetricsToExclude: []config.MetricFilter{{MetricName: "globally.excluded"}},
+	}
+
+	p := New(wc.ForOutput(&config.OutputConfig{
+		Type: "splunk",
+		MetricsToExclude: []config.MetricFilter{
+			{MetricNames: []string{"cpu.*", "memory.used"}, Negated: true},
+		},
+		MetricsToInclude: []config.MetricFilter{{MetricName: "disk.ops"}},
+		ExtraDimensions:  map[string]string{"env": "prod"},
+		DimensionTransformations: map[string]string{
+			"host":         "hostname",
+			"container_id": "",
+		},
+	}))
+
+	t.Run("global filters still apply", func(t *testing.T) {
+		require.False(t, p.PreprocessDatapoint(newDP("globally.excluded", nil)))
+	})
+
+	t.Run("only the output's metrics are sent", func(t *testing.T) {
+		require.True(t, p.PreprocessDatapoint(newDP("cpu.utilization", nil)))
+		require.True(t, p.PreprocessDatapoint(newDP("memory.used", nil)))
+		require.True(t, p.PreprocessDatapoint(newDP("disk.ops", nil)))
+		require.False(t, p.PreprocessDatapoint(newDP("memory.free", nil)))
+	})
+
+	t.Run("dimensions are rewritten", func(t *testing.T) {
+		dp := newDP("cpu.utilization", map[string]string{"container_id": "abc", "plugin": "cpu"})
+		require.True(t, p.PreprocessDatapoint(dp))
+		require.Equal(t, map[string]string{
+			"hostname": "myhost",
+			"env":      "prod",
+			"plugin":   "cpu",
+		}, dp.Dimensions)
+	})
+
+	t.Run("renames apply to the original dimensions", func(t *testing.T) {
+		p := New(wc.ForOutput(&config.OutputConfig{
+			Type: "signalfx",
+			DimensionTransformations: map[string]string{
+				"a":    "b",
+				"b":    "a",
+				"c":    "d",
+				"d":    "e",
+				"x":    "same",
+				"y":    "same",
+				"host": "",
+			},
+		}))
+
+		for i := 0; i < 20; i++ {
+			dp := newDP("cpu.utilization", map[string]string{"a": "1", "b": "2", "c": "3", "d": "4", "x": "5", "y": "6"})
+			require.True(t, p.PreprocessDatapoint(dp))
+			require.Equal(t, map[string]string{
+				"a":    "2",
+				"b":    "1",
+				"d":    "3",
+				"e":    "4",
+				"same": "6",
+			}, dp.Dimensions)
+		}
+	})
+
+	t.Run("other outputs are unaffected", func(t *testing.T) {
+		p := New(wc.ForOutput(&config.OutputConfig{Type: "signalfx"}))
+
+		dp := newDP("memory.free", map[string]string{"container_id": "abc"})
+		require.True(t, p.PreprocessDatapoint(dp))
+		require.Equal(t, map[string]string{"host": "myhost", "container_id": "abc"}, dp.Dimensions)
+	})
+}
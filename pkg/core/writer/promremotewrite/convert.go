@@ -0,0 +1,196 @@
+package promremotewrite
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/promexport"
+)
+
+// Field numbers and enum values from the Prometheus remote write protocol
+// (prometheus/prompb/remote.proto and types.proto).  The messages are simple
+// enough that we encode them by hand instead of pulling in the whole
+// Prometheus module.
+const (
+	writeRequestTimeseriesField = 1
+	writeRequestMetadataField   = 3
+
+	timeSeriesLabelsField  = 1
+	timeSeriesSamplesField = 2
+
+	labelNameField  = 1
+	labelValueField = 2
+
+	sampleValueField     = 1
+	sampleTimestampField = 2
+
+	metadataTypeField       = 1
+	metadataFamilyNameField = 2
+
+	metricTypeCounter = 1
+	metricTypeGauge   = 2
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type timeSeries struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+// numericValue returns the value of the datapoint as a float, or false if it
+// is not a numeric datapoint.
+func numericValue(dp *datapoint.Datapoint) (float64, bool) {
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		return float64(v.Int()), true
+	case datapoint.FloatValue:
+		return v.Float(), true
+	default:
+		return math.NaN(), false
+	}
+}
+
+// promMetricType maps the SignalFx metric type to the Prometheus metadata
+// type.  Prometheus has no notion of delta counters so those are sent as
+// gauges, which is how they should be interpreted anyway (i.e. the value is
+// only meaningful for the interval it was reported for).
+func promMetricType(mt datapoint.MetricType) int {
+	if mt == datapoint.Counter {
+		return metricTypeCounter
+	}
+	return metricTypeGauge
+}
+
+// convertDatapoint converts a datapoint to a remote write time series, or
+// returns false if the datapoint has no numeric value.
+func convertDatapoint(dp *datapoint.Datapoint) (*timeSeries, bool) {
+	val, ok := numericValue(dp)
+	if !ok {
+		return nil, false
+	}
+
+	labels := make([]label, 0, len(dp.Dimensions)+1)
+	labels = append(labels, label{name: "__name__", value: promexport.SanitizeMetricName(dp.Metric)})
+	for k, v := range dp.Dimensions {
+		if v == "" {
+			// Empty labels are the same as missing labels in Prometheus
+			continue
+		}
+		name := promexport.SanitizeLabelName(k)
+		if name == "__name__" {
+			// Don't let a dimension override the metric name
+			continue
+		}
+		labels = append(labels, label{name: name, value: v})
+	}
+	// Remote write receivers expect labels to be sorted by name.  Ties are
+	// broken by value so that the same label wins every time below.
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].name != labels[j].name {
+			return labels[i].name < labels[j].name
+		}
+		return labels[i].value < labels[j].value
+	})
+
+	// Different dimension names can end up the same after sanitization, and
+	// duplicate label names aren't allowed, so only keep one of them.
+	deduped := labels[:1]
+	for _, l := range labels[1:] {
+		if l.name != deduped[len(deduped)-1].name {
+			deduped = append(deduped, l)
+		}
+	}
+	labels = deduped
+
+	ts := dp.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	return &timeSeries{
+		labels:    labels,
+		value:     val,
+		timestamp: ts.UnixNano() / int64(time.Millisecond),
+	}, true
+}
+
+func appendLabel(b []byte, l label) []byte {
+	var lb []byte
+	lb = protowire.AppendTag(lb, labelNameField, protowire.BytesType)
+	lb = protowire.AppendString(lb, l.name)
+	lb = protowire.AppendTag(lb, labelValueField, protowire.BytesType)
+	lb = protowire.AppendString(lb, l.value)
+
+	b = protowire.AppendTag(b, timeSeriesLabelsField, protowire.BytesType)
+	return protowire.AppendBytes(b, lb)
+}
+
+func appendTimeSeries(b []byte, ts *timeSeries) []byte {
+	var tsb []byte
+	for _, l := range ts.labels {
+		tsb = appendLabel(tsb, l)
+	}
+
+	var sb []byte
+	sb = protowire.AppendTag(sb, sampleValueField, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(ts.value))
+	sb = protowire.AppendTag(sb, sampleTimestampField, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(ts.timestamp))
+
+	tsb = protowire.AppendTag(tsb, timeSeriesSamplesField, protowire.BytesType)
+	tsb = protowire.AppendBytes(tsb, sb)
+
+	b = protowire.AppendTag(b, writeRequestTimeseriesField, protowire.BytesType)
+	return protowire.AppendBytes(b, tsb)
+}
+
+func appendMetadata(b []byte, familyName string, metricType int) []byte {
+	var mb []byte
+	mb = protowire.AppendTag(mb, metadataTypeField, protowire.VarintType)
+	mb = protowire.AppendVarint(mb, uint64(metricType))
+	mb = protowire.AppendTag(mb, metadataFamilyNameField, protowire.BytesType)
+	mb = protowire.AppendString(mb, familyName)
+
+	b = protowire.AppendTag(b, writeRequestMetadataField, protowire.BytesType)
+	return protowire.AppendBytes(b, mb)
+}
+
+// encodeWriteRequest converts the datapoints to an uncompressed protobuf
+// encoded remote write WriteRequest.  The number of datapoints that were
+// skipped because they have non-numeric values is also returned.
+func encodeWriteRequest(dps []*datapoint.Datapoint) ([]byte, int) {
+	var b []byte
+	skipped := 0
+	metricTypes := map[string]int{}
+
+	for _, dp := range dps {
+		ts, ok := convertDatapoint(dp)
+		if !ok {
+			skipped++
+			continue
+		}
+		b = appendTimeSeries(b, ts)
+		metricTypes[promexport.SanitizeMetricName(dp.Metric)] = promMetricType(dp.MetricType)
+	}
+
+	names := make([]string, 0, len(metricTypes))
+	for name := range metricTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b = appendMetadata(b, name, metricTypes[name])
+	}
+
+	return b, skipped
+}
@@ -0,0 +1,171 @@
+// Package promremotewrite contains a writer output that sends datapoints to
+// an endpoint that accepts the Prometheus remote write protocol.  Events and
+// trace spans have no equivalent in Prometheus and are ignored.
+package promremotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	sfxwriter "github.com/signalfx/signalfx-go/writer"
+	"github.com/sirupsen/logrus"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/httpclient"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/processor"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+const outputType = "prometheus-remote-write"
+
+// Config for the Prometheus remote write output
+type Config struct {
+	httpclient.HTTPConfig `yaml:",inline"`
+	// The full URL (including path) of the remote write endpoint, e.g.
+	// `http://prometheus:9090/api/v1/write`.
+	URL string `yaml:"url" validate:"required"`
+}
+
+// Output sends datapoints to a Prometheus remote write endpoint.
+type Output struct {
+	*processor.Processor
+
+	url        string
+	httpClient *http.Client
+	dpWriter   *sfxwriter.DatapointWriter
+	logger     *utils.ThrottledLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	eventChan chan *event.Event
+	spanChan  chan []*trace.Span
+
+	// Datapoints that could not be converted because their values are not
+	// numeric
+	dpsSkipped int64
+}
+
+func init() {
+	writer.RegisterOutput(outputType, func(params *writer.OutputParams) (writer.Output, error) {
+		return New(params.Config.(*Config), params)
+	}, &Config{})
+}
+
+// New creates a new Prometheus remote write output
+func New(conf *Config, params *writer.OutputParams) (*Output, error) {
+	conf.UseHTTPS = strings.HasPrefix(conf.URL, "https")
+
+	httpClient, err := conf.HTTPConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Output{
+		Processor:  processor.New(params.WriterConfig),
+		url:        conf.URL,
+		httpClient: httpClient,
+		logger: utils.NewThrottledLogger(logrus.WithFields(logrus.Fields{
+			"component": "writer",
+			"output":    params.OutputConfig.OutputName(),
+		}), 20*time.Second),
+		eventChan: params.Events,
+		spanChan:  params.Spans,
+	}
+	out.ctx, out.cancel = context.WithCancel(context.Background())
+
+	wc := params.WriterConfig
+	out.dpWriter = &sfxwriter.DatapointWriter{
+		PreprocessFunc: out.PreprocessDatapoint,
+		SendFunc:       out.sendDatapoints,
+		OverwriteFunc: func() {
+			out.logger.ThrottledWarning("A datapoint was overwritten in the Prometheus remote write buffer, please consider increasing the maxBuffered option of the output")
+		},
+		MaxBatchSize: wc.DatapointMaxBatchSize,
+		MaxRequests:  wc.MaxRequests,
+		MaxBuffered:  wc.MaxDatapointsBuffered,
+		InputChan:    params.DPs,
+	}
+
+	return out, nil
+}
+
+// Start sending datapoints
+func (o *Output) Start() {
+	o.dpWriter.Start(o.ctx)
+
+	o.logger.Infof("Sending datapoints to Prometheus remote write endpoint %s", o.url)
+
+	// Events and spans aren't supported so just drain them.
+	go func() {
+		for {
+			select {
+			case <-o.ctx.Done():
+				return
+			case <-o.eventChan:
+			case <-o.spanChan:
+			}
+		}
+	}()
+}
+
+func (o *Output) sendDatapoints(ctx context.Context, dps []*datapoint.Datapoint) error {
+	payload, skipped := encodeWriteRequest(dps)
+	if skipped > 0 {
+		atomic.AddInt64(&o.dpsSkipped, int64(skipped))
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.url, bytes.NewReader(snappy.Encode(nil, payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		o.logger.WithError(utils.SanitizeHTTPError(err)).ThrottledError("Failed to send datapoints to Prometheus remote write endpoint")
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("non-2xx response received (%d): %s", resp.StatusCode, string(body))
+		o.logger.WithError(err).ThrottledError("Failed to send datapoints to Prometheus remote write endpoint")
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	return nil
+}
+
+// Shutdown the output
+func (o *Output) Shutdown() {
+	if o.cancel != nil {
+		o.cancel()
+	}
+}
+
+// InternalMetrics returns a set of metrics showing how the output is
+// currently doing.
+func (o *Output) InternalMetrics() []*datapoint.Datapoint {
+	return append(o.dpWriter.InternalMetrics("prometheus_remote_write."),
+		sfxclient.CumulativeP("prometheus_remote_write.datapoints_skipped", nil, &o.dpsSkipped))
+}
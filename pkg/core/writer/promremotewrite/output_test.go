@@ -0,0 +1,124 @@
+package promremotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+)
+
+// Walks a protobuf message and returns the raw values of each field by number
+func decodeFields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	out := map[protowire.Number][][]byte{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.True(t, n > 0)
+		b = b[n:]
+		var val []byte
+		switch typ {
+		case protowire.BytesType:
+			val, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			val = protowire.AppendVarint(nil, v)
+		case protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			val = protowire.AppendFixed64(nil, v)
+		}
+		require.True(t, n > 0)
+		b = b[n:]
+		out[num] = append(out[num], val)
+	}
+	return out
+}
+
+func TestOutput(t *testing.T) {
+	reqs := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		reqs <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	conf := &Config{URL: server.URL}
+	wc := &config.WriterConfig{
+		GlobalDimensions: map[string]string{"env": "test"},
+	}
+	out, err := New(conf, &writer.OutputParams{
+		WriterConfig: wc,
+		OutputConfig: &config.OutputConfig{Type: outputType},
+	})
+	require.Nil(t, err)
+
+	ts := time.Unix(1600000000, 0)
+	dps := []*datapoint.Datapoint{
+		datapoint.New("cpu.utilization", map[string]string{"host": "a"}, datapoint.NewFloatValue(1.5), datapoint.Gauge, ts),
+		datapoint.New("requests", map[string]string{"host": "a"}, datapoint.NewIntValue(10), datapoint.Counter, ts),
+		datapoint.New("state", nil, datapoint.NewStringValue("up"), datapoint.Gauge, ts),
+	}
+	for _, dp := range dps {
+		require.True(t, out.PreprocessDatapoint(dp))
+	}
+	require.Nil(t, out.sendDatapoints(context.Background(), dps))
+
+	req := <-reqs
+	require.Equal(t, "snappy", req.Header.Get("Content-Encoding"))
+	require.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+
+	payload, err := snappy.Decode(nil, <-bodies)
+	require.Nil(t, err)
+
+	writeReq := decodeFields(t, payload)
+	require.Len(t, writeReq[writeRequestTimeseriesField], 2)
+	require.Len(t, writeReq[writeRequestMetadataField], 2)
+	require.Equal(t, int64(1), out.dpsSkipped)
+
+	series := decodeFields(t, writeReq[writeRequestTimeseriesField][0])
+	var labels [][2]string
+	for _, l := range series[timeSeriesLabelsField] {
+		fields := decodeFields(t, l)
+		labels = append(labels, [2]string{string(fields[labelNameField][0]), string(fields[labelValueField][0])})
+	}
+	require.Equal(t, [][2]string{{"__name__", "cpu_utilization"}, {"env", "test"}, {"host", "a"}}, labels)
+
+	sample := decodeFields(t, series[timeSeriesSamplesField][0])
+	val, _ := protowire.ConsumeFixed64(sample[sampleValueField][0])
+	require.Equal(t, 1.5, math.Float64frombits(val))
+	millis, _ := protowire.ConsumeVarint(sample[sampleTimestampField][0])
+	require.Equal(t, uint64(1600000000000), millis)
+}
+
+func TestConvertDatapointLabels(t *testing.T) {
+	dp := datapoint.New("cpu.utilization", map[string]string{
+		"host":     "a",
+		"__name__": "other",
+		"a.b":      "2",
+		"a:b":      "1",
+		"empty":    "",
+	}, datapoint.NewIntValue(5), datapoint.Gauge, time.Now())
+
+	for i := 0; i < 10; i++ {
+		ts, ok := convertDatapoint(dp)
+		require.True(t, ok)
+		require.Equal(t, []label{
+			{name: "__name__", value: "cpu_utilization"},
+			{name: "a_b", value: "1"},
+			{name: "host", value: "a"},
+		}, ts.labels)
+	}
+}
@@ -46,7 +46,7 @@ func (sw *Writer) maintainLastMinuteActivity() {
 // DiagnosticText outputs a string that describes the state of the writer to a
 // human.
 func (sw *Writer) DiagnosticText() string {
-	return fmt.Sprintf(
+	text := fmt.Sprintf(
 		"Global Dimensions:                %s\n"+
 			"GlobalSpanTags:                   %s\n"+
 			"Datapoints sent (last minute):    %d\n"+
@@ -63,12 +63,21 @@ func (sw *Writer) DiagnosticText() string {
 		sw.eventsLastMinute,
 		sw.spansLastMinute,
 		atomic.LoadInt64(&sw.spanWriter.TotalOverwritten))
+
+	if sw.dpDiskBuffer != nil {
+		text += fmt.Sprintf("\n"+
+			"Datapoint batches on disk:        %d (%d bytes)\n"+
+			"Trace span batches on disk:       %d (%d bytes)",
+			sw.dpDiskBuffer.Len(), sw.dpDiskBuffer.Bytes(),
+			sw.spanDiskBuffer.Len(), sw.spanDiskBuffer.Bytes())
+	}
+	return text
 }
 
 // InternalMetrics returns a set of metrics showing how the writer is currently
 // doing.
 func (sw *Writer) InternalMetrics() []*datapoint.Datapoint {
-	return append(append(append(append(append(append([]*datapoint.Datapoint{
+	dps := append(append(append(append(append(append([]*datapoint.Datapoint{
 		sfxclient.CumulativeP("sfxagent.events_sent", nil, &sw.eventsSent),
 		sfxclient.Gauge("sfxagent.datapoint_channel_len", nil, int64(len(sw.dpChan))),
 		sfxclient.Gauge("sfxagent.events_buffered", nil, int64(len(sw.eventBuffer))),
@@ -79,4 +88,11 @@ func (sw *Writer) InternalMetrics() []*datapoint.Datapoint {
 		sw.dimensionClient.InternalMetrics()...),
 		sw.spanSourceTracker.InternalMetrics()...),
 		sw.correlationClient.InternalMetrics()...)
+
+	if sw.dpDiskBuffer != nil {
+		dps = append(append(dps,
+			sw.dpDiskBuffer.InternalMetrics("sfxagent.datapoint_")...),
+			sw.spanDiskBuffer.InternalMetrics("sfxagent.trace_span_")...)
+	}
+	return dps
 }
@@ -0,0 +1,212 @@
+package signalfx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/diskbuffer"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// The JSON representation of datapoints in the disk buffer.  The golib
+// datapoint JSON encoding doesn't preserve the difference between int and
+// float values, so we use our own.
+type bufferedDatapoint struct {
+	Metric      string               `json:"metric"`
+	Dimensions  map[string]string    `json:"dimensions"`
+	IntValue    *int64               `json:"intValue,omitempty"`
+	FloatValue  *float64             `json:"floatValue,omitempty"`
+	StringValue *string              `json:"stringValue,omitempty"`
+	MetricType  datapoint.MetricType `json:"metricType"`
+	Timestamp   time.Time            `json:"timestamp"`
+}
+
+func encodeDatapoints(dps []*datapoint.Datapoint) ([]byte, error) {
+	out := make([]bufferedDatapoint, len(dps))
+	for i, dp := range dps {
+		out[i] = bufferedDatapoint{
+			Metric:     dp.Metric,
+			Dimensions: dp.Dimensions,
+			MetricType: dp.MetricType,
+			Timestamp:  dp.Timestamp,
+		}
+		switch v := dp.Value.(type) {
+		case datapoint.IntValue:
+			val := v.Int()
+			out[i].IntValue = &val
+		case datapoint.FloatValue:
+			val := v.Float()
+			out[i].FloatValue = &val
+		default:
+			val := dp.Value.String()
+			out[i].StringValue = &val
+		}
+	}
+	return json.Marshal(out)
+}
+
+func decodeDatapoints(payload []byte) ([]*datapoint.Datapoint, error) {
+	var in []bufferedDatapoint
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return nil, err
+	}
+
+	dps := make([]*datapoint.Datapoint, len(in))
+	for i := range in {
+		var val datapoint.Value
+		switch {
+		case in[i].IntValue != nil:
+			val = datapoint.NewIntValue(*in[i].IntValue)
+		case in[i].FloatValue != nil:
+			val = datapoint.NewFloatValue(*in[i].FloatValue)
+		case in[i].StringValue != nil:
+			val = datapoint.NewStringValue(*in[i].StringValue)
+		}
+		dps[i] = datapoint.New(in[i].Metric, in[i].Dimensions, val, in[i].MetricType, in[i].Timestamp)
+	}
+	return dps, nil
+}
+
+func (sw *Writer) openDiskBuffers() error {
+	conf := sw.conf.DiskBuffer
+	maxBytes := int64(conf.MaxSizeMB) * 1024 * 1024
+
+	var err error
+	sw.dpDiskBuffer, err = diskbuffer.Open(filepath.Join(conf.Directory, "datapoints"), maxBytes, conf.MaxAge.AsDuration())
+	if err != nil {
+		return err
+	}
+
+	sw.spanDiskBuffer, err = diskbuffer.Open(filepath.Join(conf.Directory, "spans"), maxBytes, conf.MaxAge.AsDuration())
+	if err != nil {
+		return err
+	}
+
+	sw.logger.Infof("Buffering unsent datapoints and trace spans on disk in %s", conf.Directory)
+	return nil
+}
+
+// Returned to the generic writers for data that went to the disk buffer so
+// that it isn't counted as sent.
+var errBufferedOnDisk = errors.New("buffered on disk")
+
+// Returns true if data should go straight to the disk buffer instead of being
+// sent.  This is the case when there is already data buffered (i.e. ingest is
+// having problems) so that data is sent in order and isn't held in memory, or
+// when the writer is shutting down so that whatever is left in memory
+// survives a restart.
+func shouldBypassSend(ctx context.Context, q *diskbuffer.Queue) bool {
+	return q != nil && (q.Len() > 0 || ctx.Err() != nil)
+}
+
+// Returns true if the send error might go away if the data is sent again
+// later, which is the case for network errors and for 5xx and 429 responses.
+// Any other response means that ingest rejected the data outright, so there
+// is no point in buffering it.
+func isRetryableError(err error) bool {
+	var tooManyErr *sfxclient.TooManyRequestError
+	if errors.As(err, &tooManyErr) {
+		return true
+	}
+
+	var apiErr *sfxclient.SFXAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError ||
+			apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	return true
+}
+
+func (sw *Writer) bufferDatapoints(dps []*datapoint.Datapoint) {
+	payload, err := encodeDatapoints(dps)
+	if err == nil {
+		err = sw.dpDiskBuffer.Push(payload)
+	}
+	if err != nil {
+		sw.logger.WithError(err).ThrottledError("Could not write datapoints to disk buffer, dropping them")
+	}
+}
+
+func (sw *Writer) bufferSpans(spans []*trace.Span) {
+	payload, err := json.Marshal(spans)
+	if err == nil {
+		err = sw.spanDiskBuffer.Push(payload)
+	}
+	if err != nil {
+		sw.logger.WithError(err).ThrottledError("Could not write trace spans to disk buffer, dropping them")
+	}
+}
+
+func (sw *Writer) replayDiskBuffers() {
+	utils.RunOnInterval(sw.ctx, func() {
+		sw.replayDiskBuffer(sw.dpDiskBuffer, func(payload []byte) error {
+			dps, err := decodeDatapoints(payload)
+			if err != nil {
+				sw.logger.WithError(err).Error("Dropping corrupt datapoint entry in disk buffer")
+				return nil
+			}
+			if err := sw.client.AddDatapoints(sw.ctx, dps); err != nil {
+				return err
+			}
+			sw.dpTap.Accept(dps)
+			return nil
+		})
+
+		sw.replayDiskBuffer(sw.spanDiskBuffer, func(payload []byte) error {
+			var spans []*trace.Span
+			if err := json.Unmarshal(payload, &spans); err != nil {
+				sw.logger.WithError(err).Error("Dropping corrupt trace span entry in disk buffer")
+				return nil
+			}
+			return sw.client.AddSpans(sw.ctx, spans)
+		})
+	}, sw.conf.DiskBuffer.RetryInterval.AsDuration())
+}
+
+// Sends buffered entries, oldest first, until the buffer is empty or a send
+// fails with a retryable error, in which case the rest is left for the next
+// attempt.  Entries that ingest rejects outright are dropped so that they
+// don't block everything behind them.
+func (sw *Writer) replayDiskBuffer(q *diskbuffer.Queue, send func([]byte) error) {
+	if expired := q.ExpireOld(); expired > 0 {
+		sw.logger.Warnf("Dropped %d entries from the disk buffer that were older than %s",
+			expired, sw.conf.DiskBuffer.MaxAge.AsDuration())
+	}
+
+	for sw.ctx.Err() == nil {
+		name, payload, ok, err := q.Peek()
+		if err != nil {
+			sw.logger.WithError(err).Error("Dropping unreadable entry in disk buffer")
+			continue
+		}
+		if !ok {
+			return
+		}
+
+		if err := send(payload); err != nil {
+			if !isRetryableError(err) {
+				sw.logger.WithFields(log.Fields{
+					"error": utils.SanitizeHTTPError(err),
+				}).ThrottledError("Dropping disk buffer entry that was rejected by ingest")
+				q.Drop(name)
+				continue
+			}
+			sw.logger.WithFields(log.Fields{
+				"error":    utils.SanitizeHTTPError(err),
+				"buffered": q.Len(),
+			}).ThrottledWarning("Could not resend data from disk buffer, will retry")
+			return
+		}
+		q.Remove(name)
+	}
+}
@@ -0,0 +1,221 @@
+package signalfx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/diskbuffer"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
+)
+
+func TestDatapointDiskBufferEncoding(t *testing.T) {
+	ts := time.Unix(1600000000, 0).UTC()
+	dps := []*datapoint.Datapoint{
+		datapoint.New("a", map[string]string{"host": "test"}, datapoint.NewIntValue(5), datapoint.Counter, ts),
+		datapoint.New("b", nil, datapoint.NewFloatValue(2.0), datapoint.Gauge, ts),
+		datapoint.New("c", nil, datapoint.NewStringValue("x"), datapoint.Gauge, ts),
+	}
+
+	payload, err := encodeDatapoints(dps)
+	require.Nil(t, err)
+
+	decoded, err := decodeDatapoints(payload)
+	require.Nil(t, err)
+	require.Len(t, decoded, 3)
+
+	require.Equal(t, "a", decoded[0].Metric)
+	require.Equal(t, map[string]string{"host": "test"}, decoded[0].Dimensions)
+	require.Equal(t, datapoint.Counter, decoded[0].MetricType)
+	require.Equal(t, ts, decoded[0].Timestamp.UTC())
+	require.Equal(t, int64(5), decoded[0].Value.(datapoint.IntValue).Int())
+
+	// Make sure floats with integral values stay floats
+	require.Equal(t, 2.0, decoded[1].Value.(datapoint.FloatValue).Float())
+	require.Equal(t, "x", decoded[2].Value.String())
+}
+
+func TestIsRetryableError(t *testing.T) {
+	require.True(t, isRetryableError(errors.New("connection refused")))
+	require.True(t, isRetryableError(&sfxclient.SFXAPIError{StatusCode: 500}))
+	require.True(t, isRetryableError(&sfxclient.SFXAPIError{StatusCode: 429}))
+	require.True(t, isRetryableError(&sfxclient.TooManyRequestError{}))
+	require.False(t, isRetryableError(&sfxclient.SFXAPIError{StatusCode: 400}))
+	require.False(t, isRetryableError(fmt.Errorf("wrapped: %w", &sfxclient.SFXAPIError{StatusCode: 401})))
+}
+
+// newDiskBufferedWriter makes a writer that sends datapoints to a server that
+// responds with the status codes returned by status, in order.
+func newDiskBufferedWriter(t *testing.T, status func() int) (*Writer, *int64) {
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		rw.WriteHeader(status())
+		_, _ = rw.Write([]byte(`"OK"`))
+	}))
+	t.Cleanup(server.Close)
+
+	conf := essentialWriterConfig
+	conf.IngestURL = server.URL
+	conf.DiskBuffer = config.DiskBufferConfig{
+		Directory:     t.TempDir(),
+		MaxSizeMB:     10,
+		MaxAge:        timeutil.Duration(time.Hour),
+		RetryInterval: timeutil.Duration(time.Hour),
+	}
+
+	writer, err := New(&conf, make(chan []*datapoint.Datapoint, 100), nil, nil, nil, nil)
+	require.Nil(t, err)
+	t.Cleanup(writer.cancel)
+	return writer, &requests
+}
+
+func makeTestDatapoints(n int) []*datapoint.Datapoint {
+	dps := make([]*datapoint.Datapoint, n)
+	for i := range dps {
+		dps[i] = sfxclient.Gauge("test", map[string]string{"i": strconv.Itoa(i)}, int64(i))
+	}
+	return dps
+}
+
+// Returns the total number of datapoints in the disk buffer
+func bufferedDatapointCount(t *testing.T, q *diskbuffer.Queue) int {
+	var count int
+	for q.Len() > 0 {
+		name, payload, ok, err := q.Peek()
+		require.Nil(t, err)
+		require.True(t, ok)
+		dps, err := decodeDatapoints(payload)
+		require.Nil(t, err)
+		count += len(dps)
+		q.Remove(name)
+	}
+	return count
+}
+
+func TestDiskBufferSending(t *testing.T) {
+	t.Run("buffers retryable errors only", func(t *testing.T) {
+		status := http.StatusBadRequest
+		writer, _ := newDiskBufferedWriter(t, func() int { return status })
+
+		require.NotNil(t, writer.sendDatapoints(writer.ctx, makeTestDatapoints(2)))
+		require.Equal(t, 0, writer.dpDiskBuffer.Len())
+
+		status = http.StatusServiceUnavailable
+		require.NotNil(t, writer.sendDatapoints(writer.ctx, makeTestDatapoints(2)))
+		require.Equal(t, 1, writer.dpDiskBuffer.Len())
+	})
+
+	t.Run("bypasses sending while data is buffered", func(t *testing.T) {
+		writer, requests := newDiskBufferedWriter(t, func() int { return http.StatusOK })
+
+		payload, err := encodeDatapoints(makeTestDatapoints(1))
+		require.Nil(t, err)
+		require.Nil(t, writer.dpDiskBuffer.Push(payload))
+
+		require.Equal(t, errBufferedOnDisk, writer.sendDatapoints(writer.ctx, makeTestDatapoints(2)))
+		require.Equal(t, int64(0), atomic.LoadInt64(requests))
+		require.Equal(t, 3, bufferedDatapointCount(t, writer.dpDiskBuffer))
+	})
+}
+
+func TestDiskBufferReplay(t *testing.T) {
+	replay := func(writer *Writer) {
+		writer.replayDiskBuffer(writer.dpDiskBuffer, func(payload []byte) error {
+			dps, err := decodeDatapoints(payload)
+			require.Nil(t, err)
+			return writer.client.AddDatapoints(writer.ctx, dps)
+		})
+	}
+
+	t.Run("drops rejected entries", func(t *testing.T) {
+		statuses := []int{http.StatusBadRequest, http.StatusOK, http.StatusOK}
+		writer, requests := newDiskBufferedWriter(t, func() int {
+			s := statuses[0]
+			statuses = statuses[1:]
+			return s
+		})
+
+		for i := 0; i < 3; i++ {
+			payload, err := encodeDatapoints(makeTestDatapoints(1))
+			require.Nil(t, err)
+			require.Nil(t, writer.dpDiskBuffer.Push(payload))
+		}
+
+		replay(writer)
+		require.Equal(t, 0, writer.dpDiskBuffer.Len())
+		require.Equal(t, int64(3), atomic.LoadInt64(requests))
+		require.Equal(t, int64(1), writer.dpDiskBuffer.TotalDropped)
+		require.Equal(t, int64(2), writer.dpDiskBuffer.TotalProcessed)
+	})
+
+	t.Run("stops on retryable errors", func(t *testing.T) {
+		writer, requests := newDiskBufferedWriter(t, func() int { return http.StatusServiceUnavailable })
+
+		for i := 0; i < 3; i++ {
+			payload, err := encodeDatapoints(makeTestDatapoints(1))
+			require.Nil(t, err)
+			require.Nil(t, writer.dpDiskBuffer.Push(payload))
+		}
+
+		replay(writer)
+		require.Equal(t, 3, writer.dpDiskBuffer.Len())
+		require.Equal(t, int64(1), atomic.LoadInt64(requests))
+	})
+}
+
+func TestDiskBufferShutdown(t *testing.T) {
+	writer, requests := newDiskBufferedWriter(t, func() int { return http.StatusOK })
+	writer.conf.DatapointMaxBatchSize = 10
+	writer.datapointWriter.MaxBatchSize = 10
+	writer.datapointWriter.MaxRequests = 1
+
+	for i := 0; i < 10; i++ {
+		writer.dpChan <- makeTestDatapoints(10)
+	}
+
+	// Everything still held in memory on shutdown should go to disk
+	writer.cancel()
+	writer.datapointWriter.Start(writer.ctx)
+	writer.datapointWriter.WaitForShutdown()
+
+	require.Equal(t, int64(0), atomic.LoadInt64(requests))
+	require.Equal(t, 100, bufferedDatapointCount(t, writer.dpDiskBuffer))
+}
+
+func TestDiskBufferShutdownBeforeStart(t *testing.T) {
+	writer, _ := newDiskBufferedWriter(t, func() int { return http.StatusOK })
+	require.NotPanics(t, writer.Shutdown)
+}
+
+func TestDiskBufferMultiWriterFailedOutput(t *testing.T) {
+	conf := essentialWriterConfig
+	conf.DiskBuffer = config.DiskBufferConfig{
+		Directory: t.TempDir(),
+		MaxSizeMB: 10,
+	}
+	conf.Outputs = []config.OutputConfig{
+		{Type: "signalfx", Name: "a"},
+		{Type: "signalfx", Name: "b", OtherConfig: map[string]interface{}{"notAnOption": true}},
+	}
+
+	require.NotPanics(t, func() {
+		_, err := writer.New(&conf, make(chan []*datapoint.Datapoint, 10), make(chan *event.Event, 10),
+			make(chan *types.Dimension, 10), make(chan []*trace.Span, 10), nil)
+		require.NotNil(t, err)
+	})
+}
@@ -0,0 +1,82 @@
+package signalfx
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// OutputConfig is the config specific to the `signalfx` writer output.  Any
+// options that are not set fall back to the equivalent top-level agent
+// config, so that multiple outputs can send to different SignalFx
+// organizations or gateways.
+type OutputConfig struct {
+	// The access token for the org that should receive data from this output.
+	SignalFxAccessToken string `yaml:"signalFxAccessToken" neverLog:"true"`
+	// The URL of the SignalFx ingest server for this output.
+	IngestURL string `yaml:"ingestUrl"`
+	// The full URL (including path) to the event ingest server for this
+	// output.
+	EventEndpointURL string `yaml:"eventEndpointUrl"`
+	// The full URL (including path) to the trace ingest server for this
+	// output.
+	TraceEndpointURL string `yaml:"traceEndpointUrl"`
+	// The SignalFx API base URL for this output.
+	APIURL string `yaml:"apiUrl"`
+	// Format to export traces in. Choices are "zipkin" and "sapm"
+	TraceExportFormat string `yaml:"traceExportFormat"`
+}
+
+// Validate the output config
+func (oc *OutputConfig) Validate() error {
+	if !httpguts.ValidHeaderFieldValue(oc.SignalFxAccessToken) {
+		return errors.New("the SignalFx Access Token does not pass http header validation and is likely malformed")
+	}
+
+	for _, u := range []string{oc.IngestURL, oc.EventEndpointURL, oc.TraceEndpointURL, oc.APIURL} {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("%s is not a valid URL: %v", u, err)
+		}
+	}
+
+	// An empty format falls back to the top-level one, which is validated
+	// with the rest of the writer config
+	if oc.TraceExportFormat != "" {
+		return config.ValidateTraceExportFormat(oc.TraceExportFormat)
+	}
+	return nil
+}
+
+func init() {
+	writer.RegisterOutput("signalfx", func(params *writer.OutputParams) (writer.Output, error) {
+		conf := params.Config.(*OutputConfig)
+		wc := params.WriterConfig
+
+		wc.SignalFxAccessToken = utils.FirstNonEmpty(conf.SignalFxAccessToken, wc.SignalFxAccessToken)
+		wc.IngestURL = utils.FirstNonEmpty(conf.IngestURL, wc.IngestURL)
+		wc.EventEndpointURL = utils.FirstNonEmpty(conf.EventEndpointURL, wc.EventEndpointURL)
+		wc.TraceEndpointURL = utils.FirstNonEmpty(conf.TraceEndpointURL, wc.TraceEndpointURL)
+		wc.APIURL = utils.FirstNonEmpty(conf.APIURL, wc.APIURL)
+		wc.TraceExportFormat = utils.FirstNonEmpty(conf.TraceExportFormat, wc.TraceExportFormat)
+
+		// Keep outputs from sharing a disk buffer
+		if wc.DiskBuffer.Enabled() && params.OutputConfig.Name != "" {
+			wc.DiskBuffer.Directory = filepath.Join(wc.DiskBuffer.Directory, params.OutputConfig.Name)
+		}
+
+		return New(wc, params.DPs, params.Events, params.Dimensions, params.Spans, params.SpanSourceTracker)
+	}, &OutputConfig{})
+}
+
+// AcceptsDimensionUpdates returns true since the SignalFx output syncs
+// dimension properties to the SignalFx API.
+func (sw *Writer) AcceptsDimensionUpdates() bool {
+	return true
+}
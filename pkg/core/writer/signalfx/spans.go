@@ -17,6 +17,11 @@ func (sw *Writer) sendSpans(ctx context.Context, spans []*trace.Span) error {
 		sw.serviceTracker.AddSpans(sw.ctx, spans)
 	}
 
+	if shouldBypassSend(ctx, sw.spanDiskBuffer) {
+		sw.bufferSpans(spans)
+		return errBufferedOnDisk
+	}
+
 	if sw.client != nil {
 		// This sends synchonously
 		err := sw.client.AddSpans(context.Background(), spans)
@@ -36,7 +41,11 @@ func (sw *Writer) sendSpans(ctx context.Context, spans []*trace.Span) error {
 
 			log.WithFields(meta).Error("Error shipping spans to SignalFx")
 
-			// If there is an error sending spans then just forget about them.
+			if sw.spanDiskBuffer != nil && isRetryableError(err) {
+				sw.bufferSpans(spans)
+			}
+			// If there is an error sending spans then just forget about them,
+			// unless they were buffered on disk above.
 			return err
 		}
 		log.Debugf("Sent %d spans out of the agent", len(spans))
@@ -31,6 +31,7 @@ import (
 	libtracker "github.com/signalfx/signalfx-agent/pkg/apm/tracetracker"
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/dimensions"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer/diskbuffer"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/processor"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/tap"
 	"github.com/signalfx/signalfx-agent/pkg/core/writer/tracetracker"
@@ -56,6 +57,14 @@ type Writer struct {
 	datapointWriter   *sfxwriter.DatapointWriter
 	spanWriter        *sfxwriter.SpanWriter
 
+	// Hold datapoints and spans that could not be sent, if enabled
+	dpDiskBuffer   *diskbuffer.Queue
+	spanDiskBuffer *diskbuffer.Queue
+
+	// Whether Start has been called, since the datapoint and span writers
+	// can only be waited on if they were started
+	started bool
+
 	// Monitors should send events to this
 	eventChan     chan *event.Event
 	dimensionChan chan *types.Dimension
@@ -225,6 +234,13 @@ func New(conf *config.WriterConfig, dpChan chan []*datapoint.Datapoint, eventCha
 		InputChan:    sw.dpChan,
 	}
 
+	if conf.DiskBuffer.Enabled() {
+		if err := sw.openDiskBuffers(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
 	sw.spanWriter = &sfxwriter.SpanWriter{
 		PreprocessFunc: sw.processSpan,
 		SendFunc:       sw.sendSpans,
@@ -255,6 +271,11 @@ func (sw *Writer) Start() {
 
 	sw.datapointWriter.Start(sw.ctx)
 	sw.spanWriter.Start(sw.ctx)
+	sw.started = true
+
+	if sw.conf.DiskBuffer.Enabled() {
+		sw.replayDiskBuffers()
+	}
 }
 
 func (sw *Writer) processDatapoint(dp *datapoint.Datapoint) bool {
@@ -272,6 +293,11 @@ func (sw *Writer) processDatapoint(dp *datapoint.Datapoint) bool {
 }
 
 func (sw *Writer) sendDatapoints(ctx context.Context, dps []*datapoint.Datapoint) error {
+	if shouldBypassSend(ctx, sw.dpDiskBuffer) {
+		sw.bufferDatapoints(dps)
+		return errBufferedOnDisk
+	}
+
 	// This sends synchronously and retries on transient connection errors
 	err := sw.client.AddDatapoints(ctx, dps)
 	if err != nil {
@@ -283,7 +309,11 @@ func (sw *Writer) sendDatapoints(ctx context.Context, dps []*datapoint.Datapoint
 			sw.logger.WithFields(log.Fields{
 				"error": utils.SanitizeHTTPError(err),
 			}).Error("Error shipping datapoints to SignalFx")
-			// If there is an error sending datapoints then just forget about them.
+			if sw.dpDiskBuffer != nil && isRetryableError(err) {
+				sw.bufferDatapoints(dps)
+			}
+			// If there is an error sending datapoints then just forget about
+			// them, unless they were buffered on disk above.
 			return err
 		}
 
@@ -405,5 +435,11 @@ func (sw *Writer) Shutdown() {
 	if sw.cancel != nil {
 		sw.cancel()
 	}
+	if sw.dpDiskBuffer != nil && sw.started {
+		// Wait for whatever is still held in memory to be flushed to the disk
+		// buffer.
+		sw.datapointWriter.WaitForShutdown()
+		sw.spanWriter.WaitForShutdown()
+	}
 	sw.logger.Debug("Stopped datapoint writer")
 }
@@ -77,3 +77,14 @@ func TestIsTransientError(t *testing.T) {
 		})
 	}
 }
+
+func TestOutputConfigValidate(t *testing.T) {
+	require.Nil(t, (&OutputConfig{}).Validate())
+	require.Nil(t, (&OutputConfig{TraceExportFormat: "SAPM"}).Validate())
+
+	err := (&OutputConfig{TraceExportFormat: "otlp"}).Validate()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "type: otlp")
+
+	require.NotNil(t, (&OutputConfig{TraceExportFormat: "jaeger"}).Validate())
+}
@@ -0,0 +1,22 @@
+package splunk
+
+import (
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/writer"
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+func init() {
+	writer.RegisterOutput("splunk", func(params *writer.OutputParams) (writer.Output, error) {
+		splunkConf := *params.Config.(*config.SplunkConfig)
+		wc := params.WriterConfig
+
+		splunkConf.Enabled = true
+		splunkConf.MaxBuffered = utils.FirstNonZero(params.OutputConfig.MaxBuffered, splunkConf.MaxBuffered, wc.MaxDatapointsBuffered)
+		splunkConf.MaxRequests = utils.FirstNonZero(params.OutputConfig.MaxRequests, splunkConf.MaxRequests, wc.MaxRequests)
+		splunkConf.MaxBatchSize = utils.FirstNonZero(params.OutputConfig.MaxBatchSize, splunkConf.MaxBatchSize, wc.DatapointMaxBatchSize)
+		wc.Splunk = &splunkConf
+
+		return New(wc, params.DPs, params.Events, params.Spans)
+	}, &config.SplunkConfig{})
+}
@@ -0,0 +1,75 @@
+package tap
+
+import (
+	"context"
+	"io"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+	"github.com/sirupsen/logrus"
+)
+
+type dimensionJSON struct {
+	Name              string            `json:"name"`
+	Value             string            `json:"value"`
+	Properties        map[string]string `json:"properties"`
+	Tags              map[string]bool   `json:"tags"`
+	MergeIntoExisting bool              `json:"mergeIntoExisting"`
+}
+
+// DimensionTap accepts dimension property/tag updates and asynchronously
+// writes them to the output, filtering as requested.  Only dimension filters
+// apply, which match against the name and value of the dimension being
+// updated.
+type DimensionTap struct {
+	filter dpfilters.DatapointFilter
+	out    io.Writer
+	format Format
+	buffer chan *types.Dimension
+}
+
+// NewDimensionTap makes a new dimension update tap
+func NewDimensionTap(filter dpfilters.DatapointFilter, out io.Writer, format Format) *DimensionTap {
+	return &DimensionTap{
+		filter: filter,
+		out:    out,
+		format: format,
+		buffer: make(chan *types.Dimension, 100),
+	}
+}
+
+// Run the tap and write out dimension updates
+func (t *DimensionTap) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dim := <-t.buffer:
+			if t.filter != nil && !t.filter.Matches(&datapoint.Datapoint{Dimensions: map[string]string{dim.Name: dim.Value}}) {
+				continue
+			}
+			write(t.out, t.format, dim.String()+"\n", &dimensionJSON{
+				Name:              dim.Name,
+				Value:             dim.Value,
+				Properties:        dim.Properties,
+				Tags:              dim.Tags,
+				MergeIntoExisting: dim.MergeIntoExisting,
+			})
+		}
+	}
+}
+
+// Accept should be called by the writer with every dimension update
+func (t *DimensionTap) Accept(dim *types.Dimension) {
+	if t == nil {
+		return
+	}
+
+	select {
+	case t.buffer <- dim:
+		break
+	default:
+		logrus.Error("Could not process dimension update in tap due to full buffer")
+	}
+}
@@ -0,0 +1,94 @@
+package tap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/sirupsen/logrus"
+)
+
+type eventJSON struct {
+	EventType  string                 `json:"eventType"`
+	Category   string                 `json:"category"`
+	Dimensions map[string]string      `json:"dimensions"`
+	Properties map[string]interface{} `json:"properties"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+var categoryNames = map[event.Category]string{
+	event.USERDEFINED:      "USER_DEFINED",
+	event.ALERT:            "ALERT",
+	event.AUDIT:            "AUDIT",
+	event.JOB:              "JOB",
+	event.COLLECTD:         "COLLECTD",
+	event.SERVICEDISCOVERY: "SERVICE_DISCOVERY",
+	event.EXCEPTION:        "EXCEPTION",
+	event.AGENT:            "AGENT",
+}
+
+func categoryName(c event.Category) string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", c)
+}
+
+// EventTap accepts events and asynchronously writes them to the output,
+// filtering as requested.  Filters match the event type as if it were the
+// metric name.
+type EventTap struct {
+	filter dpfilters.DatapointFilter
+	out    io.Writer
+	format Format
+	buffer chan *event.Event
+}
+
+// NewEventTap makes a new event tap
+func NewEventTap(filter dpfilters.DatapointFilter, out io.Writer, format Format) *EventTap {
+	return &EventTap{
+		filter: filter,
+		out:    out,
+		format: format,
+		buffer: make(chan *event.Event, 100),
+	}
+}
+
+// Run the tap and write out events
+func (t *EventTap) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-t.buffer:
+			if t.filter != nil && !t.filter.Matches(&datapoint.Datapoint{Metric: ev.EventType, Dimensions: ev.Dimensions}) {
+				continue
+			}
+			write(t.out, t.format, ev.String()+"\n", &eventJSON{
+				EventType:  ev.EventType,
+				Category:   categoryName(ev.Category),
+				Dimensions: ev.Dimensions,
+				Properties: ev.Properties,
+				Timestamp:  ev.Timestamp,
+			})
+		}
+	}
+}
+
+// Accept should be called by the writer with every event
+func (t *EventTap) Accept(ev *event.Event) {
+	if t == nil {
+		return
+	}
+
+	select {
+	case t.buffer <- ev:
+		break
+	default:
+		logrus.Error("Could not process event in tap due to full buffer")
+	}
+}
@@ -0,0 +1,84 @@
+package tap
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/sirupsen/logrus"
+)
+
+// SpanTap accepts trace spans and asynchronously writes them to the output,
+// filtering as requested.  Filters match the span name as if it were the
+// metric name and the span tags as if they were dimensions.
+type SpanTap struct {
+	filter dpfilters.DatapointFilter
+	out    io.Writer
+	format Format
+	buffer chan []*trace.Span
+}
+
+// NewSpanTap makes a new span tap
+func NewSpanTap(filter dpfilters.DatapointFilter, out io.Writer, format Format) *SpanTap {
+	return &SpanTap{
+		filter: filter,
+		out:    out,
+		format: format,
+		buffer: make(chan []*trace.Span, 100),
+	}
+}
+
+func spanToString(span *trace.Span) string {
+	var name, service string
+	if span.Name != nil {
+		name = *span.Name
+	}
+	if span.LocalEndpoint != nil && span.LocalEndpoint.ServiceName != nil {
+		service = *span.LocalEndpoint.ServiceName
+	}
+	var duration int64
+	if span.Duration != nil {
+		duration = *span.Duration
+	}
+	return fmt.Sprintf("%s (service: %s, trace: %s, id: %s, duration: %dus)\n%v\n", name, service, span.TraceID, span.ID, duration, span.Tags)
+}
+
+// Run the tap and write out spans
+func (t *SpanTap) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case spans := <-t.buffer:
+			for _, span := range spans {
+				if t.filter != nil {
+					dp := &datapoint.Datapoint{Dimensions: span.Tags}
+					if span.Name != nil {
+						dp.Metric = *span.Name
+					}
+					if !t.filter.Matches(dp) {
+						continue
+					}
+				}
+				write(t.out, t.format, spanToString(span), span)
+			}
+		}
+	}
+}
+
+// Accept should be called by the writer with every batch of spans
+func (t *SpanTap) Accept(spans []*trace.Span) {
+	if t == nil {
+		return
+	}
+
+	select {
+	case t.buffer <- spans:
+		break
+	default:
+		logrus.Error("Could not process trace spans in tap due to full buffer")
+	}
+}
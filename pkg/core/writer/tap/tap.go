@@ -2,8 +2,12 @@ package tap
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/signalfx/golib/v3/datapoint"
 	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
@@ -11,19 +15,91 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Format is how a tap writes out the things it receives
+type Format string
+
+const (
+	// FormatText is a human readable format that is meant for viewing
+	// directly
+	FormatText Format = "text"
+	// FormatJSON writes out one JSON object per line
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the format with the given name, defaulting to text if
+// it is blank.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", string(FormatText):
+		return FormatText, nil
+	case string(FormatJSON):
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown tap format '%s', must be either 'text' or 'json'", name)
+	}
+}
+
+// write outputs a single item that came through a tap in the given format
+func write(out io.Writer, format Format, text string, obj interface{}) {
+	if format == FormatJSON {
+		b, err := json.Marshal(obj)
+		if err != nil {
+			logrus.WithError(err).Error("Could not serialize item in tap")
+			return
+		}
+		_, _ = out.Write(append(b, '\n'))
+	} else {
+		_, _ = out.Write([]byte(text))
+	}
+
+	if f, ok := out.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type datapointJSON struct {
+	Metric     string            `json:"metric"`
+	Dimensions map[string]string `json:"dimensions"`
+	Value      interface{}       `json:"value"`
+	MetricType string            `json:"metricType"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
+
+func datapointToJSON(dp *datapoint.Datapoint) *datapointJSON {
+	var val interface{}
+	switch v := dp.Value.(type) {
+	case datapoint.IntValue:
+		val = v.Int()
+	case datapoint.FloatValue:
+		val = v.Float()
+	default:
+		val = dp.Value.String()
+	}
+
+	return &datapointJSON{
+		Metric:     dp.Metric,
+		Dimensions: dp.Dimensions,
+		Value:      val,
+		MetricType: utils.MetricTypeToString(dp.MetricType),
+		Timestamp:  dp.Timestamp,
+	}
+}
+
 // DatapointTap accepts datapoints and asynchronouly writes a string
 // representation of them to the output, filtering as requested.
 type DatapointTap struct {
 	filter dpfilters.DatapointFilter
 	out    io.Writer
+	format Format
 	buffer chan []*datapoint.Datapoint
 }
 
 // New makes a new tap
-func New(filter dpfilters.DatapointFilter, out io.Writer) *DatapointTap {
+func New(filter dpfilters.DatapointFilter, out io.Writer, format Format) *DatapointTap {
 	return &DatapointTap{
 		filter: filter,
 		out:    out,
+		format: format,
 		buffer: make(chan []*datapoint.Datapoint, 100),
 	}
 }
@@ -39,10 +115,7 @@ func (t *DatapointTap) Run(ctx context.Context) {
 				if t.filter != nil && !t.filter.Matches(dp) {
 					continue
 				}
-				_, _ = t.out.Write([]byte(utils.DatapointToString(dp)))
-				if f, ok := t.out.(http.Flusher); ok {
-					f.Flush()
-				}
+				write(t.out, t.format, utils.DatapointToString(dp), datapointToJSON(dp))
 			}
 		}
 	}
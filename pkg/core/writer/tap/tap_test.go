@@ -0,0 +1,137 @@
+package tap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/event"
+	"github.com/signalfx/golib/v3/pointer"
+	"github.com/signalfx/golib/v3/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/dpfilters"
+	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() []string {
+	b.Lock()
+	defer b.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+func decodeLines(t *testing.T, out *syncBuffer, count int) []map[string]interface{} {
+	var objs []map[string]interface{}
+	require.Eventually(t, func() bool {
+		return len(out.lines()) == count && out.lines()[0] != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, l := range out.lines() {
+		var obj map[string]interface{}
+		require.Nil(t, json.Unmarshal([]byte(l), &obj))
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+func TestTapsWithJSON(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("datapoints", func(t *testing.T) {
+		filter, err := dpfilters.NewOverridable([]string{"cpu.*"}, nil)
+		require.Nil(t, err)
+
+		out := &syncBuffer{}
+		dpTap := New(filter, out, FormatJSON)
+		go dpTap.Run(ctx)
+
+		dpTap.Accept([]*datapoint.Datapoint{
+			datapoint.New("cpu.utilization", map[string]string{"host": "a"}, datapoint.NewFloatValue(1.5), datapoint.Gauge, time.Now()),
+			datapoint.New("memory.used", nil, datapoint.NewIntValue(1), datapoint.Gauge, time.Now()),
+		})
+
+		objs := decodeLines(t, out, 1)
+		require.Equal(t, "cpu.utilization", objs[0]["metric"])
+		require.Equal(t, 1.5, objs[0]["value"])
+		require.Equal(t, "gauge", objs[0]["metricType"])
+	})
+
+	t.Run("events", func(t *testing.T) {
+		filter, err := dpfilters.NewOverridable([]string{"k8s.*"}, nil)
+		require.Nil(t, err)
+
+		out := &syncBuffer{}
+		eventTap := NewEventTap(filter, out, FormatJSON)
+		go eventTap.Run(ctx)
+
+		eventTap.Accept(event.New("other", event.AGENT, nil, time.Now()))
+		eventTap.Accept(event.NewWithProperties("k8s.restart", event.AGENT, map[string]string{"pod": "a"}, map[string]interface{}{"count": 2}, time.Now()))
+
+		objs := decodeLines(t, out, 1)
+		require.Equal(t, "k8s.restart", objs[0]["eventType"])
+		require.Equal(t, "AGENT", objs[0]["category"])
+	})
+
+	t.Run("spans", func(t *testing.T) {
+		filter, err := dpfilters.NewOverridable(nil, map[string][]string{"env": {"prod"}})
+		require.Nil(t, err)
+
+		out := &syncBuffer{}
+		spanTap := NewSpanTap(filter, out, FormatJSON)
+		go spanTap.Run(ctx)
+
+		spanTap.Accept([]*trace.Span{
+			{TraceID: "1", ID: "2", Name: pointer.String("get"), Tags: map[string]string{"env": "prod"}},
+			{TraceID: "1", ID: "3", Name: pointer.String("put"), Tags: map[string]string{"env": "dev"}},
+		})
+
+		objs := decodeLines(t, out, 1)
+		require.Equal(t, "get", objs[0]["name"])
+	})
+
+	t.Run("dimensions", func(t *testing.T) {
+		filter, err := dpfilters.NewOverridable(nil, map[string][]string{"kubernetes_pod_uid": {"*"}})
+		require.Nil(t, err)
+
+		out := &syncBuffer{}
+		dimTap := NewDimensionTap(filter, out, FormatJSON)
+		go dimTap.Run(ctx)
+
+		dimTap.Accept(&types.Dimension{Name: "host", Value: "a"})
+		dimTap.Accept(&types.Dimension{Name: "kubernetes_pod_uid", Value: "abc", Properties: map[string]string{"app": "x"}})
+
+		objs := decodeLines(t, out, 1)
+		require.Equal(t, "abc", objs[0]["value"])
+		require.Equal(t, map[string]interface{}{"app": "x"}, objs[0]["properties"])
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("")
+	require.Nil(t, err)
+	require.Equal(t, FormatText, f)
+
+	f, err = ParseFormat("JSON")
+	require.Nil(t, err)
+	require.Equal(t, FormatJSON, f)
+
+	_, err = ParseFormat("xml")
+	require.NotNil(t, err)
+}
@@ -107,6 +107,7 @@ func (am *ActiveMonitor) configureMonitor(monConfig config.MonitorCustomConfig)
 	am.config = monConfig
 	am.injectAgentMetaIfNeeded()
 	am.injectOutputIfNeeded()
+	am.injectEndpointIfNeeded()
 
 	return config.CallConfigure(am.instance, monConfig)
 }
@@ -154,6 +155,26 @@ func (am *ActiveMonitor) injectAgentMetaIfNeeded() bool {
 	return true
 }
 
+// Sets the `Endpoint` field on a monitor if it is present to the endpoint
+// that the monitor was created for, if any.  Returns whether the field was
+// actually set.
+func (am *ActiveMonitor) injectEndpointIfNeeded() bool {
+	if am.endpoint == nil {
+		return false
+	}
+
+	endpointValue := utils.FindFieldWithEmbeddedStructs(am.instance, "Endpoint",
+		reflect.TypeOf((*services.Endpoint)(nil)).Elem())
+
+	if !endpointValue.IsValid() {
+		return false
+	}
+
+	endpointValue.Set(reflect.ValueOf(am.endpoint))
+
+	return true
+}
+
 // Shutdown calls Shutdown on the monitor instance if it is provided.
 func (am *ActiveMonitor) Shutdown() {
 	if sh, ok := am.instance.(Shutdownable); ok {
@@ -0,0 +1,22 @@
+package custom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	var monConf config.MonitorConfig
+	require.Nil(t, yaml.UnmarshalStrict([]byte(`
+type: collectd/custom
+template: "LoadPlugin foo"
+`), &monConf))
+
+	var conf Config
+	require.Nil(t, config.DecodeExtraConfigStrict(&monConf, &conf))
+	require.Equal(t, "LoadPlugin foo", conf.Template)
+}
@@ -2,6 +2,7 @@ package monitors
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/mitchellh/go-wordwrap"
@@ -138,13 +139,165 @@ func (mm *MonitorManager) BadConfigDiagnosticText() string {
 	return "None"
 }
 
+// MonitorsSummary is a structured form of SummaryDiagnosticText
+type MonitorsSummary struct {
+	ActiveMonitors      int                      `json:"activeMonitors" yaml:"activeMonitors"`
+	ConfiguredMonitors  int                      `json:"configuredMonitors" yaml:"configuredMonitors"`
+	DiscoveredEndpoints int                      `json:"discoveredEndpoints" yaml:"discoveredEndpoints"`
+	BadConfigs          []BadMonitorConfigStatus `json:"badConfigs" yaml:"badConfigs"`
+}
+
+// BadMonitorConfigStatus describes a monitor config that failed validation
+type BadMonitorConfigStatus struct {
+	Type       string `json:"type" yaml:"type"`
+	ConfigHash string `json:"configHash" yaml:"configHash"`
+	Error      string `json:"error" yaml:"error"`
+}
+
+// ActiveMonitorStatus is a structured form of an active monitor in
+// DiagnosticText
+type ActiveMonitorStatus struct {
+	ID                 string            `json:"id" yaml:"id"`
+	Type               string            `json:"type" yaml:"type"`
+	ConfigHash         string            `json:"configHash" yaml:"configHash"`
+	IntervalSeconds    int               `json:"intervalSeconds" yaml:"intervalSeconds"`
+	EnabledMetrics     []string          `json:"enabledMetrics" yaml:"enabledMetrics"`
+	DiscoveryRule      string            `json:"discoveryRule,omitempty" yaml:"discoveryRule,omitempty"`
+	EndpointID         string            `json:"endpointId,omitempty" yaml:"endpointId,omitempty"`
+	EndpointDimensions map[string]string `json:"endpointDimensions,omitempty" yaml:"endpointDimensions,omitempty"`
+	Config             interface{}       `json:"config" yaml:"config"`
+}
+
+// EndpointStatus is a structured form of an endpoint in
+// EndpointsDiagnosticText
+type EndpointStatus struct {
+	ID        string                 `json:"id" yaml:"id"`
+	Monitored bool                   `json:"monitored" yaml:"monitored"`
+	Variables map[string]interface{} `json:"variables" yaml:"variables"`
+}
+
+// SummaryStatus returns the same information as SummaryDiagnosticText in a
+// structured form.
+func (mm *MonitorManager) SummaryStatus() *MonitorsSummary {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	summary := &MonitorsSummary{
+		ActiveMonitors:      len(mm.activeMonitors),
+		ConfiguredMonitors:  len(mm.monitorConfigs),
+		DiscoveredEndpoints: len(mm.discoveredEndpoints),
+		BadConfigs:          []BadMonitorConfigStatus{},
+	}
+	for hash, conf := range mm.badConfigs {
+		summary.BadConfigs = append(summary.BadConfigs, BadMonitorConfigStatus{
+			Type:       conf.Type,
+			ConfigHash: fmt.Sprintf("%d", hash),
+			Error:      conf.ValidationError,
+		})
+	}
+	sort.Slice(summary.BadConfigs, func(i, j int) bool {
+		return summary.BadConfigs[i].ConfigHash < summary.BadConfigs[j].ConfigHash
+	})
+	return summary
+}
+
+// ActiveMonitorsStatus returns the same information as DiagnosticText in a
+// structured form.
+func (mm *MonitorManager) ActiveMonitorsStatus() []ActiveMonitorStatus {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	out := make([]ActiveMonitorStatus, 0, len(mm.activeMonitors))
+	for i := range mm.activeMonitors {
+		am := mm.activeMonitors[i]
+		coreConf := am.config.MonitorConfigCore()
+
+		status := ActiveMonitorStatus{
+			ID:              string(coreConf.MonitorID),
+			Type:            coreConf.Type,
+			ConfigHash:      fmt.Sprintf("%d", am.configHash),
+			IntervalSeconds: coreConf.IntervalSeconds,
+			EnabledMetrics:  am.output.EnabledMetrics(),
+			Config:          config.ToMap(am.config),
+		}
+		if am.endpoint != nil {
+			status.DiscoveryRule = coreConf.DiscoveryRule
+			status.EndpointID = string(am.endpoint.Core().ID)
+			status.EndpointDimensions = am.endpoint.Dimensions()
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
+// EndpointsStatus returns the same information as EndpointsDiagnosticText in
+// a structured form.
+func (mm *MonitorManager) EndpointsStatus() []EndpointStatus {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	out := make([]EndpointStatus, 0, len(mm.discoveredEndpoints))
+	for _, endpoint := range mm.discoveredEndpoints {
+		out = append(out, EndpointStatus{
+			ID:        string(endpoint.Core().ID),
+			Monitored: mm.isEndpointMonitored(endpoint),
+			Variables: services.EndpointAsMap(endpoint),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// DebugDiscoveryRule evaluates the discovery rule against all of the currently
+// discovered endpoints and returns the details of each evaluation, sorted by
+// endpoint id.
+func (mm *MonitorManager) DebugDiscoveryRule(rule string) ([]*services.RuleEvaluation, error) {
+	if err := services.ValidateDiscoveryRule(rule); err != nil {
+		return nil, err
+	}
+
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	out := make([]*services.RuleEvaluation, 0, len(mm.discoveredEndpoints))
+	for _, endpoint := range mm.discoveredEndpoints {
+		out = append(out, services.DebugRule(endpoint, rule))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].EndpointID < out[j].EndpointID
+	})
+	return out, nil
+}
+
 // InternalMetrics returns a list of datapoints about the internal status of
 // the monitors
 func (mm *MonitorManager) InternalMetrics() []*datapoint.Datapoint {
-	return []*datapoint.Datapoint{
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	dps := []*datapoint.Datapoint{
 		sfxclient.Gauge("sfxagent.active_monitors", nil, int64(len(mm.activeMonitors))),
 		sfxclient.Gauge("sfxagent.configured_monitors", nil, int64(len(mm.monitorConfigs))),
 		sfxclient.Gauge("sfxagent.discovered_endpoints", nil, int64(len(mm.discoveredEndpoints))),
 		sfxclient.Gauge("sfxagent.k8s_leader", map[string]string{"leader_node": leadership.CurrentLeader()}, 1),
 	}
+
+	for i := range mm.activeMonitors {
+		am := mm.activeMonitors[i]
+		provider, ok := am.instance.(InternalMetricsProvider)
+		if !ok {
+			continue
+		}
+		monitorDims := map[string]string{
+			"monitor_type": am.config.MonitorConfigCore().Type,
+			"monitor_id":   string(am.id),
+		}
+		for _, dp := range provider.InternalMetrics() {
+			dp.Dimensions = utils.MergeStringMaps(dp.Dimensions, monitorDims)
+			dps = append(dps, dp)
+		}
+	}
+	return dps
 }
@@ -29,4 +29,10 @@
 // information returned by the AgentMeta methods could change at any time, so
 // monitors should call those methods each time it needs that information
 // instead of caching it.
+//
+// Monitors that need more information about the endpoint they were created
+// for than what gets merged into their config can specify a field on their
+// main monitor type called "Endpoint" of the type services.Endpoint.  It will
+// be set before Configure is called if the monitor was created from a
+// discovered endpoint, and left nil otherwise.
 package monitors
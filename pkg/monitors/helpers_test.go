@@ -2,6 +2,7 @@ package monitors
 
 import (
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
 	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
 )
 
@@ -78,6 +79,7 @@ func (m *_MockMonitor) Shutdown() {
 
 type _MockServiceMonitor struct {
 	_MockMonitor
+	Endpoint services.Endpoint
 }
 
 func (m *_MockServiceMonitor) Configure(conf *DynamicConfig) error {
@@ -107,6 +107,22 @@ var _ = Describe("Monitor Manager", func() {
 		Expect(len(mons)).To(Equal(1))
 	})
 
+	It("Injects the endpoint into dynamic monitors", func() {
+		manager.Configure([]config.MonitorConfig{
+			{
+				Type:          "dynamic1",
+				DiscoveryRule: `container_image =~ "my-service"`,
+			},
+		}, &config.CollectdConfig{}, 10)
+
+		service := newService("my-service", 5000)
+		manager.EndpointAdded(service)
+
+		mons := findMonitorsByType(getMonitors(), "dynamic1")
+		Expect(len(mons)).To(Equal(1))
+		Expect(mons[0].(*_MockServiceMonitor).Endpoint).To(Equal(service))
+	})
+
 	It("Shuts down dynamic monitors upon service removed", func() {
 		manager.Configure([]config.MonitorConfig{
 			{
@@ -146,6 +146,14 @@ type Shutdownable interface {
 	Shutdown()
 }
 
+// InternalMetricsProvider can be implemented by monitors that want to expose
+// metrics about their own operation.  The datapoints are included in the
+// agent's internal metrics with the monitor_type and monitor_id dimensions
+// added.
+type InternalMetricsProvider interface {
+	InternalMetrics() []*datapoint.Datapoint
+}
+
 // Takes a generic MonitorConfig and pulls out monitor-specific config to
 // populate a clone of the config template that was registered for the monitor
 // type specified in conf.  This will also validate the config and return nil
@@ -173,6 +181,16 @@ func anyMarkedSolo(confs []config.MonitorConfig) bool {
 	return false
 }
 
+// OnlyAllowsSingleInstance returns true if the given monitor type can only
+// have one instance configured at a time.
+func OnlyAllowsSingleInstance(monitorType string) bool {
+	confTemplate, ok := ConfigTemplates[monitorType]
+	if !ok {
+		return false
+	}
+	return configOnlyAllowsSingleInstance(confTemplate)
+}
+
 func configOnlyAllowsSingleInstance(monConfig config.MonitorCustomConfig) bool {
 	confVal := reflect.Indirect(reflect.ValueOf(monConfig))
 	coreConfField, ok := confVal.Type().FieldByName("MonitorConfig")
@@ -6,6 +6,7 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	"github.com/signalfx/golib/v3/datapoint"
 	"github.com/signalfx/golib/v3/sfxclient"
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
 
@@ -32,7 +33,11 @@ func convertMetricFamily(mf *dto.MetricFamily) []*datapoint.Datapoint {
 	case dto.MetricType_GAUGE:
 		return makeSimpleDatapoints(*mf.Name, mf.Metric, sfxclient.GaugeF, gaugeExtractor)
 	case dto.MetricType_COUNTER:
-		return makeSimpleDatapoints(*mf.Name, mf.Metric, sfxclient.CumulativeF, counterExtractor)
+		dps := makeSimpleDatapoints(*mf.Name, mf.Metric, sfxclient.CumulativeF, counterExtractor)
+		for i, m := range mf.Metric {
+			attachExemplar(dps[i], m.GetCounter().GetExemplar())
+		}
+		return dps
 	case dto.MetricType_UNTYPED:
 		return makeSimpleDatapoints(*mf.Name, mf.Metric, sfxclient.GaugeF, untypedExtractor)
 	case dto.MetricType_SUMMARY:
@@ -40,7 +45,9 @@ func convertMetricFamily(mf *dto.MetricFamily) []*datapoint.Datapoint {
 	// TODO: figure out how to best convert histograms, in particular the
 	// upper bound value
 	case dto.MetricType_HISTOGRAM:
-		return makeHistogramDatapoints(*mf.Name, mf.Metric)
+		return makeHistogramDatapoints(*mf.Name, mf.Metric, true)
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		return makeGaugeHistogramDatapoints(*mf.Name, mf.Metric)
 	default:
 		return nil
 	}
@@ -82,7 +89,9 @@ func makeSummaryDatapoints(name string, ms []*dto.Metric) []*datapoint.Datapoint
 	return dps
 }
 
-func makeHistogramDatapoints(name string, ms []*dto.Metric) []*datapoint.Datapoint {
+// makeHistogramDatapoints converts histograms, leaving out the per-bucket
+// counters if includeBuckets is false.
+func makeHistogramDatapoints(name string, ms []*dto.Metric, includeBuckets bool) []*datapoint.Datapoint {
 	var dps []*datapoint.Datapoint
 	for _, m := range ms {
 		dims := labelsToDims(m.Label)
@@ -99,17 +108,84 @@ func makeHistogramDatapoints(name string, ms []*dto.Metric) []*datapoint.Datapoi
 			dps = append(dps, sfxclient.CumulativeF(name, dims, h.GetSampleSum()))
 		}
 
+		if !includeBuckets {
+			continue
+		}
+
 		buckets := h.GetBucket()
 		for i := range buckets {
 			bucketDims := utils.MergeStringMaps(dims, map[string]string{
 				"upper_bound": strconv.FormatFloat(buckets[i].GetUpperBound(), 'f', 6, 64),
 			})
-			dps = append(dps, sfxclient.Cumulative(name+"_bucket", bucketDims, int64(buckets[i].GetCumulativeCount())))
+			dp := sfxclient.Cumulative(name+"_bucket", bucketDims, int64(buckets[i].GetCumulativeCount()))
+			attachExemplar(dp, buckets[i].GetExemplar())
+			dps = append(dps, dp)
 		}
 	}
 	return dps
 }
 
+// makeGaugeHistogramDatapoints converts OpenMetrics gauge histograms, whose
+// buckets can go down as well as up, so everything is sent as gauges.
+func makeGaugeHistogramDatapoints(name string, ms []*dto.Metric) []*datapoint.Datapoint {
+	var dps []*datapoint.Datapoint
+	for _, m := range ms {
+		dims := labelsToDims(m.Label)
+		h := m.GetHistogram()
+		if h == nil {
+			continue
+		}
+
+		if h.SampleCount != nil {
+			dps = append(dps, sfxclient.Gauge(name+"_gcount", dims, int64(h.GetSampleCount())))
+		}
+
+		if h.SampleSum != nil {
+			dps = append(dps, sfxclient.GaugeF(name+"_gsum", dims, h.GetSampleSum()))
+		}
+
+		buckets := h.GetBucket()
+		for i := range buckets {
+			bucketDims := utils.MergeStringMaps(dims, map[string]string{
+				"upper_bound": strconv.FormatFloat(buckets[i].GetUpperBound(), 'f', 6, 64),
+			})
+			dp := sfxclient.Gauge(name+"_bucket", bucketDims, int64(buckets[i].GetCumulativeCount()))
+			attachExemplar(dp, buckets[i].GetExemplar())
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+// attachExemplar puts the exemplar, if any, in the datapoint's meta so that
+// writers that support exemplars can send it.  The `trace_id` and `span_id`
+// labels are used to link the exemplar to a trace.
+func attachExemplar(dp *datapoint.Datapoint, ex *dto.Exemplar) {
+	if ex == nil {
+		return
+	}
+
+	labels := labelsToDims(ex.Label)
+	out := &dpmeta.Exemplar{
+		TraceID: labels["trace_id"],
+		SpanID:  labels["span_id"],
+		Value:   ex.GetValue(),
+	}
+	delete(labels, "trace_id")
+	delete(labels, "span_id")
+	if len(labels) > 0 {
+		out.Labels = labels
+	}
+	if ex.Timestamp != nil {
+		out.Timestamp = ex.Timestamp.AsTime()
+	}
+
+	if dp.Meta == nil {
+		dp.Meta = map[interface{}]interface{}{}
+	}
+	dp.Meta[dpmeta.ExemplarMeta] = out
+}
+
 func labelsToDims(labels []*dto.LabelPair) map[string]string {
 	dims := map[string]string{}
 	for i := range labels {
@@ -3,6 +3,7 @@
 package prometheusexporter
 
 import (
+	"github.com/signalfx/golib/v3/datapoint"
 	"github.com/signalfx/signalfx-agent/pkg/monitors"
 )
 
@@ -10,7 +11,17 @@ const monitorType = "prometheus-exporter"
 
 var groupSet = map[string]bool{}
 
-var metricSet = map[string]monitors.MetricInfo{}
+const (
+	scrapeDurationSeconds = "scrape_duration_seconds"
+	scrapeSamplesScraped  = "scrape_samples_scraped"
+	up                    = "up"
+)
+
+var metricSet = map[string]monitors.MetricInfo{
+	scrapeDurationSeconds: {Type: datapoint.Gauge},
+	scrapeSamplesScraped:  {Type: datapoint.Gauge},
+	up:                    {Type: datapoint.Gauge},
+}
 
 var defaultMetrics = map[string]bool{}
 
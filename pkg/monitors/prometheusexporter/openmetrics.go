@@ -0,0 +1,432 @@
+package prometheusexporter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The sample name suffixes that are allowed for each OpenMetrics type
+var openMetricsSuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"gauge":          {""},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"", "_count", "_sum", "_created"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// omFamily accumulates the samples of a single OpenMetrics metric family
+type omFamily struct {
+	name string
+	typ  string
+	help string
+
+	// The series of the family keyed by their labels, excluding `le` and
+	// `quantile`
+	series      map[string]*dto.Metric
+	seriesOrder []string
+	// The `_created` samples, which are sent as a separate gauge
+	created []*dto.Metric
+}
+
+func newOMFamily(name, typ string) *omFamily {
+	return &omFamily{
+		name:   name,
+		typ:    typ,
+		series: map[string]*dto.Metric{},
+	}
+}
+
+// parseOpenMetrics parses the OpenMetrics text format into metric families
+// so that they can be converted the same way as the classic formats.
+// Counters are named with their `_total` suffix and info metrics with their
+// `_info` suffix so that they match the series names.  `_created` samples are
+// put into their own gauge family.
+func parseOpenMetrics(r io.Reader) ([]*dto.MetricFamily, error) {
+	var out []*dto.MetricFamily
+	var fam *omFamily
+
+	finish := func() {
+		if fam != nil {
+			out = append(out, fam.toMetricFamilies()...)
+		}
+		fam = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	sawEOF := false
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if sawEOF {
+			return nil, errors.New("unexpected content after # EOF")
+		}
+
+		switch {
+		case line == "":
+			continue
+		case line == "# EOF":
+			sawEOF = true
+		case strings.HasPrefix(line, "# "):
+			parts := strings.SplitN(line[2:], " ", 3)
+			if len(parts) < 3 {
+				continue
+			}
+			switch parts[0] {
+			case "TYPE":
+				if _, ok := openMetricsSuffixes[parts[2]]; !ok {
+					return nil, fmt.Errorf("line %d: unknown metric type %q", lineNum, parts[2])
+				}
+				if fam == nil || fam.name != parts[1] || len(fam.series) > 0 {
+					finish()
+					fam = newOMFamily(parts[1], parts[2])
+				} else {
+					fam.typ = parts[2]
+				}
+			case "HELP":
+				if fam == nil || fam.name != parts[1] || len(fam.series) > 0 {
+					finish()
+					fam = newOMFamily(parts[1], "unknown")
+				}
+				fam.help = unescapeOpenMetrics(parts[2])
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			s, err := parseOpenMetricsSample(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+
+			suffix, ok := fam.matchSuffix(s.name)
+			if !ok {
+				// Samples without metadata are of the unknown type
+				finish()
+				fam = newOMFamily(s.name, "unknown")
+				suffix = ""
+			}
+			if err := fam.addSample(s, suffix); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !sawEOF {
+		return nil, errors.New("missing # EOF at end of OpenMetrics response")
+	}
+
+	finish()
+	return out, nil
+}
+
+// matchSuffix returns the suffix of the sample name if it belongs to the
+// family.
+func (f *omFamily) matchSuffix(name string) (string, bool) {
+	if f == nil || !strings.HasPrefix(name, f.name) {
+		return "", false
+	}
+	for _, suffix := range openMetricsSuffixes[f.typ] {
+		if name == f.name+suffix {
+			return suffix, true
+		}
+	}
+	return "", false
+}
+
+func (f *omFamily) addSample(s *omSample, suffix string) error {
+	if suffix == "_created" {
+		f.created = append(f.created, &dto.Metric{
+			Label:       labelPairsFromMap(s.labels),
+			Gauge:       &dto.Gauge{Value: &s.value},
+			TimestampMs: s.timestampMs,
+		})
+		return nil
+	}
+
+	var le, quantile string
+	if f.typ == "histogram" || f.typ == "gaugehistogram" {
+		le = s.labels["le"]
+		delete(s.labels, "le")
+	}
+	if f.typ == "summary" {
+		quantile = s.labels["quantile"]
+		delete(s.labels, "quantile")
+	}
+
+	m := f.getSeries(s.labels)
+	if s.timestampMs != nil {
+		m.TimestampMs = s.timestampMs
+	}
+
+	switch f.typ {
+	case "counter":
+		m.Counter = &dto.Counter{Value: &s.value, Exemplar: s.exemplar}
+	case "gauge", "info", "stateset":
+		m.Gauge = &dto.Gauge{Value: &s.value}
+	case "unknown":
+		m.Untyped = &dto.Untyped{Value: &s.value}
+	case "summary":
+		if m.Summary == nil {
+			m.Summary = &dto.Summary{}
+		}
+		switch suffix {
+		case "_count":
+			count := uint64(s.value)
+			m.Summary.SampleCount = &count
+		case "_sum":
+			m.Summary.SampleSum = &s.value
+		default:
+			q, err := strconv.ParseFloat(quantile, 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantile %q", quantile)
+			}
+			m.Summary.Quantile = append(m.Summary.Quantile, &dto.Quantile{Quantile: &q, Value: &s.value})
+		}
+	case "histogram", "gaugehistogram":
+		if m.Histogram == nil {
+			m.Histogram = &dto.Histogram{}
+		}
+		switch suffix {
+		case "_count", "_gcount":
+			count := uint64(s.value)
+			m.Histogram.SampleCount = &count
+		case "_sum", "_gsum":
+			m.Histogram.SampleSum = &s.value
+		default:
+			upperBound, err := strconv.ParseFloat(le, 64)
+			if err != nil {
+				return fmt.Errorf("invalid bucket le %q", le)
+			}
+			count := uint64(s.value)
+			m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+				CumulativeCount: &count,
+				UpperBound:      &upperBound,
+				Exemplar:        s.exemplar,
+			})
+		}
+	}
+	return nil
+}
+
+func (f *omFamily) getSeries(labels map[string]string) *dto.Metric {
+	pairs := labelPairsFromMap(labels)
+
+	var sb strings.Builder
+	for _, lp := range pairs {
+		sb.WriteString(lp.GetName())
+		sb.WriteString("=")
+		sb.WriteString(strconv.Quote(lp.GetValue()))
+		sb.WriteString(",")
+	}
+	key := sb.String()
+
+	m, ok := f.series[key]
+	if !ok {
+		m = &dto.Metric{Label: pairs}
+		f.series[key] = m
+		f.seriesOrder = append(f.seriesOrder, key)
+	}
+	return m
+}
+
+func (f *omFamily) toMetricFamilies() []*dto.MetricFamily {
+	name := f.name
+	var typ dto.MetricType
+	switch f.typ {
+	case "counter":
+		name += "_total"
+		typ = dto.MetricType_COUNTER
+	case "gauge", "stateset":
+		typ = dto.MetricType_GAUGE
+	case "info":
+		name += "_info"
+		typ = dto.MetricType_GAUGE
+	case "summary":
+		typ = dto.MetricType_SUMMARY
+	case "histogram":
+		typ = dto.MetricType_HISTOGRAM
+	case "gaugehistogram":
+		typ = dto.MetricType_GAUGE_HISTOGRAM
+	default:
+		typ = dto.MetricType_UNTYPED
+	}
+
+	var out []*dto.MetricFamily
+	if len(f.series) > 0 {
+		mf := &dto.MetricFamily{Name: &name, Type: &typ}
+		if f.help != "" {
+			mf.Help = &f.help
+		}
+		for _, key := range f.seriesOrder {
+			mf.Metric = append(mf.Metric, f.series[key])
+		}
+		out = append(out, mf)
+	}
+
+	if len(f.created) > 0 {
+		createdName := f.name + "_created"
+		gaugeType := dto.MetricType_GAUGE
+		out = append(out, &dto.MetricFamily{Name: &createdName, Type: &gaugeType, Metric: f.created})
+	}
+	return out
+}
+
+type omSample struct {
+	name        string
+	labels      map[string]string
+	value       float64
+	timestampMs *int64
+	exemplar    *dto.Exemplar
+}
+
+// parseOpenMetricsSample parses a line of the form
+// `name{label="value",...} value [timestamp] [# {label="value"} value [timestamp]]`
+func parseOpenMetricsSample(line string) (*omSample, error) {
+	s := &omSample{labels: map[string]string{}}
+
+	nameEnd := strings.IndexAny(line, "{ ")
+	if nameEnd <= 0 {
+		return nil, fmt.Errorf("invalid sample %q", line)
+	}
+	s.name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	var err error
+	if strings.HasPrefix(rest, "{") {
+		s.labels, rest, err = parseOpenMetricsLabels(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var exemplarText string
+	if idx := strings.Index(rest, " # "); idx >= 0 {
+		exemplarText = strings.TrimSpace(rest[idx+3:])
+		rest = rest[:idx]
+	}
+
+	s.value, s.timestampMs, err = parseValueAndTimestamp(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	if exemplarText != "" {
+		s.exemplar, err = parseOpenMetricsExemplar(exemplarText)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func parseOpenMetricsExemplar(text string) (*dto.Exemplar, error) {
+	if !strings.HasPrefix(text, "{") {
+		return nil, fmt.Errorf("invalid exemplar %q", text)
+	}
+	labels, rest, err := parseOpenMetricsLabels(text)
+	if err != nil {
+		return nil, err
+	}
+	value, timestampMs, err := parseValueAndTimestamp(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar: %v", err)
+	}
+
+	ex := &dto.Exemplar{Label: labelPairsFromMap(labels), Value: &value}
+	if timestampMs != nil {
+		ex.Timestamp = timestamppb.New(time.Unix(0, *timestampMs*int64(time.Millisecond)))
+	}
+	return ex, nil
+}
+
+// parseValueAndTimestamp parses the value and optional timestamp, which is
+// in seconds in OpenMetrics, and returns the timestamp in milliseconds.
+func parseValueAndTimestamp(text string) (float64, *int64, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, nil, fmt.Errorf("invalid value and timestamp %q", text)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid value %q", fields[0])
+	}
+
+	if len(fields) == 1 {
+		return value, nil, nil
+	}
+
+	ts, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	tsMs := int64(math.Round(ts * 1000))
+	return value, &tsMs, nil
+}
+
+// parseOpenMetricsLabels parses a label set starting with `{` and returns
+// the text after the closing `}`.
+func parseOpenMetricsLabels(text string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	i := 1
+	for {
+		if i >= len(text) {
+			return nil, "", errors.New("unterminated label set")
+		}
+		if text[i] == '}' {
+			return labels, text[i+1:], nil
+		}
+
+		eq := strings.Index(text[i:], "=\"")
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label set %q", text)
+		}
+		name := text[i : i+eq]
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			value.WriteByte(text[i])
+		}
+		if i >= len(text) {
+			return nil, "", errors.New("unterminated label value")
+		}
+		labels[name] = value.String()
+		i++
+
+		if i < len(text) && text[i] == ',' {
+			i++
+		}
+	}
+}
+
+func unescapeOpenMetrics(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(s)
+}
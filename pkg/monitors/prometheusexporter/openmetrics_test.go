@@ -0,0 +1,170 @@
+package prometheusexporter
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/dpmeta"
+)
+
+const openMetricsExample = `# TYPE http_requests counter
+# HELP http_requests The number of requests
+http_requests_total{code="200"} 10 # {trace_id="0af7651916cd43dd8448eb211c80319c",span_id="b7ad6b7169203331",user="bob"} 1 1600000000.5
+http_requests_created{code="200"} 1600000000
+http_requests_total{code="500"} 2
+# TYPE build info
+build_info{version="1.2\"3"} 1
+# TYPE door stateset
+door{door="open"} 1
+door{door="closed"} 0
+# TYPE request_seconds histogram
+request_seconds_bucket{le="0.5"} 3 # {trace_id="abc"} 0.2
+request_seconds_bucket{le="+Inf"} 4
+request_seconds_count 4
+request_seconds_sum 2.5
+# TYPE queue_size gaugehistogram
+queue_size_bucket{le="10"} 5
+queue_size_bucket{le="+Inf"} 6
+queue_size_gcount 6
+queue_size_gsum 30
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.9"} 1.5
+rpc_seconds_count 10
+rpc_seconds_sum 7
+# TYPE temp gauge
+temp{room="a b"} 21.5 1600000000
+mystery 3
+# EOF
+`
+
+func TestParseOpenMetrics(t *testing.T) {
+	t.Run("families", func(t *testing.T) {
+		mfs, err := parseOpenMetrics(strings.NewReader(openMetricsExample))
+		require.Nil(t, err)
+
+		byName := map[string]*dto.MetricFamily{}
+		for _, mf := range mfs {
+			byName[mf.GetName()] = mf
+		}
+		require.Len(t, byName, 9)
+
+		requests := byName["http_requests_total"]
+		require.Equal(t, dto.MetricType_COUNTER, requests.GetType())
+		require.Equal(t, "The number of requests", requests.GetHelp())
+		require.Len(t, requests.Metric, 2)
+		ex := requests.Metric[0].GetCounter().GetExemplar()
+		require.NotNil(t, ex)
+		require.Equal(t, 1.0, ex.GetValue())
+		require.Equal(t, int64(1600000000500), ex.GetTimestamp().AsTime().UnixNano()/int64(time.Millisecond))
+		require.Nil(t, requests.Metric[1].GetCounter().GetExemplar())
+
+		require.Equal(t, dto.MetricType_GAUGE, byName["http_requests_created"].GetType())
+		require.Equal(t, 1600000000.0, byName["http_requests_created"].Metric[0].GetGauge().GetValue())
+
+		info := byName["build_info"]
+		require.Equal(t, dto.MetricType_GAUGE, info.GetType())
+		require.Equal(t, `1.2"3`, info.Metric[0].Label[0].GetValue())
+
+		require.Len(t, byName["door"].Metric, 2)
+
+		hist := byName["request_seconds"].Metric[0].GetHistogram()
+		require.Equal(t, uint64(4), hist.GetSampleCount())
+		require.Equal(t, 2.5, hist.GetSampleSum())
+		require.Len(t, hist.Bucket, 2)
+		require.NotNil(t, hist.Bucket[0].GetExemplar())
+
+		require.Equal(t, dto.MetricType_GAUGE_HISTOGRAM, byName["queue_size"].GetType())
+		require.Equal(t, 30.0, byName["queue_size"].Metric[0].GetHistogram().GetSampleSum())
+
+		summary := byName["rpc_seconds"].Metric[0].GetSummary()
+		require.Equal(t, uint64(10), summary.GetSampleCount())
+		require.Equal(t, 0.9, summary.Quantile[0].GetQuantile())
+
+		require.Equal(t, int64(1600000000000), byName["temp"].Metric[0].GetTimestampMs())
+		require.Equal(t, "a b", byName["temp"].Metric[0].Label[0].GetValue())
+
+		require.Equal(t, dto.MetricType_UNTYPED, byName["mystery"].GetType())
+	})
+
+	t.Run("missing EOF", func(t *testing.T) {
+		_, err := parseOpenMetrics(strings.NewReader("# TYPE a gauge\na 1\n"))
+		require.NotNil(t, err)
+	})
+
+	t.Run("invalid sample", func(t *testing.T) {
+		_, err := parseOpenMetrics(strings.NewReader("# TYPE a gauge\na{b=\"c} 1\n# EOF\n"))
+		require.NotNil(t, err)
+	})
+
+	t.Run("response format", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		require.Equal(t, expfmt.FmtOpenMetrics, responseFormat(h))
+		h.Set("Content-Type", "text/plain; version=0.0.4")
+		require.Equal(t, expfmt.FmtText, responseFormat(h))
+	})
+}
+
+func TestOpenMetricsConversion(t *testing.T) {
+	fetch := func() (io.ReadCloser, expfmt.Format, error) {
+		return ioutil.NopCloser(strings.NewReader(openMetricsExample)), expfmt.FmtOpenMetrics, nil
+	}
+
+	dps, samples, err := fetchPrometheusMetrics(fetch, nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, 19, samples)
+
+	var requests, bucket, queueBucket *datapoint.Datapoint
+	for _, dp := range dps {
+		switch {
+		case dp.Metric == "http_requests_total" && dp.Dimensions["code"] == "200":
+			requests = dp
+		case dp.Metric == "request_seconds_bucket" && dp.Dimensions["upper_bound"] == "0.500000":
+			bucket = dp
+		case dp.Metric == "queue_size_bucket" && dp.Dimensions["upper_bound"] == "10.000000":
+			queueBucket = dp
+		}
+	}
+
+	require.NotNil(t, requests)
+	require.Equal(t, datapoint.Counter, requests.MetricType)
+	require.Equal(t, &dpmeta.Exemplar{
+		TraceID:   "0af7651916cd43dd8448eb211c80319c",
+		SpanID:    "b7ad6b7169203331",
+		Value:     1,
+		Timestamp: time.Unix(1600000000, 500*int64(time.Millisecond)).UTC(),
+		Labels:    map[string]string{"user": "bob"},
+	}, requests.Meta[dpmeta.ExemplarMeta])
+
+	require.NotNil(t, bucket)
+	require.Equal(t, "abc", bucket.Meta[dpmeta.ExemplarMeta].(*dpmeta.Exemplar).TraceID)
+
+	require.NotNil(t, queueBucket)
+	require.Equal(t, datapoint.Gauge, queueBucket.MetricType)
+	require.Equal(t, "5", queueBucket.Value.String())
+}
+
+func TestScrapeHealthDatapoints(t *testing.T) {
+	dps := scrapeHealthDatapoints(false, 1500*time.Millisecond, 0)
+	byName := map[string]string{}
+	for _, dp := range dps {
+		require.Equal(t, datapoint.Gauge, dp.MetricType)
+		byName[dp.Metric] = dp.Value.String()
+	}
+	require.Equal(t, map[string]string{
+		"up":                      "0",
+		"scrape_duration_seconds": "1.5",
+		"scrape_samples_scraped":  "0",
+	}, byName)
+
+	require.Equal(t, "1", scrapeHealthDatapoints(true, time.Second, 10)[0].Value.String())
+}
@@ -6,19 +6,24 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
 	"github.com/sirupsen/logrus"
 	"k8s.io/client-go/rest"
 
 	"github.com/signalfx/signalfx-agent/pkg/core/common/auth"
 	"github.com/signalfx/signalfx-agent/pkg/core/common/httpclient"
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/promexport"
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
 	"github.com/signalfx/signalfx-agent/pkg/monitors"
 	"github.com/signalfx/signalfx-agent/pkg/monitors/types"
 	"github.com/signalfx/signalfx-agent/pkg/utils"
@@ -50,6 +55,57 @@ type Config struct {
 	// exporter monitor directly since there is no built-in filtering, only
 	// when embedding it in other monitors.
 	SendAllMetrics bool `yaml:"sendAllMetrics"`
+
+	// If true, the OpenMetrics exposition format will be requested from the
+	// exporter, which falls back to the classic text format if the exporter
+	// doesn't support it.  OpenMetrics responses are always parsed, whether
+	// or not this is set.
+	UseOpenMetrics bool `yaml:"useOpenMetrics"`
+
+	// If true, histograms are converted to gauges of the `histogramQuantiles`
+	// instead of a cumulative counter per bucket.  The quantiles are
+	// estimated from the change in the bucket counts since the previous
+	// scrape, so they are only sent from the second scrape onwards and only
+	// if something was observed in the interval.
+	ComputeHistogramQuantiles bool `yaml:"computeHistogramQuantiles"`
+	// The quantiles to compute when `computeHistogramQuantiles` is true.
+	// Each is sent as a gauge called `<basename>_quantile` with a `quantile`
+	// dimension, the same as summary quantiles.
+	HistogramQuantiles []float64 `yaml:"histogramQuantiles" default:"[0.5, 0.9, 0.99]"`
+	// If true, the cumulative counter of each histogram bucket is still sent
+	// when `computeHistogramQuantiles` is true.
+	SendHistogramBuckets bool `yaml:"sendHistogramBuckets"`
+
+	// Relabeling rules that are applied to the target before it is scraped,
+	// like `relabel_configs` in a Prometheus scrape config.  The target
+	// starts with the labels `__address__` (`host:port`), `__scheme__` and
+	// `__metrics_path__`, plus `__meta_<var>` for every variable of the
+	// discovered endpoint, if any.  Map variables such as `container_labels`
+	// get a `__meta_<var>_<key>` label for each key instead.  Setting
+	// `__param_<name>` adds a query param to the scrape URL.  If the target
+	// is dropped, nothing is scraped.  Any labels left on the target that
+	// don't start with `__` are added as dimensions to all datapoints.
+	RelabelConfigs []*RelabelConfig `yaml:"relabelConfigs"`
+	// Relabeling rules that are applied to each scraped series before it is
+	// converted to datapoints, like `metric_relabel_configs` in a Prometheus
+	// scrape config.  The metric name is available in the `__name__` label.
+	// For histograms and summaries, this is the base name of the metric.
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metricRelabelConfigs"`
+}
+
+// Validate the relabel configs and histogram quantiles
+func (c *Config) Validate() error {
+	for _, q := range c.HistogramQuantiles {
+		if q <= 0 || q >= 1 {
+			return fmt.Errorf("histogram quantile %v must be between 0 and 1", q)
+		}
+	}
+
+	if _, err := newRelabelers(c.RelabelConfigs); err != nil {
+		return err
+	}
+	_, err := newRelabelers(c.MetricRelabelConfigs)
+	return err
 }
 
 func (c *Config) GetExtraMetrics() []string {
@@ -73,6 +129,9 @@ type Monitor struct {
 	ExtraDimensions map[string]string
 	// If true, IncludedMetrics is ignored and everything is sent.
 	SendAll bool
+	// The discovered endpoint that is being scraped, if any.  This gets
+	// injected by the monitor manager.
+	Endpoint services.Endpoint
 
 	monitorName string
 	logger      logrus.FieldLogger
@@ -81,6 +140,10 @@ type Monitor struct {
 
 type fetcher func() (io.ReadCloser, expfmt.Format, error)
 
+// The Accept header that is sent when useOpenMetrics is true, which matches
+// what Prometheus sends
+const openMetricsAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
 // Configure the monitor and kick off volume metric syncing
 func (m *Monitor) Configure(conf *Config) error {
 	m.logger = logrus.WithFields(logrus.Fields{"monitorType": m.monitorName, "monitorID": conf.MonitorID})
@@ -110,13 +173,35 @@ func (m *Monitor) Configure(conf *Config) error {
 		}
 	}
 
-	url := fmt.Sprintf("%s://%s:%d%s", conf.Scheme(), conf.Host, conf.Port, conf.MetricPath)
+	targetRelabelers, err := newRelabelers(conf.RelabelConfigs)
+	if err != nil {
+		return err
+	}
+	metricRelabelers, err := newRelabelers(conf.MetricRelabelConfigs)
+	if err != nil {
+		return err
+	}
+
+	target := m.targetLabels(conf)
+	if !relabel(target, targetRelabelers) {
+		m.logger.Info("Target was dropped by relabelConfigs, not scraping")
+		return nil
+	}
+	scrapeURL, targetDims := targetURLAndDims(target)
+
+	var quantiler *histogramQuantiler
+	if conf.ComputeHistogramQuantiles {
+		quantiler = newHistogramQuantiler(conf.HistogramQuantiles, conf.SendHistogramBuckets)
+	}
 
 	fetch := func() (io.ReadCloser, expfmt.Format, error) {
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequest("GET", scrapeURL, nil)
 		if err != nil {
 			return nil, expfmt.FmtUnknown, err
 		}
+		if _, ok := conf.HTTPHeaders["Accept"]; conf.UseOpenMetrics && !ok {
+			req.Header.Set("Accept", openMetricsAccept)
+		}
 
 		resp, err := client.Do(req) // nolint:bodyclose  // We do actually close it after it is returned
 		if err != nil {
@@ -125,19 +210,24 @@ func (m *Monitor) Configure(conf *Config) error {
 
 		if resp.StatusCode != 200 {
 			body, _ := ioutil.ReadAll(resp.Body)
-			return nil, expfmt.FmtUnknown, fmt.Errorf("prometheus exporter at %s returned status %d: %s", url, resp.StatusCode, string(body))
+			return nil, expfmt.FmtUnknown, fmt.Errorf("prometheus exporter at %s returned status %d: %s", scrapeURL, resp.StatusCode, string(body))
 		}
 
-		return resp.Body, expfmt.ResponseFormat(resp.Header), nil
+		return resp.Body, responseFormat(resp.Header), nil
 	}
 
 	var ctx context.Context
 	ctx, m.cancel = context.WithCancel(context.Background())
 	utils.RunOnInterval(ctx, func() {
-		dps, err := fetchPrometheusMetrics(fetch)
+		start := time.Now()
+		dps, samples, err := fetchPrometheusMetrics(fetch, metricRelabelers, quantiler)
 		if err != nil {
 			m.logger.WithError(err).Error("Could not get prometheus metrics")
-			return
+		}
+		dps = append(dps, scrapeHealthDatapoints(err == nil, time.Since(start), samples)...)
+
+		for i := range dps {
+			dps[i].Dimensions = utils.MergeStringMaps(dps[i].Dimensions, targetDims)
 		}
 
 		m.Output.SendDatapoints(dps...)
@@ -146,17 +236,123 @@ func (m *Monitor) Configure(conf *Config) error {
 	return nil
 }
 
-func fetchPrometheusMetrics(fetch fetcher) ([]*datapoint.Datapoint, error) {
+// targetLabels returns the labels of the scrape target before relabeling
+func (m *Monitor) targetLabels(conf *Config) map[string]string {
+	labels := map[string]string{
+		addressLabel:     fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+		schemeLabel:      conf.Scheme(),
+		metricsPathLabel: conf.MetricPath,
+	}
+
+	if m.Endpoint != nil {
+		for k, v := range services.EndpointAsMap(m.Endpoint) {
+			name := metaLabelPrefix + promexport.SanitizeLabelName(k)
+			switch val := v.(type) {
+			case nil:
+				continue
+			case map[string]string:
+				// Maps such as container labels get a label per key
+				for mk, mv := range val {
+					labels[name+"_"+promexport.SanitizeLabelName(mk)] = mv
+				}
+			default:
+				labels[name] = fmt.Sprintf("%v", val)
+			}
+		}
+	}
+	return labels
+}
+
+// targetURLAndDims determines the URL to scrape from the special labels of
+// the relabeled target.  All of the non-special labels are returned as
+// dimensions.
+func targetURLAndDims(target map[string]string) (string, map[string]string) {
+	params := url.Values{}
+	dims := map[string]string{}
+	for k, v := range target {
+		switch {
+		case strings.HasPrefix(k, paramLabelPrefix):
+			params.Set(strings.TrimPrefix(k, paramLabelPrefix), v)
+		case !strings.HasPrefix(k, "__"):
+			dims[k] = v
+		}
+	}
+
+	u := fmt.Sprintf("%s://%s%s", target[schemeLabel], target[addressLabel], target[metricsPathLabel])
+	if len(params) > 0 {
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + params.Encode()
+	}
+	return u, dims
+}
+
+// fetchPrometheusMetrics scrapes and converts the metrics, also returning
+// the number of samples that were scraped before metric relabeling.  If
+// quantiler is not nil, it is used to convert histograms.
+func fetchPrometheusMetrics(fetch fetcher, metricRelabelers []*relabeler, quantiler *histogramQuantiler) ([]*datapoint.Datapoint, int, error) {
 	metricFamilies, err := doFetch(fetch)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	samples := countSamples(metricFamilies)
+	metricFamilies = relabelMetricFamilies(metricFamilies, metricRelabelers)
+
+	if quantiler != nil {
+		return quantiler.Convert(metricFamilies), samples, nil
 	}
 
 	var dps []*datapoint.Datapoint
 	for i := range metricFamilies {
 		dps = append(dps, convertMetricFamily(metricFamilies[i])...)
 	}
-	return dps, nil
+	return dps, samples, nil
+}
+
+// countSamples counts the samples in the metric families the same way as
+// Prometheus does, where each histogram bucket and summary quantile, as well
+// as the sum and count, is a separate sample.
+func countSamples(mfs []*dto.MetricFamily) int {
+	var count int
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch {
+			case m.Histogram != nil:
+				count += len(m.Histogram.Bucket) + 2
+			case m.Summary != nil:
+				count += len(m.Summary.Quantile) + 2
+			default:
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// scrapeHealthDatapoints makes the synthetic datapoints about a scrape that
+// are sent even if the scrape failed.
+func scrapeHealthDatapoints(success bool, duration time.Duration, samples int) []*datapoint.Datapoint {
+	var upValue int64
+	if success {
+		upValue = 1
+	}
+	return []*datapoint.Datapoint{
+		sfxclient.Gauge(up, nil, upValue),
+		sfxclient.GaugeF(scrapeDurationSeconds, nil, duration.Seconds()),
+		sfxclient.Gauge(scrapeSamplesScraped, nil, int64(samples)),
+	}
+}
+
+// responseFormat determines the format of the response from its content
+// type.  The expfmt package doesn't know about OpenMetrics.
+func responseFormat(h http.Header) expfmt.Format {
+	mediatype, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err == nil && mediatype == expfmt.OpenMetricsType {
+		return expfmt.FmtOpenMetrics
+	}
+	return expfmt.ResponseFormat(h)
 }
 
 func doFetch(fetch fetcher) ([]*dto.MetricFamily, error) {
@@ -165,6 +361,11 @@ func doFetch(fetch fetcher) ([]*dto.MetricFamily, error) {
 		return nil, err
 	}
 	defer body.Close()
+
+	if expformat == expfmt.FmtOpenMetrics {
+		return parseOpenMetrics(body)
+	}
+
 	var decoder expfmt.Decoder
 	// some "text" responses are missing \n from the last line
 	if expformat != expfmt.FmtProtoDelim {
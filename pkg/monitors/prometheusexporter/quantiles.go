@@ -0,0 +1,180 @@
+package prometheusexporter
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// histogramQuantiler converts histograms to gauges of quantiles that are
+// computed from the change in the bucket counts since the previous scrape,
+// so that the quantiles reflect only the observations made in the last
+// interval.  It is only used from the scrape goroutine so it needs no
+// locking.
+type histogramQuantiler struct {
+	quantiles   []float64
+	sendBuckets bool
+	// The buckets of each histogram series from the previous scrape
+	lastBuckets map[string][]*dto.Bucket
+}
+
+func newHistogramQuantiler(quantiles []float64, sendBuckets bool) *histogramQuantiler {
+	return &histogramQuantiler{
+		quantiles:   quantiles,
+		sendBuckets: sendBuckets,
+		lastBuckets: map[string][]*dto.Bucket{},
+	}
+}
+
+// Convert all of the metric families from a single scrape.  Everything but
+// histograms is converted as usual.  Series that are no longer scraped are
+// forgotten.
+func (h *histogramQuantiler) Convert(mfs []*dto.MetricFamily) []*datapoint.Datapoint {
+	seen := map[string][]*dto.Bucket{}
+
+	var dps []*datapoint.Datapoint
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_HISTOGRAM || mf.Name == nil {
+			dps = append(dps, convertMetricFamily(mf)...)
+			continue
+		}
+
+		name := mf.GetName()
+		dps = append(dps, makeHistogramDatapoints(name, mf.Metric, h.sendBuckets)...)
+
+		for _, m := range mf.Metric {
+			hist := m.GetHistogram()
+			if hist == nil {
+				continue
+			}
+
+			buckets := sortedBuckets(hist)
+
+			key := histogramSeriesKey(name, m.Label)
+			seen[key] = buckets
+
+			last, ok := h.lastBuckets[key]
+			if !ok {
+				// Quantiles can't be computed until there is a previous scrape
+				continue
+			}
+
+			deltas := bucketDeltas(last, buckets)
+			if deltas[len(deltas)-1] == 0 {
+				// Nothing was observed in the interval
+				continue
+			}
+
+			dims := labelsToDims(m.Label)
+			for _, q := range h.quantiles {
+				value := bucketQuantile(q, buckets, deltas)
+				if math.IsNaN(value) {
+					continue
+				}
+				quantileDims := utils.MergeStringMaps(dims, map[string]string{
+					"quantile": strconv.FormatFloat(q, 'f', 6, 64),
+				})
+				dps = append(dps, sfxclient.GaugeF(name+"_quantile", quantileDims, value))
+			}
+		}
+	}
+
+	h.lastBuckets = seen
+	return dps
+}
+
+func histogramSeriesKey(name string, labels []*dto.LabelPair) string {
+	pairs := make([]string, len(labels))
+	for i := range labels {
+		pairs[i] = labels[i].GetName() + "=" + strconv.Quote(labels[i].GetValue())
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedBuckets returns the buckets of the histogram sorted by upper bound.
+// The +Inf bucket is added if it is implicit, as it can be in the protobuf
+// format.
+func sortedBuckets(hist *dto.Histogram) []*dto.Bucket {
+	buckets := append([]*dto.Bucket{}, hist.GetBucket()...)
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].GetUpperBound() < buckets[j].GetUpperBound()
+	})
+
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+		inf := math.Inf(1)
+		buckets = append(buckets, &dto.Bucket{
+			CumulativeCount: hist.SampleCount,
+			UpperBound:      &inf,
+		})
+	}
+	return buckets
+}
+
+// bucketDeltas returns the cumulative count of each bucket that was observed
+// since the last scrape.  If the buckets changed or any count went down, the
+// histogram was reset and the current counts are used as is.
+func bucketDeltas(last, current []*dto.Bucket) []float64 {
+	deltas := make([]float64, len(current))
+	for i := range current {
+		deltas[i] = float64(current[i].GetCumulativeCount())
+	}
+
+	if len(last) != len(current) {
+		return deltas
+	}
+	for i := range current {
+		if last[i].GetUpperBound() != current[i].GetUpperBound() || last[i].GetCumulativeCount() > current[i].GetCumulativeCount() {
+			return deltas
+		}
+	}
+
+	for i := range current {
+		deltas[i] -= float64(last[i].GetCumulativeCount())
+	}
+	return deltas
+}
+
+// bucketQuantile estimates the qth quantile from the cumulative bucket
+// counts the same way as the Prometheus `histogram_quantile` function, by
+// linear interpolation within the bucket that the quantile falls into.
+// The buckets must be sorted by upper bound, ending with +Inf, and the
+// counts must correspond to them.  NaN is returned if there are no finite
+// buckets to estimate from.
+func bucketQuantile(q float64, buckets []*dto.Bucket, counts []float64) float64 {
+	total := counts[len(counts)-1]
+	rank := q * total
+
+	i := sort.Search(len(counts), func(i int) bool { return counts[i] >= rank })
+
+	upperBound := buckets[i].GetUpperBound()
+	if math.IsInf(upperBound, 1) {
+		// The quantile is in the +Inf bucket so the best that can be done is
+		// the highest finite upper bound
+		if i == 0 {
+			return math.NaN()
+		}
+		return buckets[i-1].GetUpperBound()
+	}
+
+	var lowerBound, countBelow float64
+	if i > 0 {
+		lowerBound = buckets[i-1].GetUpperBound()
+		countBelow = counts[i-1]
+	} else if upperBound <= 0 {
+		return upperBound
+	}
+
+	countInBucket := counts[i] - countBelow
+	if countInBucket == 0 {
+		return upperBound
+	}
+	return lowerBound + (upperBound-lowerBound)*((rank-countBelow)/countInBucket)
+}
@@ -0,0 +1,115 @@
+package prometheusexporter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+)
+
+func makeBuckets(upperBounds []float64, counts []uint64) []*dto.Bucket {
+	buckets := make([]*dto.Bucket, len(upperBounds))
+	for i := range upperBounds {
+		buckets[i] = &dto.Bucket{UpperBound: &upperBounds[i], CumulativeCount: &counts[i]}
+	}
+	return buckets
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := makeBuckets([]float64{1, 2, 4, math.Inf(1)}, []uint64{0, 0, 0, 0})
+
+	t.Run("interpolates within a bucket", func(t *testing.T) {
+		counts := []float64{10, 30, 40, 40}
+		require.InDelta(t, 0.2, bucketQuantile(0.05, buckets, counts), 1e-9)
+		require.InDelta(t, 1.5, bucketQuantile(0.5, buckets, counts), 1e-9)
+		require.InDelta(t, 3.2, bucketQuantile(0.9, buckets, counts), 1e-9)
+	})
+
+	t.Run("+Inf bucket", func(t *testing.T) {
+		require.Equal(t, 4.0, bucketQuantile(0.99, buckets, []float64{10, 30, 40, 50}))
+		require.True(t, math.IsNaN(bucketQuantile(0.5, buckets[3:], []float64{5})))
+	})
+
+	t.Run("deltas", func(t *testing.T) {
+		last := makeBuckets([]float64{1, math.Inf(1)}, []uint64{5, 10})
+		require.Equal(t, []float64{1, 3}, bucketDeltas(last, makeBuckets([]float64{1, math.Inf(1)}, []uint64{6, 13})))
+		// Reset
+		require.Equal(t, []float64{2, 3}, bucketDeltas(last, makeBuckets([]float64{1, math.Inf(1)}, []uint64{2, 3})))
+		// Changed buckets
+		require.Equal(t, []float64{6, 13}, bucketDeltas(last, makeBuckets([]float64{2, math.Inf(1)}, []uint64{6, 13})))
+	})
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	var content string
+	fetch := func() (io.ReadCloser, expfmt.Format, error) {
+		return ioutil.NopCloser(strings.NewReader(content)), expfmt.FmtText, nil
+	}
+
+	scrape := func(t *testing.T, q *histogramQuantiler, body string) map[string]string {
+		content = body
+		dps, _, err := fetchPrometheusMetrics(fetch, nil, q)
+		require.Nil(t, err)
+
+		out := map[string]string{}
+		for _, dp := range dps {
+			key := dp.Metric
+			if q, ok := dp.Dimensions["quantile"]; ok {
+				key += ":" + q
+			}
+			if ub, ok := dp.Dimensions["upper_bound"]; ok {
+				key += ":" + ub
+			}
+			out[key] = dp.Value.String()
+		}
+		return out
+	}
+
+	histogram := func(le1, le2, inf uint64) string {
+		return fmt.Sprintf(`# TYPE latency histogram
+latency_bucket{le="1"} %d
+latency_bucket{le="2"} %d
+latency_bucket{le="+Inf"} %d
+latency_sum 10
+latency_count %d
+# TYPE temp gauge
+temp 5
+`, le1, le2, inf, inf)
+	}
+
+	t.Run("without buckets", func(t *testing.T) {
+		q := newHistogramQuantiler([]float64{0.5, 0.9}, false)
+
+		require.Equal(t, map[string]string{
+			"latency":       "10",
+			"latency_count": "10",
+			"temp":          "5",
+		}, scrape(t, q, histogram(5, 10, 10)))
+
+		require.Equal(t, map[string]string{
+			"latency":                   "10",
+			"latency_count":             "20",
+			"latency_quantile:0.500000": "1",
+			"latency_quantile:0.900000": "1.8",
+			"temp":                      "5",
+		}, scrape(t, q, histogram(10, 20, 20)))
+
+		// Nothing observed
+		require.NotContains(t, scrape(t, q, histogram(10, 20, 20)), "latency_quantile:0.500000")
+	})
+
+	t.Run("with buckets", func(t *testing.T) {
+		q := newHistogramQuantiler([]float64{0.5}, true)
+		scrape(t, q, histogram(5, 10, 10))
+
+		dps := scrape(t, q, histogram(5, 15, 20))
+		require.Equal(t, "2", dps["latency_quantile:0.500000"])
+		require.Equal(t, "15", dps["latency_bucket:2.000000"])
+	})
+}
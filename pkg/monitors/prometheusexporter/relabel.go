@@ -0,0 +1,229 @@
+package prometheusexporter
+
+import (
+	"crypto/md5" // nolint:gosec // Used for hashing like Prometheus, not security
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/signalfx/defaults"
+)
+
+// The relabel actions that are supported, which are a subset of those
+// supported by Prometheus
+const (
+	RelabelReplace  = "replace"
+	RelabelKeep     = "keep"
+	RelabelDrop     = "drop"
+	RelabelHashMod  = "hashmod"
+	RelabelLabelMap = "labelmap"
+)
+
+// The special labels that determine the URL that is scraped
+const (
+	addressLabel     = "__address__"
+	schemeLabel      = "__scheme__"
+	metricsPathLabel = "__metrics_path__"
+	paramLabelPrefix = "__param_"
+	metaLabelPrefix  = "__meta_"
+	metricNameLabel  = "__name__"
+)
+
+// RelabelConfig is a single relabeling rule.  These work the same as the
+// `relabel_configs` in Prometheus scrape configs.
+type RelabelConfig struct {
+	// The labels whose values are joined together with `separator` and
+	// matched against `regex`
+	SourceLabels []string `yaml:"sourceLabels"`
+	// The separator placed between the values of the `sourceLabels`
+	Separator string `yaml:"separator" default:";"`
+	// The label to which the result is written for the `replace` and
+	// `hashmod` actions
+	TargetLabel string `yaml:"targetLabel"`
+	// The regular expression that is matched against the joined source label
+	// values.  It is anchored at both ends.
+	Regex string `yaml:"regex" default:"(.*)"`
+	// The modulus to take of the hash of the source label values for the
+	// `hashmod` action
+	Modulus uint64 `yaml:"modulus"`
+	// The value written to `targetLabel` for the `replace` action.  Regex
+	// capture groups can be referenced with `$1`, `${name}`, etc.
+	Replacement string `yaml:"replacement" default:"$1"`
+	// What to do when the regex matches.  Can be `replace`, `keep`, `drop`,
+	// `hashmod` or `labelmap`.
+	Action string `yaml:"action" default:"replace"`
+}
+
+// UnmarshalYAML sets the defaults before unmarshaling so that explicitly
+// empty values, such as an empty `separator`, are kept.
+func (rc *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := defaults.Set(rc); err != nil {
+		return err
+	}
+	type plain RelabelConfig
+	return unmarshal((*plain)(rc))
+}
+
+type relabeler struct {
+	conf  *RelabelConfig
+	regex *regexp.Regexp
+}
+
+func newRelabelers(confs []*RelabelConfig) ([]*relabeler, error) {
+	var out []*relabeler
+	for i, conf := range confs {
+		r, err := newRelabeler(conf)
+		if err != nil {
+			return nil, fmt.Errorf("relabel config %d is invalid: %v", i, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func newRelabeler(conf *RelabelConfig) (*relabeler, error) {
+	regex, err := regexp.Compile("^(?:" + conf.Regex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("regex %q is invalid: %v", conf.Regex, err)
+	}
+
+	switch conf.Action {
+	case RelabelReplace:
+		if conf.TargetLabel == "" {
+			return nil, fmt.Errorf("targetLabel is required for the %s action", conf.Action)
+		}
+	case RelabelHashMod:
+		if conf.TargetLabel == "" {
+			return nil, fmt.Errorf("targetLabel is required for the %s action", conf.Action)
+		}
+		if conf.Modulus == 0 {
+			return nil, fmt.Errorf("modulus must be greater than 0 for the %s action", conf.Action)
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelMap:
+	default:
+		return nil, fmt.Errorf("unknown action %q", conf.Action)
+	}
+
+	return &relabeler{conf: conf, regex: regex}, nil
+}
+
+// relabel applies all of the relabelers in order to the labels, which are
+// modified in place.  It returns false if the labels should be dropped
+// entirely.
+func relabel(labels map[string]string, relabelers []*relabeler) bool {
+	for _, r := range relabelers {
+		if !r.apply(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *relabeler) apply(labels map[string]string) bool {
+	values := make([]string, len(r.conf.SourceLabels))
+	for i, l := range r.conf.SourceLabels {
+		values[i] = labels[l]
+	}
+	val := strings.Join(values, r.conf.Separator)
+
+	switch r.conf.Action {
+	case RelabelKeep:
+		return r.regex.MatchString(val)
+	case RelabelDrop:
+		return !r.regex.MatchString(val)
+	case RelabelReplace:
+		indexes := r.regex.FindStringSubmatchIndex(val)
+		if indexes == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.conf.TargetLabel, val, indexes))
+		res := string(r.regex.ExpandString(nil, r.conf.Replacement, val, indexes))
+		if res == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = res
+		}
+	case RelabelHashMod:
+		sum := md5.Sum([]byte(val)) // nolint:gosec
+		labels[r.conf.TargetLabel] = strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%r.conf.Modulus, 10)
+	case RelabelLabelMap:
+		// Copy the matching labels first so that new labels aren't matched
+		mapped := map[string]string{}
+		for name, value := range labels {
+			if r.regex.MatchString(name) {
+				mapped[r.regex.ReplaceAllString(name, r.conf.Replacement)] = value
+			}
+		}
+		for name, value := range mapped {
+			labels[name] = value
+		}
+	}
+	return true
+}
+
+// relabelMetricFamilies applies the relabelers to every series in the metric
+// families, with the family name available as the `__name__` label.  Series
+// whose name is changed are moved into a family of the new name, and series
+// that are dropped are removed.
+func relabelMetricFamilies(mfs []*dto.MetricFamily, relabelers []*relabeler) []*dto.MetricFamily {
+	if len(relabelers) == 0 {
+		return mfs
+	}
+
+	familiesByName := map[string]*dto.MetricFamily{}
+	var out []*dto.MetricFamily
+
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := map[string]string{metricNameLabel: mf.GetName()}
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+
+			if !relabel(labels, relabelers) {
+				continue
+			}
+
+			name := labels[metricNameLabel]
+			if name == "" {
+				continue
+			}
+			delete(labels, metricNameLabel)
+
+			newMF, ok := familiesByName[name]
+			if !ok {
+				newMF = &dto.MetricFamily{
+					Name: &name,
+					Help: mf.Help,
+					Type: mf.Type,
+				}
+				familiesByName[name] = newMF
+				out = append(out, newMF)
+			}
+
+			m.Label = labelPairsFromMap(labels)
+			newMF.Metric = append(newMF.Metric, m)
+		}
+	}
+	return out
+}
+
+func labelPairsFromMap(labels map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]*dto.LabelPair, len(names))
+	for i := range names {
+		name := names[i]
+		value := labels[name]
+		out[i] = &dto.LabelPair{Name: &name, Value: &value}
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package prometheusexporter
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/common/httpclient"
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
+)
+
+func parseRelabelConfigs(t *testing.T, content string) []*relabeler {
+	var confs []*RelabelConfig
+	require.Nil(t, yaml.UnmarshalStrict([]byte(content), &confs))
+	relabelers, err := newRelabelers(confs)
+	require.Nil(t, err)
+	return relabelers
+}
+
+func TestRelabel(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		var confs []*RelabelConfig
+		require.Nil(t, yaml.UnmarshalStrict([]byte(`
+- targetLabel: a
+- targetLabel: b
+  separator: ""
+`), &confs))
+		require.Equal(t, &RelabelConfig{
+			Separator:   ";",
+			TargetLabel: "a",
+			Regex:       "(.*)",
+			Replacement: "$1",
+			Action:      RelabelReplace,
+		}, confs[0])
+		require.Equal(t, "", confs[1].Separator)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		labels := map[string]string{"a": "foo", "b": "bar", "drop_me": "x"}
+		require.True(t, relabel(labels, parseRelabelConfigs(t, `
+- sourceLabels: [a, b]
+  regex: (f.*);(.*)
+  targetLabel: ${2}_label
+  replacement: $1-$2
+- sourceLabels: [nonexistent]
+  targetLabel: drop_me
+- sourceLabels: [b]
+  regex: baz
+  targetLabel: a
+  replacement: never
+`)))
+		require.Equal(t, map[string]string{"a": "foo", "b": "bar", "bar_label": "foo-bar"}, labels)
+	})
+
+	t.Run("keep and drop", func(t *testing.T) {
+		keep := parseRelabelConfigs(t, `
+- sourceLabels: [job]
+  regex: api|web
+  action: keep
+`)
+		require.True(t, relabel(map[string]string{"job": "web"}, keep))
+		// The regex is anchored
+		require.False(t, relabel(map[string]string{"job": "webapp"}, keep))
+
+		drop := parseRelabelConfigs(t, `
+- sourceLabels: [job]
+  regex: web.*
+  action: drop
+`)
+		require.False(t, relabel(map[string]string{"job": "webapp"}, drop))
+		require.True(t, relabel(map[string]string{"job": "api"}, drop))
+	})
+
+	t.Run("hashmod", func(t *testing.T) {
+		relabelers := parseRelabelConfigs(t, `
+- sourceLabels: [__address__]
+  modulus: 4
+  targetLabel: shard
+  action: hashmod
+`)
+		labels := map[string]string{"__address__": "10.0.0.1:9100"}
+		require.True(t, relabel(labels, relabelers))
+
+		again := map[string]string{"__address__": "10.0.0.1:9100"}
+		relabel(again, relabelers)
+		require.Equal(t, labels["shard"], again["shard"])
+		require.Contains(t, []string{"0", "1", "2", "3"}, labels["shard"])
+	})
+
+	t.Run("labelmap", func(t *testing.T) {
+		labels := map[string]string{"__meta_container_label_app": "web", "__meta_host": "h1"}
+		require.True(t, relabel(labels, parseRelabelConfigs(t, `
+- regex: __meta_container_label_(.+)
+  action: labelmap
+`)))
+		require.Equal(t, "web", labels["app"])
+		require.Equal(t, "web", labels["__meta_container_label_app"])
+		require.Len(t, labels, 3)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{
+			"- action: replace",
+			"- action: hashmod\n  targetLabel: a",
+			"- action: labeldrop",
+			"- action: keep\n  regex: '('",
+		} {
+			var confs []*RelabelConfig
+			require.Nil(t, yaml.UnmarshalStrict([]byte(content), &confs))
+			_, err := newRelabelers(confs)
+			require.NotNil(t, err, content)
+		}
+	})
+}
+
+func TestTargetRelabeling(t *testing.T) {
+	conf := &Config{
+		HTTPConfig: httpclient.HTTPConfig{},
+		Host:       "10.0.0.5",
+		Port:       9100,
+		MetricPath: "/metrics",
+	}
+	endpoint := services.NewEndpointCore("abc", "node", "docker", nil)
+	endpoint.AddExtraField("container_name", "node-exporter")
+	endpoint.AddExtraField("container_labels", map[string]string{"prometheus.io/scrape": "true"})
+
+	m := &Monitor{Endpoint: endpoint}
+	target := m.targetLabels(conf)
+	require.Equal(t, "10.0.0.5:9100", target["__address__"])
+	require.Equal(t, "node-exporter", target["__meta_container_name"])
+	require.Equal(t, "true", target["__meta_container_labels_prometheus_io_scrape"])
+
+	require.True(t, relabel(target, parseRelabelConfigs(t, `
+- sourceLabels: [__meta_container_name]
+  targetLabel: job
+- sourceLabels: [__meta_container_name]
+  targetLabel: __param_module
+- targetLabel: __metrics_path__
+  replacement: /probe
+`)))
+
+	scrapeURL, dims := targetURLAndDims(target)
+	require.Equal(t, "http://10.0.0.5:9100/probe?module=node-exporter", scrapeURL)
+	require.Equal(t, map[string]string{"job": "node-exporter"}, dims)
+}
+
+func TestMetricRelabeling(t *testing.T) {
+	fetch := func() (io.ReadCloser, expfmt.Format, error) {
+		return ioutil.NopCloser(strings.NewReader(`# TYPE http_requests_total counter
+http_requests_total{code="200",path="/"} 10
+http_requests_total{code="500",path="/"} 2
+# TYPE go_goroutines gauge
+go_goroutines 8
+# TYPE request_seconds histogram
+request_seconds_bucket{le="1"} 3
+request_seconds_bucket{le="+Inf"} 4
+request_seconds_sum 2.5
+request_seconds_count 4
+`)), expfmt.FmtText, nil
+	}
+
+	dps, _, err := fetchPrometheusMetrics(fetch, parseRelabelConfigs(t, `
+- sourceLabels: [__name__]
+  regex: go_.*
+  action: drop
+- sourceLabels: [__name__, code]
+  regex: http_requests_total;(.*)
+  targetLabel: __name__
+  replacement: http_responses_${1}
+- sourceLabels: [path]
+  targetLabel: path
+  replacement: ""
+`), nil)
+	require.Nil(t, err)
+
+	byName := map[string]string{}
+	for _, dp := range dps {
+		require.NotContains(t, dp.Dimensions, "path")
+		byName[dp.Metric] = dp.Value.String()
+	}
+	require.Equal(t, map[string]string{
+		"http_responses_200":     "10",
+		"http_responses_500":     "2",
+		"request_seconds":        "2.5",
+		"request_seconds_count":  "4",
+		"request_seconds_bucket": "4",
+	}, byName)
+}
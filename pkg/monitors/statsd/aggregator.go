@@ -0,0 +1,201 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/signalfx/golib/v3/sfxclient"
+
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+// How many flush intervals the last value of a gauge is kept for without
+// being updated.  After that, a gauge delta starts from 0 again.
+const gaugeExpiryIntervals = 10
+
+// aggregator combines all of the StatsD metrics received in a single flush
+// interval into datapoints.  It is only used from the flush goroutine so it
+// needs no locking.
+type aggregator struct {
+	percentiles []float64
+	// The last known value of each gauge so that gauge deltas can be applied
+	// across flush intervals
+	lastGauges map[string]*lastGauge
+	logger     *utils.ThrottledLogger
+}
+
+type lastGauge struct {
+	value float64
+	// The number of flushes since the gauge was last updated
+	idleIntervals int
+}
+
+// aggregate holds the state of a single metric series within a flush interval
+type aggregate struct {
+	metric *statsDMetric
+	// The sum of counters or the current value of gauges
+	value float64
+	// The number of timer/histogram events, adjusted by sample rate
+	count  float64
+	values []float64
+	set    map[string]bool
+}
+
+func newAggregator(percentiles []float64, logger *utils.ThrottledLogger) *aggregator {
+	return &aggregator{
+		percentiles: percentiles,
+		lastGauges:  make(map[string]*lastGauge),
+		logger:      logger,
+	}
+}
+
+// seriesKey uniquely identifies a metric series by its type, name and
+// dimensions.
+func seriesKey(metric *statsDMetric) string {
+	keys := make([]string, 0, len(metric.dimensions))
+	for k := range metric.dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(metric.metricType)
+	sb.WriteString("|")
+	sb.WriteString(metric.metricName)
+	for _, k := range keys {
+		sb.WriteString("|")
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(metric.dimensions[k])
+	}
+	return sb.String()
+}
+
+func isTimerType(metricType string) bool {
+	return metricType == "ms" || metricType == "h" || metricType == "d"
+}
+
+// Aggregate the given metrics, which should be all of the metrics received
+// in a single flush interval, and convert them to datapoints.
+func (a *aggregator) Aggregate(metrics []*statsDMetric) []*datapoint.Datapoint {
+	aggs := make(map[string]*aggregate)
+	var keys []string
+
+	// StatsD Metric Types https://github.com/statsd/statsd/blob/master/docs/metric_types.md
+	for _, metric := range metrics {
+		key := seriesKey(metric)
+		agg, exists := aggs[key]
+		if !exists {
+			agg = &aggregate{metric: metric}
+		}
+
+		switch {
+		case metric.metricType == "c":
+			agg.value += metric.value / metric.sampleRate
+		case metric.metricType == "g":
+			if metric.gaugeDelta {
+				if last := a.lastGauges[key]; !exists && last != nil {
+					agg.value = last.value
+				}
+				agg.value += metric.value
+			} else {
+				agg.value = metric.value
+			}
+			a.lastGauges[key] = &lastGauge{value: agg.value}
+		case isTimerType(metric.metricType):
+			agg.count += 1 / metric.sampleRate
+			agg.values = append(agg.values, metric.value)
+		case metric.metricType == "s":
+			if agg.set == nil {
+				agg.set = make(map[string]bool)
+			}
+			agg.set[metric.setValue] = true
+		default:
+			a.logger.Errorf("Unsupported StatsD metric type: %s", metric.metricType)
+			continue
+		}
+
+		if !exists {
+			aggs[key] = agg
+			keys = append(keys, key)
+		}
+	}
+
+	a.expireGauges()
+
+	var dps []*datapoint.Datapoint
+	for _, key := range keys {
+		dps = append(dps, a.toDatapoints(aggs[key])...)
+	}
+	return dps
+}
+
+// expireGauges forgets the gauges that haven't been updated for too many
+// intervals so that lastGauges doesn't grow without bound.
+func (a *aggregator) expireGauges() {
+	for key, g := range a.lastGauges {
+		if g.idleIntervals > gaugeExpiryIntervals {
+			delete(a.lastGauges, key)
+			continue
+		}
+		g.idleIntervals++
+	}
+}
+
+func (a *aggregator) toDatapoints(agg *aggregate) []*datapoint.Datapoint {
+	name := agg.metric.metricName
+
+	var dps []*datapoint.Datapoint
+	switch {
+	case agg.metric.metricType == "c":
+		dps = append(dps, sfxclient.Counter(name, nil, int64(math.Round(agg.value))))
+	case agg.metric.metricType == "g":
+		dps = append(dps, sfxclient.GaugeF(name, nil, agg.value))
+	case agg.metric.metricType == "s":
+		dps = append(dps, sfxclient.Gauge(name, nil, int64(len(agg.set))))
+	case isTimerType(agg.metric.metricType):
+		sort.Float64s(agg.values)
+
+		var sum float64
+		for _, v := range agg.values {
+			sum += v
+		}
+
+		dps = append(dps,
+			sfxclient.Counter(name+".count", nil, int64(math.Round(agg.count))),
+			sfxclient.GaugeF(name+".min", nil, agg.values[0]),
+			sfxclient.GaugeF(name+".max", nil, agg.values[len(agg.values)-1]),
+			sfxclient.GaugeF(name+".mean", nil, sum/float64(len(agg.values))))
+
+		for _, p := range a.percentiles {
+			dps = append(dps, sfxclient.GaugeF(name+"."+percentileSuffix(p), nil, percentile(agg.values, p)))
+		}
+	}
+
+	for i := range dps {
+		dps[i].Dimensions = utils.CloneStringMap(agg.metric.dimensions)
+	}
+	return dps
+}
+
+// percentileSuffix makes the metric name suffix for a percentile, e.g. `p90`
+// for 90 or `p99_9` for 99.9.
+func percentileSuffix(p float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", -1)
+}
+
+// percentile uses the nearest-rank method to get the pth percentile of
+// the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
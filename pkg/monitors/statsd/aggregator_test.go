@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/signalfx/golib/v3/datapoint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	sl := &statsDListener{}
+	agg := newAggregator([]float64{50, 90, 99.9}, nil)
+
+	dpsByName := func(raw ...string) map[string]*datapoint.Datapoint {
+		out := map[string]*datapoint.Datapoint{}
+		for _, dp := range agg.Aggregate(sl.parseMetrics(raw)) {
+			out[dp.Metric+dp.Dimensions["env"]] = dp
+		}
+		return out
+	}
+
+	t.Run("counters", func(t *testing.T) {
+		dps := dpsByName("hits:1|c", "hits:2|c", "hits:1|c|@0.1", "hits:5|c|#env:prod")
+		require.Len(t, dps, 2)
+		require.Equal(t, datapoint.Count, dps["hits"].MetricType)
+		require.Equal(t, datapoint.NewIntValue(13), dps["hits"].Value)
+		require.Equal(t, datapoint.NewIntValue(5), dps["hitsprod"].Value)
+	})
+
+	t.Run("gauges", func(t *testing.T) {
+		dps := dpsByName("temp:10|g", "temp:20|g", "temp:+5|g")
+		require.Len(t, dps, 1)
+		require.Equal(t, datapoint.Gauge, dps["temp"].MetricType)
+		require.Equal(t, datapoint.NewFloatValue(25), dps["temp"].Value)
+
+		// Deltas apply to the value from the last interval
+		dps = dpsByName("temp:-3|g")
+		require.Equal(t, datapoint.NewFloatValue(22), dps["temp"].Value)
+
+		dps = dpsByName("temp:7|g", "temp:-10|g")
+		require.Equal(t, datapoint.NewFloatValue(-3), dps["temp"].Value)
+
+		// Gauges that aren't updated in an interval aren't sent
+		require.Len(t, dpsByName(), 0)
+
+		// The last value is kept for a while without updates
+		for i := 1; i < gaugeExpiryIntervals; i++ {
+			dpsByName()
+		}
+		dps = dpsByName("temp:+1|g")
+		require.Equal(t, datapoint.NewFloatValue(-2), dps["temp"].Value)
+
+		// But is eventually forgotten
+		for i := 0; i <= gaugeExpiryIntervals; i++ {
+			dpsByName()
+		}
+		require.Len(t, agg.lastGauges, 0)
+		dps = dpsByName("temp:+1|g")
+		require.Equal(t, datapoint.NewFloatValue(1), dps["temp"].Value)
+	})
+
+	t.Run("timers and histograms", func(t *testing.T) {
+		var raw []string
+		for i := 1; i <= 10; i++ {
+			raw = append(raw, "latency:"+strconv.Itoa(i%10)+"|ms|@0.5")
+		}
+		raw = append(raw, "size:100|h", "size:300|h", "dist:5|d")
+
+		dps := dpsByName(raw...)
+		require.Len(t, dps, 21)
+
+		require.Equal(t, datapoint.Count, dps["latency.count"].MetricType)
+		require.Equal(t, datapoint.NewIntValue(20), dps["latency.count"].Value)
+		require.Equal(t, datapoint.NewFloatValue(0), dps["latency.min"].Value)
+		require.Equal(t, datapoint.NewFloatValue(9), dps["latency.max"].Value)
+		require.Equal(t, datapoint.NewFloatValue(4.5), dps["latency.mean"].Value)
+		require.Equal(t, datapoint.NewFloatValue(4), dps["latency.p50"].Value)
+		require.Equal(t, datapoint.NewFloatValue(8), dps["latency.p90"].Value)
+		require.Equal(t, datapoint.NewFloatValue(9), dps["latency.p99_9"].Value)
+
+		require.Equal(t, datapoint.NewIntValue(2), dps["size.count"].Value)
+		require.Equal(t, datapoint.NewFloatValue(200), dps["size.mean"].Value)
+		require.Equal(t, datapoint.NewFloatValue(100), dps["size.p50"].Value)
+		require.Equal(t, datapoint.NewFloatValue(5), dps["dist.p99_9"].Value)
+	})
+
+	t.Run("sets", func(t *testing.T) {
+		dps := dpsByName("users:alice|s", "users:bob|s", "users:alice|s", "users:42|s")
+		require.Len(t, dps, 1)
+		require.Equal(t, datapoint.Gauge, dps["users"].MetricType)
+		require.Equal(t, datapoint.NewIntValue(3), dps["users"].Value)
+	})
+}
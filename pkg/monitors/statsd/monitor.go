@@ -3,6 +3,8 @@ package statsd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/signalfx/golib/v3/datapoint"
@@ -15,13 +17,6 @@ import (
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
 
-var metricTypeMap = map[string]datapoint.MetricType{
-	"g":  datapoint.Gauge,
-	"c":  datapoint.Count,
-	"ms": datapoint.Gauge,
-	"s":  datapoint.Gauge,
-}
-
 func init() {
 	monitors.Register(&monitorMetadata, func() interface{} { return &Monitor{} }, &Config{})
 }
@@ -37,19 +32,44 @@ type ConverterInput struct {
 // Config for this monitor
 type Config struct {
 	config.MonitorConfig `yaml:",inline" acceptsEndpoints:"false" singleInstance:"false"`
-	// The host/address on which to bind the UDP listener that accepts statsd
-	// datagrams
+	// The transport on which to receive statsd metrics.  Can be `udp`,
+	// `tcp`, `unixgram` (Unix datagram socket) or `unix` (Unix stream
+	// socket).  Metrics sent over the stream transports must be separated by
+	// newlines.
+	Protocol string `yaml:"protocol" default:"udp"`
+	// The host/address on which to bind the UDP or TCP listener that accepts
+	// statsd metrics
 	ListenAddress string `yaml:"listenAddress" default:"localhost"`
 	// The port on which to listen for statsd messages (**default:** `8125`)
 	ListenPort *uint16 `yaml:"listenPort"`
+	// The path of the socket file to create when `protocol` is `unixgram` or
+	// `unix`.  Any existing socket at that path will be replaced.
+	SocketPath string `yaml:"socketPath"`
+	// The maximum number of metrics to buffer between intervals.  Metrics
+	// received when the buffer is full are dropped.  Set to 0 for no limit.
+	MaxBufferedMetrics int `yaml:"maxBufferedMetrics" default:"100000"`
 	// A prefix in metric names that needs to be removed before metric name conversion
 	MetricPrefix string `yaml:"metricPrefix"`
 	// A list converters to convert StatsD metric names into SignalFx metric names and dimensions
 	Converters []ConverterInput `yaml:"converters"`
+	// The percentiles to calculate for timer and histogram metrics in each
+	// interval.  Each percentile is sent as a gauge with the suffix `.p<N>`
+	// (e.g. `.p90`), with any decimal point replaced by `_`.
+	Percentiles []float64 `yaml:"percentiles" default:"[90, 99]"`
 }
 
 // Validate StatsD monitor config
 func (c *Config) Validate() error {
+	switch c.Protocol {
+	case "udp", "tcp":
+	case "unixgram", "unix":
+		if c.SocketPath == "" {
+			return fmt.Errorf("socketPath is required when protocol is %s", c.Protocol)
+		}
+	default:
+		return fmt.Errorf("protocol must be one of udp, tcp, unixgram or unix, not %q", c.Protocol)
+	}
+
 	for _, ci := range c.Converters {
 		if ci.Pattern == "" {
 			return errors.New("[pattern] is required for a converter")
@@ -59,6 +79,12 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("percentile %v must be greater than 0 and no more than 100", p)
+		}
+	}
+
 	return nil
 }
 
@@ -68,6 +94,7 @@ type Monitor struct {
 	cancel   context.CancelFunc
 	conf     *Config
 	listener *statsDListener
+	agg      *aggregator
 	logger   *utils.ThrottledLogger
 }
 
@@ -99,12 +126,14 @@ func (m *Monitor) Configure(conf *Config) error {
 	}
 
 	m.listener = &statsDListener{
-		ipAddr:     conf.ListenAddress,
-		port:       *conf.ListenPort,
-		tcp:        false, // Will be added to Config when TCP is supported
-		prefix:     conf.MetricPrefix,
-		converters: converters,
-		logger:     m.logger,
+		protocol:    conf.Protocol,
+		ipAddr:      conf.ListenAddress,
+		port:        *conf.ListenPort,
+		socketPath:  conf.SocketPath,
+		maxBuffered: conf.MaxBufferedMetrics,
+		prefix:      conf.MetricPrefix,
+		converters:  converters,
+		logger:      m.logger,
 	}
 
 	err := m.listener.Listen()
@@ -114,9 +143,10 @@ func (m *Monitor) Configure(conf *Config) error {
 
 	go m.listener.Read()
 
+	m.agg = newAggregator(conf.Percentiles, m.logger)
+
 	utils.RunOnInterval(ctx, func() {
-		metrics := m.listener.FetchMetrics()
-		dps := m.convertMetricsToDatapoints(aggregateMetrics(metrics))
+		dps := m.agg.Aggregate(m.listener.FetchMetrics())
 
 		m.Output.SendDatapoints(dps...)
 	}, time.Duration(conf.IntervalSeconds)*time.Second)
@@ -124,6 +154,18 @@ func (m *Monitor) Configure(conf *Config) error {
 	return nil
 }
 
+// InternalMetrics returns counts of the data received by the listener
+func (m *Monitor) InternalMetrics() []*datapoint.Datapoint {
+	if m.listener == nil {
+		return nil
+	}
+	return []*datapoint.Datapoint{
+		sfxclient.Cumulative("sfxagent.statsd_packets_received", nil, atomic.LoadInt64(&m.listener.packetsReceived)),
+		sfxclient.Cumulative("sfxagent.statsd_parse_errors", nil, atomic.LoadInt64(&m.listener.parseErrors)),
+		sfxclient.Cumulative("sfxagent.statsd_metrics_dropped", nil, atomic.LoadInt64(&m.listener.metricsDropped)),
+	}
+}
+
 // Shutdown stops listening to incoming StatsD metrics
 func (m *Monitor) Shutdown() {
 	if m.cancel != nil {
@@ -133,44 +175,3 @@ func (m *Monitor) Shutdown() {
 		m.listener.Close()
 	}
 }
-
-func aggregateMetrics(metrics []*statsDMetric) map[string]*statsDMetric {
-	metricsMap := make(map[string]*statsDMetric)
-
-	for _, metric := range metrics {
-		if _, exists := metricsMap[metric.rawMetricName]; exists && metricTypeMap[metric.metricType] == datapoint.Count {
-			// Add up
-			metricsMap[metric.rawMetricName].value += metric.value
-		} else {
-			// Create a new one or drop older metric by overwriting
-			metricsMap[metric.rawMetricName] = metric
-		}
-	}
-
-	return metricsMap
-}
-
-func (m *Monitor) convertMetricsToDatapoints(metrics map[string]*statsDMetric) []*datapoint.Datapoint {
-	var dps []*datapoint.Datapoint
-
-	for _, metric := range metrics {
-		var dp *datapoint.Datapoint
-
-		// StatsD Metric Types https://github.com/statsd/statsd/blob/master/docs/metric_types.md
-		switch metricTypeMap[metric.metricType] {
-		case datapoint.Gauge:
-			dp = sfxclient.GaugeF(metric.metricName, nil, metric.value)
-		case datapoint.Count:
-			dp = sfxclient.Counter(metric.metricName, nil, int64(metric.value))
-		default:
-			m.logger.Errorf("Unsupported StatsD metric type: %s", metric.metricType)
-			continue
-		}
-
-		dp.Dimensions = metric.dimensions
-
-		dps = append(dps, dp)
-	}
-
-	return dps
-}
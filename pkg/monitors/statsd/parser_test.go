@@ -22,6 +22,7 @@ func TestParseMetrics(t *testing.T) {
 				metricName:    "runtime.node.heap.size.by.space",
 				metricType:    "g",
 				value:         430080,
+				sampleRate:    1,
 				dimensions: map[string]string{
 					"service":    "svc1",
 					"runtime-id": "dcd3",
@@ -38,6 +39,7 @@ func TestParseMetrics(t *testing.T) {
 				metricName:    "runtime.node.heap.size.by.space",
 				metricType:    "g",
 				value:         43,
+				sampleRate:    1,
 				dimensions:    nil,
 			},
 		},
@@ -55,6 +57,7 @@ func TestParseMetrics(t *testing.T) {
 				metricName:    "egress.update_success",
 				metricType:    "g",
 				value:         100,
+				sampleRate:    1,
 				dimensions: map[string]string{
 					"svc":     "svc2",
 					"traffic": "egress",
@@ -78,6 +81,7 @@ func TestParseMetrics(t *testing.T) {
 				metricName:    "egress.update_success",
 				metricType:    "g",
 				value:         100,
+				sampleRate:    1,
 				dimensions: map[string]string{
 					"traffic": "egress",
 					"mesh":    "ecommerce-demo-mesh",
@@ -86,6 +90,46 @@ func TestParseMetrics(t *testing.T) {
 				},
 			},
 		},
+		{
+			"sample-rate",
+			"requests:3|c|@0.25",
+			nil,
+			statsDMetric{
+				rawMetricName: "requests",
+				metricName:    "requests",
+				metricType:    "c",
+				value:         3,
+				sampleRate:    0.25,
+			},
+		},
+		{
+			"gauge-delta",
+			"queue.size:-4|g",
+			nil,
+			statsDMetric{
+				rawMetricName: "queue.size",
+				metricName:    "queue.size",
+				metricType:    "g",
+				value:         -4,
+				gaugeDelta:    true,
+				sampleRate:    1,
+			},
+		},
+		{
+			"set",
+			"users:alice|s|#env:prod",
+			nil,
+			statsDMetric{
+				rawMetricName: "users",
+				metricName:    "users",
+				metricType:    "s",
+				setValue:      "alice",
+				sampleRate:    1,
+				dimensions: map[string]string{
+					"env": "prod",
+				},
+			},
+		},
 	}
 
 	for i := range cases {
@@ -1,7 +1,10 @@
 package statsd
 
 import (
+	"bufio"
+	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,15 +15,31 @@ import (
 
 type statsDListener struct {
 	sync.Mutex
-	ipAddr         string
-	port           uint16
-	tcp            bool
-	udpConn        *net.UDPConn
-	prefix         string
-	converters     []*converter
+	// One of `udp`, `tcp`, `unixgram` or `unix`
+	protocol   string
+	ipAddr     string
+	port       uint16
+	socketPath string
+	// The maximum number of metric lines to hold between flushes, 0 for no
+	// limit
+	maxBuffered int
+	prefix      string
+	converters  []*converter
+
+	// Used for the datagram protocols
+	packetConn net.PacketConn
+	// Used for the stream protocols
+	listener    net.Listener
+	streamConns map[net.Conn]bool
+
 	metricBuffer   []string
 	shutdownCalled int32
 	logger         *utils.ThrottledLogger
+
+	// Internal metrics, accessed atomically
+	packetsReceived int64
+	parseErrors     int64
+	metricsDropped  int64
 }
 
 type statsDMetric struct {
@@ -28,35 +47,68 @@ type statsDMetric struct {
 	metricName    string
 	metricType    string
 	value         float64
-	dimensions    map[string]string
+	// The raw value of set metrics, which don't have to be numeric
+	setValue string
+	// Whether a gauge value is a change to the previous value (`+N`/`-N`)
+	// instead of an absolute value
+	gaugeDelta bool
+	// The fraction of events that the client actually sent, from the `@0.1`
+	// field.  This is 1 if not specified.
+	sampleRate float64
+	dimensions map[string]string
 }
 
 func (sl *statsDListener) Listen() error {
-	if sl.tcp {
-		return sl.listenTCP()
+	var err error
+	switch sl.protocol {
+	case "udp":
+		sl.packetConn, err = net.ListenUDP("udp", &net.UDPAddr{
+			IP:   net.ParseIP(sl.ipAddr),
+			Port: int(sl.port),
+		})
+	case "tcp":
+		sl.listener, err = net.ListenTCP("tcp", &net.TCPAddr{
+			IP:   net.ParseIP(sl.ipAddr),
+			Port: int(sl.port),
+		})
+	case "unixgram":
+		if err = removeStaleSocket(sl.socketPath); err == nil {
+			sl.packetConn, err = net.ListenPacket("unixgram", sl.socketPath)
+		}
+	case "unix":
+		if err = removeStaleSocket(sl.socketPath); err == nil {
+			sl.listener, err = net.Listen("unix", sl.socketPath)
+		}
+	default:
+		err = fmt.Errorf("unsupported protocol %s", sl.protocol)
 	}
-
-	return sl.listenUDP()
-}
-
-func (sl *statsDListener) listenUDP() error {
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{
-		IP:   net.ParseIP(sl.ipAddr),
-		Port: int(sl.port),
-	})
-
 	if err != nil {
 		return err
 	}
 
-	sl.logger.Infof("SignalFx StatsD monitor: Listening on host & port %s:%s", conn.LocalAddr().Network(), conn.LocalAddr().String())
-
-	sl.udpConn = conn
+	if sl.packetConn != nil {
+		sl.logger.Infof("SignalFx StatsD monitor: Listening on %s:%s", sl.packetConn.LocalAddr().Network(), sl.packetConn.LocalAddr().String())
+	} else {
+		sl.logger.Infof("SignalFx StatsD monitor: Listening on %s:%s", sl.listener.Addr().Network(), sl.listener.Addr().String())
+	}
 	return nil
 }
 
-func (sl *statsDListener) listenTCP() error {
-	return nil
+// removeStaleSocket removes a socket file left behind by a previous process
+// that didn't shut down cleanly so that it can be bound again.  Anything
+// other than a socket is left alone so that binding fails loudly.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	return os.Remove(path)
 }
 
 func (sl *statsDListener) FetchMetrics() []*statsDMetric {
@@ -72,30 +124,37 @@ func (sl *statsDListener) FetchMetrics() []*statsDMetric {
 	return parsed
 }
 
+// Read accepts data on the listener until it is closed.  It blocks so it
+// should be run in a goroutine.
 func (sl *statsDListener) Read() {
-	chData := make(chan []byte)
-
-	if sl.tcp {
-		go sl.readTCP(chData)
+	if sl.packetConn != nil {
+		sl.readPackets()
 	} else {
-		go sl.readUDP(chData)
-	}
-
-	for data := range chData {
-		sl.Lock()
-		sl.metricBuffer = append(sl.metricBuffer, strings.Split(string(data), "\n")...)
-		sl.Unlock()
+		sl.acceptStreams()
 	}
 }
 
-func (sl *statsDListener) readTCP(chData chan []byte) {
+func (sl *statsDListener) bufferLines(lines []string) {
+	sl.Lock()
+	defer sl.Unlock()
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if sl.maxBuffered > 0 && len(sl.metricBuffer) >= sl.maxBuffered {
+			atomic.AddInt64(&sl.metricsDropped, 1)
+			continue
+		}
+		sl.metricBuffer = append(sl.metricBuffer, line)
+	}
 }
 
-func (sl *statsDListener) readUDP(chData chan []byte) {
-	// UDP needs to receive data packet by packet. Max packet size is 65535 for now.
+func (sl *statsDListener) readPackets() {
+	// Datagrams need to be received packet by packet. Max packet size is 65535 for now.
 	buf := make([]byte, 65536)
 	for {
-		n, _, err := sl.udpConn.ReadFromUDP(buf)
+		n, _, err := sl.packetConn.ReadFrom(buf)
 
 		if err != nil {
 			// Exit the loop if the connection is closed
@@ -103,21 +162,78 @@ func (sl *statsDListener) readUDP(chData chan []byte) {
 				break
 			}
 
-			sl.logger.WithError(err).Error("Failed reading UDP datagram.")
+			sl.logger.WithError(err).Errorf("Failed reading %s datagram.", sl.protocol)
+			continue
+		}
+
+		atomic.AddInt64(&sl.packetsReceived, 1)
+		sl.bufferLines(strings.Split(string(buf[0:n]), "\n"))
+	}
+}
+
+func (sl *statsDListener) acceptStreams() {
+	for {
+		conn, err := sl.listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&sl.shutdownCalled) > 0 {
+				break
+			}
+
+			sl.logger.WithError(err).Errorf("Failed accepting %s connection.", sl.protocol)
 			continue
 		}
 
-		received := make([]byte, n)
-		copy(received, buf[0:n])
+		sl.Lock()
+		if sl.streamConns == nil {
+			sl.streamConns = make(map[net.Conn]bool)
+		}
+		sl.streamConns[conn] = true
+		sl.Unlock()
 
-		chData <- received
+		go sl.readStream(conn)
+	}
+}
+
+// readStream reads newline delimited metrics from a stream connection until
+// the client closes it.  Each line counts as a packet.
+func (sl *statsDListener) readStream(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		sl.Lock()
+		delete(sl.streamConns, conn)
+		sl.Unlock()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		atomic.AddInt64(&sl.packetsReceived, 1)
+		sl.bufferLines([]string{scanner.Text()})
+	}
+
+	if err := scanner.Err(); err != nil && atomic.LoadInt32(&sl.shutdownCalled) == 0 {
+		sl.logger.WithError(err).Errorf("Failed reading from %s connection.", sl.protocol)
 	}
 }
 
 func (sl *statsDListener) Close() {
-	if !sl.tcp {
-		atomic.StoreInt32(&sl.shutdownCalled, 1)
-		sl.udpConn.Close()
+	atomic.StoreInt32(&sl.shutdownCalled, 1)
+
+	if sl.packetConn != nil {
+		sl.packetConn.Close()
+		// Unlike stream listeners, datagram sockets don't remove their file
+		if sl.protocol == "unixgram" {
+			os.Remove(sl.socketPath)
+		}
+	}
+
+	if sl.listener != nil {
+		sl.listener.Close()
+
+		sl.Lock()
+		for conn := range sl.streamConns {
+			conn.Close()
+		}
+		sl.Unlock()
 	}
 }
 
@@ -131,20 +247,30 @@ func (sl *statsDListener) parseMetrics(raw []string) []*statsDMetric {
 		m, dims := parseDogstatsdTags(m, sl.logger)
 		colonIdx := strings.Index(m, ":")
 		pipeIdx := strings.Index(m, "|")
-		if pipeIdx >= len(m)-1 || pipeIdx < 0 || colonIdx-1 > len(m) || colonIdx < 0 {
+		if pipeIdx >= len(m)-1 || pipeIdx < 0 || colonIdx < 0 || colonIdx > pipeIdx {
+			atomic.AddInt64(&sl.parseErrors, 1)
 			sl.logger.Warnf("Invalid StatsD metric string : %s", m)
 			continue
 		}
-		secondPipeIdx := pipeIdx + strings.Index(m[pipeIdx+1:], "|")
 
 		rawMetricName := m[0:colonIdx]
 		metricName := ""
 
-		var metricType string
-		if secondPipeIdx > pipeIdx {
-			metricType = m[pipeIdx+1 : secondPipeIdx]
-		} else {
-			metricType = m[pipeIdx+1:]
+		// Everything after the value is of the form type[|@sampleRate]
+		fields := strings.Split(m[pipeIdx+1:], "|")
+		metricType := fields[0]
+
+		sampleRate := 1.0
+		var err error
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "@") {
+				continue
+			}
+			sampleRate, err = strconv.ParseFloat(f[1:], 64)
+			if err != nil || sampleRate <= 0 || sampleRate > 1 {
+				sl.logger.Warnf("Invalid StatsD sample rate %s in metric %s", f, m)
+				sampleRate = 1.0
+			}
 		}
 
 		if sl.prefix != "" {
@@ -158,19 +284,31 @@ func (sl *statsDListener) parseMetrics(raw []string) []*statsDMetric {
 		}
 
 		strValue := m[colonIdx+1 : pipeIdx]
-		value, err := strconv.ParseFloat(strValue, 64)
-
-		if err == nil {
-			metrics = append(metrics, &statsDMetric{
-				rawMetricName: rawMetricName,
-				metricName:    metricName,
-				metricType:    metricType,
-				value:         value,
-				dimensions:    dims,
-			})
-		} else {
+
+		metric := &statsDMetric{
+			rawMetricName: rawMetricName,
+			metricName:    metricName,
+			metricType:    metricType,
+			sampleRate:    sampleRate,
+			dimensions:    dims,
+		}
+
+		// Set values are only counted, so they can be arbitrary strings
+		if metricType == "s" {
+			metric.setValue = strValue
+			metrics = append(metrics, metric)
+			continue
+		}
+
+		metric.value, err = strconv.ParseFloat(strValue, 64)
+		if err != nil {
+			atomic.AddInt64(&sl.parseErrors, 1)
 			sl.logger.WithError(err).Errorf("Failed parsing metric value %s", strValue)
+			continue
 		}
+		metric.gaugeDelta = metricType == "g" && (strings.HasPrefix(strValue, "+") || strings.HasPrefix(strValue, "-"))
+
+		metrics = append(metrics, metric)
 	}
 
 	return metrics
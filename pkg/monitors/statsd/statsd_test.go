@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/utils"
+)
+
+func TestListenerTransports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statsd")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		protocol   string
+		socketPath string
+	}{
+		{"udp", ""},
+		{"tcp", ""},
+		{"unixgram", filepath.Join(dir, "statsd.dgram.sock")},
+		{"unix", filepath.Join(dir, "statsd.sock")},
+	}
+
+	for i := range cases {
+		tt := cases[i]
+		t.Run(tt.protocol, func(t *testing.T) {
+			sl := &statsDListener{
+				protocol:    tt.protocol,
+				ipAddr:      "127.0.0.1",
+				socketPath:  tt.socketPath,
+				maxBuffered: 3,
+				converters: []*converter{
+					{
+						pattern: parseFields("app.{service}.{action}", nil),
+						metric:  parseFields("{action}", nil),
+					},
+				},
+				logger: utils.NewThrottledLogger(log.WithField("test", t.Name()), time.Minute),
+			}
+			require.Nil(t, sl.Listen())
+			defer sl.Close()
+			go sl.Read()
+
+			var addr string
+			if sl.packetConn != nil {
+				addr = sl.packetConn.LocalAddr().String()
+			} else {
+				addr = sl.listener.Addr().String()
+			}
+
+			conn, err := net.Dial(tt.protocol, addr)
+			require.Nil(t, err)
+			defer conn.Close()
+
+			// The stream protocols need each metric to end with a newline
+			for _, line := range []string{
+				"app.web.requests:1|c|#env:prod\n",
+				"bad-metric\n",
+				"app.web.latency:5|ms\nother:2|g\n",
+				"dropped:1|c\n",
+			} {
+				_, err = conn.Write([]byte(line))
+				require.Nil(t, err)
+				if tt.protocol == "tcp" || tt.protocol == "unix" {
+					continue
+				}
+				// Give each datagram time to be read in order
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt64(&sl.metricsDropped) == 2
+			}, 5*time.Second, 10*time.Millisecond)
+
+			metrics := sl.FetchMetrics()
+			require.Len(t, metrics, 2)
+			require.Equal(t, "requests", metrics[0].metricName)
+			require.Equal(t, map[string]string{"env": "prod", "service": "web", "action": "requests"}, metrics[0].dimensions)
+			require.Equal(t, "latency", metrics[1].metricName)
+
+			require.Equal(t, int64(1), atomic.LoadInt64(&sl.parseErrors))
+			if tt.protocol == "tcp" || tt.protocol == "unix" {
+				require.Equal(t, int64(5), atomic.LoadInt64(&sl.packetsReceived))
+			} else {
+				require.Equal(t, int64(4), atomic.LoadInt64(&sl.packetsReceived))
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/signalfx/signalfx-agent/pkg/core/config"
 	"github.com/signalfx/signalfx-agent/pkg/core/config/validation"
@@ -12,6 +13,40 @@ import (
 
 // Used to validate configuration that is common to all monitors up front
 func validateConfig(monConfig config.MonitorCustomConfig) error {
+	if err := validateCoreConfig(monConfig); err != nil {
+		return err
+	}
+
+	if err := validation.ValidateStruct(monConfig); err != nil {
+		return err
+	}
+
+	return validation.ValidateCustomConfig(monConfig)
+}
+
+// ValidateMonitorConfig validates a monitor config in the same way as when a
+// monitor is created from it, but without creating the monitor.  Configs
+// with a discovery rule get part of their config from the discovered
+// endpoint, so only the parts that don't depend on the endpoint can be
+// validated for them.
+func ValidateMonitorConfig(conf *config.MonitorConfig) error {
+	monConfig, err := getCustomConfigForMonitor(conf)
+	if err != nil {
+		return err
+	}
+
+	monConfig, err = renderConfig(monConfig, nil)
+	if err != nil {
+		return err
+	}
+
+	if conf.DiscoveryRule != "" {
+		return validateCoreConfig(monConfig)
+	}
+	return validateConfig(monConfig)
+}
+
+func validateCoreConfig(monConfig config.MonitorCustomConfig) error {
 	conf := monConfig.MonitorConfigCore()
 
 	if _, ok := MonitorFactories[conf.Type]; !ok {
@@ -39,11 +74,30 @@ func validateConfig(monConfig config.MonitorCustomConfig) error {
 		return errors.New("configEndpointMappings is not useful without a discovery rule")
 	}
 
-	if err := validation.ValidateStruct(monConfig); err != nil {
-		return err
+	// These use the same expression language as discovery rules
+	for _, opt := range []struct {
+		name  string
+		exprs map[string]string
+	}{
+		{"configEndpointMappings", conf.ConfigEndpointMappings},
+		{"extraDimensionsFromEndpoint", conf.ExtraDimensionsFromEndpoint},
+		{"extraSpanTagsFromEndpoint", conf.ExtraSpanTagsFromEndpoint},
+		{"defaultSpanTagsFromEndpoint", conf.DefaultSpanTagsFromEndpoint},
+	} {
+		keys := make([]string, 0, len(opt.exprs))
+		for k := range opt.exprs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := services.ValidateDiscoveryRule(opt.exprs[k]); err != nil {
+				return fmt.Errorf("%s.%s is invalid: %v", opt.name, k, err)
+			}
+		}
 	}
 
-	return validation.ValidateCustomConfig(monConfig)
+	return nil
 }
 
 func configAcceptsEndpoints(monConfig config.MonitorCustomConfig) bool {
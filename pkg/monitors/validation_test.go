@@ -0,0 +1,78 @@
+package monitors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+)
+
+func TestValidateMonitorConfig(t *testing.T) {
+	DeregisterAll()
+	RegisterFakeMonitors()
+	defer DeregisterAll()
+
+	t.Run("valid static monitor", func(t *testing.T) {
+		require.Nil(t, ValidateMonitorConfig(&config.MonitorConfig{
+			Type:            "static1",
+			IntervalSeconds: 10,
+			OtherConfig:     map[string]interface{}{"myVar": "a"},
+		}))
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{Type: "nope", IntervalSeconds: 10})
+		require.Contains(t, err.Error(), "unknown monitor type")
+	})
+
+	t.Run("unknown option", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{
+			Type:            "static1",
+			IntervalSeconds: 10,
+			OtherConfig:     map[string]interface{}{"notAnOption": "a"},
+		})
+		require.NotNil(t, err)
+	})
+
+	t.Run("missing required field without discovery rule", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{Type: "dynamic1", IntervalSeconds: 10})
+		require.Contains(t, err.Error(), "required")
+	})
+
+	t.Run("required fields are deferred with discovery rule", func(t *testing.T) {
+		require.Nil(t, ValidateMonitorConfig(&config.MonitorConfig{
+			Type:            "dynamic1",
+			IntervalSeconds: 10,
+			DiscoveryRule:   `container_image =~ "redis"`,
+		}))
+	})
+
+	t.Run("discovery rule syntax", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{
+			Type:            "dynamic1",
+			IntervalSeconds: 10,
+			DiscoveryRule:   `container_image =~ "redis" &&`,
+		})
+		require.Contains(t, err.Error(), "discovery rule is invalid")
+	})
+
+	t.Run("endpoint expression syntax", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{
+			Type:                        "dynamic1",
+			IntervalSeconds:             10,
+			DiscoveryRule:               `container_image =~ "redis"`,
+			ExtraDimensionsFromEndpoint: map[string]string{"env": `Get(container_labels, "env"`},
+		})
+		require.Contains(t, err.Error(), "extraDimensionsFromEndpoint.env is invalid")
+	})
+
+	t.Run("discovery rule on monitor that doesn't accept endpoints", func(t *testing.T) {
+		err := ValidateMonitorConfig(&config.MonitorConfig{
+			Type:            "static1",
+			IntervalSeconds: 10,
+			DiscoveryRule:   `container_image =~ "redis"`,
+		})
+		require.Contains(t, err.Error(), "does not support discovery")
+	})
+}
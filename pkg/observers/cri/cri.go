@@ -0,0 +1,374 @@
+// Package cri is an observer that queries a container runtime that implements
+// the Kubernetes Container Runtime Interface (e.g. containerd or CRI-O) for
+// running containers and reports their ports as service endpoints.
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
+	"github.com/signalfx/signalfx-agent/pkg/observers"
+	"github.com/signalfx/signalfx-agent/pkg/observers/docker"
+	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
+)
+
+const (
+	observerType = "cri"
+
+	// The annotation that the kubelet puts on containers that describes the
+	// ports declared in the pod spec
+	k8sContainerPortsAnnotation = "io.kubernetes.container.ports"
+	k8sPodNameLabel             = "io.kubernetes.pod.name"
+)
+
+// OBSERVER(cri): Queries a container runtime that implements the Kubernetes
+// [Container Runtime Interface](https://kubernetes.io/docs/concepts/architecture/cri/)
+// (CRI), such as containerd or CRI-O, for running containers.  This is useful
+// on hosts that run containers without the Docker Engine.  If you are using
+// Kubernetes, you should generally use the [k8s-api
+// observer](./k8s-api.md) instead of this.
+//
+// The CRI API has no way to watch for changes, so the list of containers is
+// polled on the interval set by `pollIntervalSeconds`.
+//
+// The ports of each container are determined from the port mappings of the
+// container's pod sandbox (currently only reported by containerd) and from
+// the `io.kubernetes.container.ports` annotation that the kubelet puts on
+// containers.  Since port mappings are defined on the sandbox, they are
+// applied to every container in that sandbox.
+//
+// Containers can be configured with the same labels as the [docker
+// observer](./docker.md#configuration-from-labels) (e.g.
+// `agent.signalfx.com/monitorType.6379`: `collectd/redis`), which will also
+// cause an endpoint to be created for the port in the label.  The
+// `configFromEnv` label is not supported since the CRI API does not expose
+// container environment variables.
+//
+// Podman does not implement the CRI, so its containers can't be discovered by
+// this observer.  Use the [docker observer](./docker.md) with its `dockerURL`
+// option pointed at Podman's Docker-compatible API socket (e.g.
+// `unix:///run/podman/podman.sock`) instead.
+//
+// The agent will need permissions to access the runtime's socket, which
+// normally requires running as root.
+
+// ENDPOINT_TYPE(ContainerEndpoint): true
+
+var logger = log.WithFields(log.Fields{"observerType": observerType})
+
+// Config specific to the CRI observer
+type Config struct {
+	config.ObserverConfig
+	// The endpoint of the CRI runtime service.  For CRI-O this is normally
+	// `unix:///var/run/crio/crio.sock`.
+	RuntimeEndpoint string `yaml:"runtimeEndpoint" default:"unix:///run/containerd/containerd.sock"`
+	// How often to poll the runtime for the list of running containers
+	PollIntervalSeconds int `yaml:"pollIntervalSeconds" default:"10"`
+	// How long to wait for a response from the runtime before giving up on a
+	// given poll
+	Timeout timeutil.Duration `yaml:"timeout" default:"5s"`
+	// A mapping of container label names to dimension names that will get
+	// applied to the metrics of all discovered services. The corresponding
+	// label values will become the dimension values for the mapped name.  E.g.
+	// `io.kubernetes.container.name: container_spec_name` would result in a
+	// dimension called `container_spec_name` that has the value of the
+	// `io.kubernetes.container.name` container label.
+	LabelsToDimensions map[string]string `yaml:"labelsToDimensions"`
+	// If true, the observer will configure monitors for matching container
+	// endpoints using the host port and IP of the sandbox's port mappings, if
+	// any.
+	UseHostBindings bool `yaml:"useHostBindings" default:"false"`
+	// If true, the observer will ignore discovered container endpoints that
+	// are not bound to host ports.
+	IgnoreNonHostBindings bool `yaml:"ignoreNonHostBindings" default:"false"`
+}
+
+// CRI observer plugin
+type CRI struct {
+	serviceCallbacks *observers.ServiceCallbacks
+	serviceDiffer    *observers.ServiceDiffer
+	config           *Config
+	conn             *grpc.ClientConn
+	client           runtimeapi.RuntimeServiceClient
+}
+
+func init() {
+	observers.Register(observerType, func(cbs *observers.ServiceCallbacks) interface{} {
+		return &CRI{
+			serviceCallbacks: cbs,
+		}
+	}, &Config{})
+}
+
+// Configure the CRI observer
+func (o *CRI) Configure(conf *Config) error {
+	o.Shutdown()
+
+	conn, err := grpc.Dial(conf.RuntimeEndpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("could not connect to CRI runtime at %s: %v", conf.RuntimeEndpoint, err)
+	}
+
+	o.config = conf
+	o.conn = conn
+	o.client = runtimeapi.NewRuntimeServiceClient(conn)
+
+	o.serviceDiffer = &observers.ServiceDiffer{
+		DiscoveryFn:     o.discover,
+		IntervalSeconds: conf.PollIntervalSeconds,
+		Callbacks:       o.serviceCallbacks,
+	}
+	o.serviceDiffer.Start()
+
+	return nil
+}
+
+// sandboxInfo is the subset of the verbose sandbox status info from
+// containerd that we care about
+type sandboxInfo struct {
+	Config struct {
+		PortMappings []*runtimeapi.PortMapping `json:"port_mappings"`
+	} `json:"config"`
+}
+
+type sandbox struct {
+	ip           string
+	portMappings []*runtimeapi.PortMapping
+}
+
+// k8sContainerPort is how the kubelet serializes container ports in the
+// `io.kubernetes.container.ports` annotation
+type k8sContainerPort struct {
+	Name          string `json:"name"`
+	ContainerPort int32  `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+}
+
+func (o *CRI) discover() []services.Endpoint {
+	ctx, cancel := context.WithTimeout(context.Background(), o.config.Timeout.AsDuration())
+	defer cancel()
+
+	resp, err := o.client.ListContainers(ctx, &runtimeapi.ListContainersRequest{
+		Filter: &runtimeapi.ContainerFilter{
+			State: &runtimeapi.ContainerStateValue{State: runtimeapi.ContainerState_CONTAINER_RUNNING},
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Error("Could not list CRI containers")
+		return nil
+	}
+
+	sandboxes := map[string]*sandbox{}
+
+	var out []services.Endpoint
+	for _, cont := range resp.Containers {
+		sb, ok := sandboxes[cont.PodSandboxId]
+		if !ok {
+			sb, err = o.getSandbox(ctx, cont.PodSandboxId)
+			if err != nil {
+				logger.WithError(err).Errorf("Could not get status of CRI pod sandbox %s", cont.PodSandboxId)
+				continue
+			}
+			sandboxes[cont.PodSandboxId] = sb
+		}
+		out = append(out, o.endpointsForContainer(cont, sb)...)
+	}
+	return out
+}
+
+func (o *CRI) getSandbox(ctx context.Context, id string) (*sandbox, error) {
+	resp, err := o.client.PodSandboxStatus(ctx, &runtimeapi.PodSandboxStatusRequest{
+		PodSandboxId: id,
+		Verbose:      true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &sandbox{}
+	if resp.Status != nil && resp.Status.Network != nil {
+		sb.ip = resp.Status.Network.Ip
+	}
+
+	if infoJSON := resp.Info["info"]; infoJSON != "" {
+		var info sandboxInfo
+		if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+			logger.WithError(err).Debugf("Could not parse verbose info of CRI pod sandbox %s", id)
+		} else {
+			sb.portMappings = info.Config.PortMappings
+		}
+	}
+	return sb, nil
+}
+
+type portInfo struct {
+	hostPort int32
+	hostIP   string
+}
+
+func (o *CRI) endpointsForContainer(cont *runtimeapi.Container, sb *sandbox) []services.Endpoint {
+	labelConfigs := docker.GetConfigLabels(cont.Labels, nil)
+
+	knownPorts := map[docker.ContPort]bool{}
+	for port := range labelConfigs {
+		knownPorts[port] = true
+	}
+
+	// Keyed by the bare port since ports from labels can also have a name
+	hostPorts := map[nat.Port]portInfo{}
+	for _, pm := range sb.portMappings {
+		if pm.ContainerPort == 0 {
+			continue
+		}
+		port := newContPort(pm.ContainerPort, pm.Protocol.String())
+		knownPorts[port] = true
+		hostPorts[port.Port] = portInfo{hostPort: pm.HostPort, hostIP: pm.HostIp}
+	}
+
+	if portsJSON := cont.Annotations[k8sContainerPortsAnnotation]; portsJSON != "" {
+		var ports []k8sContainerPort
+		if err := json.Unmarshal([]byte(portsJSON), &ports); err != nil {
+			logger.WithError(err).Errorf("Could not parse ports annotation of CRI container %s", cont.Id)
+		}
+		for _, p := range ports {
+			knownPorts[newContPort(p.ContainerPort, p.Protocol)] = true
+		}
+	}
+
+	var instances []services.Endpoint
+	for portObj := range knownPorts {
+		endpoint := o.endpointForPort(portObj, hostPorts[portObj.Port], cont, sb)
+		if endpoint == nil {
+			continue
+		}
+
+		if labelConf := labelConfigs[portObj]; labelConf != nil {
+			endpoint.MonitorType = labelConf.MonitorType
+			endpoint.Configuration = labelConf.Configuration
+		}
+
+		instances = append(instances, endpoint)
+	}
+
+	// Add an "port-less" endpoint that identifies the container in general.
+	containerEndpoint := o.makeBaseEndpointForContainer(cont, sb, "portless", containerName(cont))
+	containerEndpoint.Target = services.TargetTypeContainer
+	instances = append(instances, containerEndpoint)
+
+	return instances
+}
+
+func newContPort(port int32, protocol string) docker.ContPort {
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return docker.ContPort{
+		Port: nat.Port(fmt.Sprintf("%d/%s", port, strings.ToLower(protocol))),
+	}
+}
+
+func containerName(cont *runtimeapi.Container) string {
+	if cont.Metadata != nil {
+		return cont.Metadata.Name
+	}
+	return ""
+}
+
+func (o *CRI) makeBaseEndpointForContainer(cont *runtimeapi.Container, sb *sandbox, idSuffix, name string) *services.ContainerEndpoint {
+	serviceContainer := &services.Container{
+		ID:     cont.Id,
+		Names:  []string{containerName(cont)},
+		State:  "running",
+		Labels: cont.Labels,
+	}
+	if cont.Image != nil {
+		serviceContainer.Image = cont.Image.Image
+	}
+
+	orchDims := map[string]string{}
+	for k, dimName := range o.config.LabelsToDimensions {
+		if v := cont.Labels[k]; v != "" {
+			orchDims[dimName] = v
+		}
+	}
+
+	orchestrator := services.NONE
+	if cont.Labels[k8sPodNameLabel] != "" {
+		orchestrator = services.KUBERNETES
+	}
+
+	shortID := cont.Id
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+
+	id := serviceContainer.PrimaryName() + "-" + shortID + "-" + idSuffix
+	endpoint := &services.ContainerEndpoint{
+		EndpointCore:  *services.NewEndpointCore(id, name, observerType, orchDims),
+		Container:     *serviceContainer,
+		Orchestration: *services.NewOrchestration("cri", orchestrator, services.PRIVATE),
+	}
+	endpoint.Host = sb.ip
+
+	if endpoint.Host == "" && o.config.UseHostBindings {
+		endpoint.Host = "127.0.0.1"
+	}
+
+	return endpoint
+}
+
+func (o *CRI) endpointForPort(portObj docker.ContPort, info portInfo, cont *runtimeapi.Container, sb *sandbox) *services.ContainerEndpoint {
+	port := portObj.Int()
+
+	if o.config.IgnoreNonHostBindings && info.hostPort == 0 {
+		return nil
+	}
+
+	idSuffix := strconv.Itoa(port)
+	if portObj.Name != "" {
+		idSuffix += "-" + portObj.Name
+	}
+
+	endpoint := o.makeBaseEndpointForContainer(cont, sb, idSuffix, portObj.Name)
+
+	endpoint.PortType = services.PortType(strings.ToUpper(portObj.Proto()))
+	endpoint.Target = services.TargetTypeHostPort
+
+	if o.config.UseHostBindings && info.hostPort != 0 {
+		endpoint.Orchestration.PortPref = services.PUBLIC
+		endpoint.Port = uint16(info.hostPort)
+		endpoint.AltPort = uint16(port)
+		endpoint.Host = info.hostIP
+		if endpoint.Host == "" || endpoint.Host == "0.0.0.0" {
+			endpoint.Host = "127.0.0.1"
+		}
+	} else {
+		endpoint.Port = uint16(port)
+		endpoint.AltPort = uint16(info.hostPort)
+	}
+
+	return endpoint
+}
+
+// Shutdown the service differ routine and close the runtime connection
+func (o *CRI) Shutdown() {
+	if o.serviceDiffer != nil {
+		o.serviceDiffer.Stop()
+		o.serviceDiffer = nil
+	}
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+}
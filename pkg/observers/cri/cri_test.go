@@ -0,0 +1,165 @@
+package cri
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
+	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
+)
+
+// fakeRuntime implements only the parts of the CRI runtime service that the
+// observer uses.
+type fakeRuntime struct {
+	runtimeapi.RuntimeServiceClient
+	containers []*runtimeapi.Container
+	sandboxes  map[string]*runtimeapi.PodSandboxStatusResponse
+}
+
+func (f *fakeRuntime) ListContainers(ctx context.Context, in *runtimeapi.ListContainersRequest, opts ...grpc.CallOption) (*runtimeapi.ListContainersResponse, error) {
+	return &runtimeapi.ListContainersResponse{Containers: f.containers}, nil
+}
+
+func (f *fakeRuntime) PodSandboxStatus(ctx context.Context, in *runtimeapi.PodSandboxStatusRequest, opts ...grpc.CallOption) (*runtimeapi.PodSandboxStatusResponse, error) {
+	return f.sandboxes[in.PodSandboxId], nil
+}
+
+func TestDiscover(t *testing.T) {
+	fake := &fakeRuntime{
+		containers: []*runtimeapi.Container{
+			{
+				Id:           "abcdef1234567890",
+				PodSandboxId: "sb1",
+				Metadata:     &runtimeapi.ContainerMetadata{Name: "redis"},
+				Image:        &runtimeapi.ImageSpec{Image: "docker.io/library/redis:latest"},
+				Labels: map[string]string{
+					"app":                                 "cache",
+					"agent.signalfx.com/monitorType.6379": "collectd/redis",
+				},
+			},
+			{
+				Id:           "1234567890abcdef",
+				PodSandboxId: "sb2",
+				Metadata:     &runtimeapi.ContainerMetadata{Name: "web"},
+				Image:        &runtimeapi.ImageSpec{Image: "nginx:1.23"},
+				Labels: map[string]string{
+					"io.kubernetes.pod.name": "web-1",
+				},
+				Annotations: map[string]string{
+					"io.kubernetes.container.ports": `[{"name":"http","containerPort":80,"protocol":"TCP"}]`,
+				},
+			},
+			{
+				Id:           "fedcba0987654321",
+				PodSandboxId: "sb3",
+				Metadata:     &runtimeapi.ContainerMetadata{Name: "memcached"},
+				Image:        &runtimeapi.ImageSpec{Image: "memcached:1.6"},
+				Labels: map[string]string{
+					"agent.signalfx.com/monitorType.11211-stats": "collectd/memcached",
+				},
+			},
+		},
+		sandboxes: map[string]*runtimeapi.PodSandboxStatusResponse{
+			"sb1": {
+				Status: &runtimeapi.PodSandboxStatus{
+					Network: &runtimeapi.PodSandboxNetworkStatus{Ip: "10.88.0.5"},
+				},
+				Info: map[string]string{
+					"info": `{"pid": 100, "config": {"port_mappings": [{"container_port": 6379, "host_port": 16379, "host_ip": "0.0.0.0"}]}}`,
+				},
+			},
+			"sb2": {
+				Status: &runtimeapi.PodSandboxStatus{
+					Network: &runtimeapi.PodSandboxNetworkStatus{Ip: "10.88.0.6"},
+				},
+			},
+			"sb3": {
+				Status: &runtimeapi.PodSandboxStatus{
+					Network: &runtimeapi.PodSandboxNetworkStatus{Ip: "10.88.0.7"},
+				},
+				Info: map[string]string{
+					"info": `{"config": {"port_mappings": [{"container_port": 11211, "host_port": 21211}]}}`,
+				},
+			},
+		},
+	}
+
+	newObserver := func(conf *Config) *CRI {
+		conf.Timeout = timeutil.Duration(1e9)
+		return &CRI{config: conf, client: fake}
+	}
+
+	endpointsByID := func(endpoints []services.Endpoint) map[services.ID]*services.ContainerEndpoint {
+		out := map[services.ID]*services.ContainerEndpoint{}
+		for _, e := range endpoints {
+			out[e.Core().ID] = e.(*services.ContainerEndpoint)
+		}
+		return out
+	}
+
+	t.Run("private ports", func(t *testing.T) {
+		endpoints := endpointsByID(newObserver(&Config{
+			LabelsToDimensions: map[string]string{"app": "app_name"},
+		}).discover())
+		require.Len(t, endpoints, 7)
+
+		redis := endpoints["redis-abcdef123456-6379"]
+		require.NotNil(t, redis)
+		require.Equal(t, "10.88.0.5", redis.Host)
+		require.Equal(t, uint16(6379), redis.Port)
+		require.Equal(t, uint16(16379), redis.AltPort)
+		require.Equal(t, services.PortType("TCP"), redis.PortType)
+		require.Equal(t, "collectd/redis", redis.MonitorType)
+		require.Equal(t, "cri", redis.DiscoveredBy)
+		require.Equal(t, services.NONE, redis.Orchestration.Type)
+
+		vars := services.EndpointAsMap(redis)
+		require.Equal(t, "redis", vars["container_name"])
+		require.Equal(t, "docker.io/library/redis:latest", vars["container_image"])
+		require.Equal(t, "abcdef1234567890", vars["container_id"])
+		require.Equal(t, "cache", vars["app_name"])
+		require.Equal(t, uint16(6379), vars["private_port"])
+
+		web := endpoints["web-1234567890ab-80"]
+		require.NotNil(t, web)
+		require.Equal(t, "10.88.0.6", web.Host)
+		require.Equal(t, uint16(80), web.Port)
+		require.Equal(t, services.KUBERNETES, web.Orchestration.Type)
+
+		require.Equal(t, services.TargetTypeContainer, endpoints["redis-abcdef123456-portless"].Target)
+		require.Contains(t, endpoints, services.ID("web-1234567890ab-portless"))
+
+		stats := endpoints["memcached-fedcba098765-11211-stats"]
+		require.NotNil(t, stats)
+		require.Equal(t, "stats", stats.Name)
+		require.Equal(t, uint16(11211), stats.Port)
+		require.Equal(t, uint16(21211), stats.AltPort)
+		require.Equal(t, "collectd/memcached", stats.MonitorType)
+	})
+
+	t.Run("host bindings", func(t *testing.T) {
+		endpoints := endpointsByID(newObserver(&Config{
+			UseHostBindings:       true,
+			IgnoreNonHostBindings: true,
+		}).discover())
+		require.Len(t, endpoints, 6)
+
+		redis := endpoints["redis-abcdef123456-6379"]
+		require.NotNil(t, redis)
+		require.Equal(t, "127.0.0.1", redis.Host)
+		require.Equal(t, uint16(16379), redis.Port)
+		require.Equal(t, uint16(16379), redis.PublicPort())
+		require.Equal(t, uint16(6379), redis.PrivatePort())
+		require.NotContains(t, endpoints, services.ID("web-1234567890ab-80"))
+
+		// Ports named in labels get the host port mapping too
+		stats := endpoints["memcached-fedcba098765-11211-stats"]
+		require.NotNil(t, stats)
+		require.Equal(t, uint16(21211), stats.Port)
+		require.Equal(t, "collectd/memcached", stats.MonitorType)
+	})
+}
@@ -8,13 +8,19 @@ import (
 	"github.com/signalfx/golib/v3/sfxclient"
 )
 
-// DiagnosticText outputs human-readable text about the active observers.
-func (om *ObserverManager) DiagnosticText() string {
+// ObserverTypes returns the types of the active observers in the order they
+// were configured.
+func (om *ObserverManager) ObserverTypes() []string {
 	observerTypes := make([]string, len(om.observers))
 	for i := range om.observers {
 		observerTypes[i] = om.observers[i]._type
 	}
-	return fmt.Sprintf("Observers active:                 %s", strings.Join(observerTypes, ", "))
+	return observerTypes
+}
+
+// DiagnosticText outputs human-readable text about the active observers.
+func (om *ObserverManager) DiagnosticText() string {
+	return fmt.Sprintf("Observers active:                 %s", strings.Join(om.ObserverTypes(), ", "))
 }
 
 // InternalMetrics returns a list of datapoints relevant to the internal status
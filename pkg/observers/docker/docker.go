@@ -89,6 +89,18 @@ const (
 // be considered for this endpoint**, and thus, no agent configuration can be
 // used anyway.
 //
+// Config values can also be pulled from the container's environment
+// variables with a label of the form `agent.signalfx.com.configFromEnv.<port
+// number>.<config_key>: <envvar name>`.  For example, the label
+// `agent.signalfx.com.configFromEnv.6379.auth`: `REDIS_PASSWORD` would set
+// the `auth` option to the value of the `REDIS_PASSWORD` envvar in the Redis
+// container.
+//
+// The labels can also use `agent.signalfx.com/` as the prefix instead of
+// `agent.signalfx.com.`, which matches the grammar of the annotations
+// supported by the [k8s-api observer](./k8s-api.md) (e.g.
+// `agent.signalfx.com/monitorType.6379`: `collectd/redis`).
+//
 // ### Multiple Monitors per Port
 // If you want to configure multiple monitors per port, you can specify the
 // port name in the form `<port number>-<port name>` instead of just the port
@@ -232,7 +244,7 @@ func (docker *Docker) endpointsForContainer(cont *dtypes.ContainerJSON) []servic
 	instances := make([]services.Endpoint, 0)
 
 	if cont.State.Running && !cont.State.Paused {
-		labelConfigs := GetConfigLabels(cont.Config.Labels)
+		labelConfigs := GetConfigLabels(cont.Config.Labels, EnvToMap(cont.Config.Env))
 		knownPorts := map[ContPort]bool{}
 
 		for port := range labelConfigs {
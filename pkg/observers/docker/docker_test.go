@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/services"
+	"github.com/signalfx/signalfx-agent/pkg/observers"
+	"github.com/signalfx/signalfx-agent/pkg/utils/timeutil"
+)
+
+// fakeDockerAPI serves just enough of the Docker Engine API to list and
+// inspect a fixed set of containers.
+func fakeDockerAPI(t *testing.T, containers map[string]*dtypes.ContainerJSON) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, "/"+dockerAPIVersion)
+		switch {
+		case path == "/containers/json":
+			var list []dtypes.Container
+			for id := range containers {
+				list = append(list, dtypes.Container{ID: id})
+			}
+			require.Nil(t, json.NewEncoder(rw).Encode(list))
+		case strings.HasPrefix(path, "/containers/") && strings.HasSuffix(path, "/json"):
+			id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+			cont, ok := containers[id]
+			if !ok {
+				rw.WriteHeader(404)
+				return
+			}
+			require.Nil(t, json.NewEncoder(rw).Encode(cont))
+		case path == "/events":
+			rw.WriteHeader(200)
+			rw.(http.Flusher).Flush()
+			<-req.Context().Done()
+		default:
+			rw.WriteHeader(404)
+		}
+	}))
+}
+
+func makeContainer(id string, labels map[string]string, env []string, ports ...nat.Port) *dtypes.ContainerJSON {
+	exposed := nat.PortSet{}
+	for _, p := range ports {
+		exposed[p] = struct{}{}
+	}
+
+	return &dtypes.ContainerJSON{
+		ContainerJSONBase: &dtypes.ContainerJSONBase{
+			ID:    id,
+			Name:  "/" + id,
+			State: &dtypes.ContainerState{Running: true, Status: "running"},
+		},
+		Config: &container.Config{
+			Image:        "redis:latest",
+			Labels:       labels,
+			Env:          env,
+			ExposedPorts: exposed,
+		},
+		NetworkSettings: &dtypes.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {IPAddress: "172.17.0.2"},
+			},
+		},
+	}
+}
+
+func TestLabelConfiguration(t *testing.T) {
+	server := fakeDockerAPI(t, map[string]*dtypes.ContainerJSON{
+		"abcdef1234567890": makeContainer("abcdef1234567890", map[string]string{
+			"agent.signalfx.com/monitorType.6379":        "collectd/redis",
+			"agent.signalfx.com/config.6379.databases":   "[0, 1]",
+			"agent.signalfx.com/configFromEnv.6379.auth": "REDIS_PASSWORD",
+			"agent.signalfx.com.config.8080-app.path":    "/metrics",
+			"agent.signalfx.com.monitorType.8080-app":    "prometheus-exporter",
+			"agent.signalfx.com.config.9000.missing":     "abc",
+			"agent.signalfx.com.configFromEnv.9000.user": "NOT_SET",
+		}, []string{"REDIS_PASSWORD=s3cr3t", "OTHER=1"}, "6379/tcp"),
+	})
+	defer server.Close()
+
+	var lock sync.Mutex
+	endpoints := map[services.ID]services.Endpoint{}
+
+	obs := &Docker{
+		serviceCallbacks: &observers.ServiceCallbacks{
+			Added: func(e services.Endpoint) {
+				lock.Lock()
+				defer lock.Unlock()
+				endpoints[e.Core().ID] = e
+			},
+			Removed: func(e services.Endpoint) {
+				lock.Lock()
+				defer lock.Unlock()
+				delete(endpoints, e.Core().ID)
+			},
+		},
+		endpointsByContainerID: make(map[string][]services.Endpoint),
+	}
+	require.Nil(t, obs.Configure(&Config{
+		DockerURL:         "tcp://" + strings.TrimPrefix(server.URL, "http://"),
+		CacheSyncInterval: timeutil.Duration(time.Hour),
+	}))
+	defer obs.Shutdown()
+
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(endpoints) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	redis := endpoints["abcdef1234567890-abcdef123456-6379"].Core()
+	require.Equal(t, "collectd/redis", redis.MonitorType)
+	require.Equal(t, map[string]interface{}{
+		"databases": []interface{}{0, 1},
+		"auth":      "s3cr3t",
+	}, redis.Configuration)
+	require.Equal(t, "172.17.0.2", redis.Host)
+	require.Equal(t, uint16(6379), redis.Port)
+
+	app := endpoints["abcdef1234567890-abcdef123456-8080-app"].Core()
+	require.Equal(t, "prometheus-exporter", app.MonitorType)
+	require.Equal(t, "app", app.Name)
+	require.Equal(t, map[string]interface{}{"path": "/metrics"}, app.Configuration)
+
+	other := endpoints["abcdef1234567890-abcdef123456-9000"].Core()
+	require.Equal(t, "", other.MonitorType)
+	require.Equal(t, map[string]interface{}{"missing": "abc"}, other.Configuration)
+
+	require.Contains(t, endpoints, services.ID("abcdef1234567890-abcdef123456-portless"))
+}
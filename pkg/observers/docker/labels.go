@@ -8,9 +8,11 @@ import (
 	"github.com/signalfx/signalfx-agent/pkg/utils"
 )
 
+// Both the original `agent.signalfx.com.` prefix and the
+// `agent.signalfx.com/` prefix used by the K8s annotations are accepted.
 var labelConfigRegexp = regexp.MustCompile(
-	`^agent.signalfx.com\.` +
-		`(?P<type>monitorType|config|port)` +
+	`^agent.signalfx.com[./]` +
+		`(?P<type>monitorType|config|configFromEnv|port)` +
 		`\.(?P<port>[\w]+)(?:-(?P<port_name>[\w]+))?` +
 		`(?:\.(?P<config_key>\w+))?$`)
 
@@ -26,8 +28,10 @@ type ContPort struct {
 	Name string
 }
 
-// GetConfigLabels converts a set of docker labels into configs organized based on the port
-func GetConfigLabels(labels map[string]string) map[ContPort]*LabelConfig {
+// GetConfigLabels converts a set of docker labels into configs organized based
+// on the port.  The env map holds the container's environment variables,
+// which are used to resolve `configFromEnv` labels.
+func GetConfigLabels(labels map[string]string, env map[string]string) map[ContPort]*LabelConfig {
 	portMap := map[ContPort]*LabelConfig{}
 
 	for k, v := range labels {
@@ -58,12 +62,35 @@ func GetConfigLabels(labels map[string]string) map[ContPort]*LabelConfig {
 			}
 		}
 
-		if groups["type"] == "monitorType" {
+		switch groups["type"] {
+		case "monitorType":
 			portMap[portObj].MonitorType = v
-		} else {
+		case "configFromEnv":
+			envVal, ok := env[v]
+			if !ok {
+				logger.Errorf("Docker label %s references envvar %s that is not set in the container", k, v)
+				continue
+			}
+			portMap[portObj].Configuration[groups["config_key"]] = utils.DecodeValueGenerically(strings.TrimSpace(envVal))
+		default:
 			portMap[portObj].Configuration[groups["config_key"]] = utils.DecodeValueGenerically(v)
 		}
 	}
 
 	return portMap
 }
+
+// EnvToMap converts a list of envvars of the form `KEY=value`, as provided by
+// the Docker API, to a map.
+func EnvToMap(env []string) map[string]string {
+	out := make(map[string]string, len(env))
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 {
+			out[parts[0]] = parts[1]
+		} else {
+			out[parts[0]] = ""
+		}
+	}
+	return out
+}
@@ -210,7 +210,7 @@ func (o *ECS) endpointsForContainer(cont *ecs.Container, taskDims map[string]str
 	instances := make([]services.Endpoint, 0)
 
 	if cont.KnownStatus == "RUNNING" {
-		labelConfigs := docker.GetConfigLabels(cont.Labels)
+		labelConfigs := docker.GetConfigLabels(cont.Labels, nil)
 		knownPorts := map[docker.ContPort]bool{}
 
 		for port := range labelConfigs {
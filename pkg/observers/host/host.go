@@ -27,6 +27,20 @@ const (
 // the listening sockets.
 //
 // It will look for all listening sockets on TCP and UDP over IPv4 and IPv6.
+// If `discoverUnixSockets` is `true`, it will also look for listening Unix
+// domain sockets that have a path on the filesystem.  Those endpoints will
+// have a `target` of `unix-socket`, no host or port, and the socket path in
+// the `unix_socket_path` variable.  For example, to monitor a Docker daemon
+// that listens on a socket in a non-default location you could use a monitor
+// config like:
+//
+// ```yaml
+// monitors:
+//  - type: docker-container-stats
+//    discoveryRule: target == "unix-socket" && unix_socket_path =~ "docker.sock$"
+//    configEndpointMappings:
+//      dockerURL: '"unix://" + unix_socket_path'
+// ```
 
 // DIMENSION(pid): The PID of the process that owns the listening endpoint
 
@@ -35,6 +49,23 @@ const (
 
 // ENDPOINT_VAR(is_ipv6|bool): Will be `true` if the endpoint is IPv6.
 
+// ENDPOINT_VAR(unix_socket_path): The filesystem path of the socket for
+// Unix domain socket endpoints.
+
+// ENDPOINT_VAR(process_user): The name of the user that the process runs as.
+
+// ENDPOINT_VAR(exe_path): The full path to the executable of the process.
+
+// ENDPOINT_VAR(cgroup): The cgroup path of the process (Linux only).  The
+// unified cgroup v2 hierarchy is used if available, otherwise the systemd
+// hierarchy.
+
+// ENDPOINT_VAR(systemd_unit): The systemd unit (e.g. `nginx.service`) that the
+// process belongs to, as determined from its cgroup (Linux only).
+
+// ENDPOINT_VAR(container_id): The id of the container that the process is
+// running in, if any, as determined from its cgroup (Linux only).
+
 // Observer that watches the current host
 type Observer struct {
 	serviceCallbacks *observers.ServiceCallbacks
@@ -51,6 +82,9 @@ type Config struct {
 	// monitors instantiated from discovery rules matching this endpoint.
 	OmitPIDDimension    bool `default:"false" yaml:"omitPIDDimension"`
 	PollIntervalSeconds int  `default:"10" yaml:"pollIntervalSeconds"`
+	// If `true`, listening Unix domain sockets will also be discovered
+	// (Linux only).
+	DiscoverUnixSockets bool `default:"false" yaml:"discoverUnixSockets"`
 }
 
 type processName struct {
@@ -132,6 +166,16 @@ func (o *Observer) discover() []services.Endpoint {
 		connsByPID[c.Pid] = append(connsByPID[c.Pid], &c)
 	}
 
+	socketPathsByPID := make(map[int32][]string)
+	if o.config.DiscoverUnixSockets {
+		socketPathsByPID = o.unixSocketsByPID()
+		for pid := range socketPathsByPID {
+			if _, ok := connsByPID[pid]; !ok {
+				connsByPID[pid] = nil
+			}
+		}
+	}
+
 	for pid, conns := range connsByPID {
 		proc, err := process.NewProcess(pid)
 
@@ -163,11 +207,14 @@ func (o *Observer) discover() []services.Endpoint {
 			dims["pid"] = strconv.Itoa(int(pid))
 		}
 
+		procInfo := getProcessInfo(proc)
+
 		for _, c := range conns {
 			se := services.NewEndpointCore(
 				fmt.Sprintf("%s-%d-%s-%d", c.Laddr.IP, c.Laddr.Port, portTypeToProtocol(c.Type), pid), name, observerType, dims)
 
 			se.AddExtraField("command", args)
+			procInfo.addToEndpoint(se.AddExtraField)
 
 			ip := c.Laddr.IP
 			// An IP addr of 0.0.0.0 means it listens on all interfaces, including
@@ -190,10 +237,54 @@ func (o *Observer) discover() []services.Endpoint {
 
 			endpoints = append(endpoints, se)
 		}
+
+		for _, path := range socketPathsByPID[pid] {
+			se := services.NewEndpointCore(fmt.Sprintf("unix-%s-%d", path, pid), name, observerType, dims)
+
+			se.AddExtraField("command", args)
+			se.AddExtraField("unix_socket_path", path)
+			procInfo.addToEndpoint(se.AddExtraField)
+
+			se.Target = services.TargetTypeUnixSocket
+			se.PortType = services.UNKNOWN
+
+			endpoints = append(endpoints, se)
+		}
 	}
 	return endpoints
 }
 
+// unixSocketsByPID returns the paths of listening Unix sockets, grouped by the
+// PID of the process that owns them.
+func (o *Observer) unixSocketsByPID() map[int32][]string {
+	out := make(map[int32][]string)
+
+	listening, err := listeningUnixSocketPaths()
+	if err != nil {
+		o.logger.WithError(err).Error("Could not get local Unix socket listeners")
+		return out
+	}
+
+	conns, err := net.Connections("unix")
+	if err != nil {
+		o.logger.WithError(err).Error("Could not get local Unix sockets")
+		return out
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range conns {
+		// The path is reported in the local address IP field
+		path := c.Laddr.IP
+		key := fmt.Sprintf("%s-%d", path, c.Pid)
+		if c.Pid == 0 || !listening[path] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out[c.Pid] = append(out[c.Pid], path)
+	}
+	return out
+}
+
 // Shutdown the service differ routine
 func (o *Observer) Shutdown() {
 	if o.serviceDiffer != nil {
@@ -2,8 +2,10 @@ package host
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -200,4 +202,44 @@ func Test_HostObserver(t *testing.T) {
 			}
 		})
 	})
+	t.Run("Unix sockets", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("Unix socket discovery is only supported on Linux")
+		}
+		config.DiscoverUnixSockets = true
+		defer func() { config.DiscoverUnixSockets = false }()
+
+		dir, err := ioutil.TempDir("", "host-observer")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		sockPath := filepath.Join(dir, "test.sock")
+		listener, err := net.Listen("unix", sockPath)
+		require.Nil(t, err)
+		defer listener.Close()
+
+		defer startObserver()()
+
+		expectedID := services.ID(fmt.Sprintf("unix-%s-%d", sockPath, selfPid))
+		require.Eventually(t, func() bool {
+			endpointLock.Lock()
+			defer endpointLock.Unlock()
+			return endpoints[expectedID] != nil
+		}, 2*time.Second, time.Millisecond)
+
+		endpointLock.Lock()
+		endpoint := endpoints[expectedID].(*services.EndpointCore)
+		endpointLock.Unlock()
+
+		require.Equal(t, services.TargetTypeUnixSocket, endpoint.Target)
+		require.Equal(t, filepath.Base(exe), endpoint.Name)
+
+		vars := services.EndpointAsMap(endpoint)
+		require.Equal(t, sockPath, vars["unix_socket_path"])
+		require.Equal(t, exe, vars["exe_path"])
+
+		currentUser, err := user.Current()
+		require.Nil(t, err)
+		require.Equal(t, currentUser.Username, vars["process_user"])
+	})
 }
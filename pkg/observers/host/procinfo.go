@@ -0,0 +1,167 @@
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/process"
+
+	"github.com/signalfx/signalfx-agent/pkg/utils/hostfs"
+)
+
+// processInfo is metadata about the process that owns an endpoint that is
+// exposed as endpoint variables
+type processInfo struct {
+	user        string
+	exePath     string
+	cgroup      string
+	systemdUnit string
+	containerID string
+}
+
+func (pi *processInfo) addToEndpoint(addField func(string, interface{})) {
+	addField("process_user", pi.user)
+	addField("exe_path", pi.exePath)
+	addField("cgroup", pi.cgroup)
+	addField("systemd_unit", pi.systemdUnit)
+	addField("container_id", pi.containerID)
+}
+
+// getProcessInfo gathers as much info about the process as possible, leaving
+// anything that can't be determined blank.
+func getProcessInfo(proc *process.Process) *processInfo {
+	info := &processInfo{}
+	info.user, _ = proc.Username()
+	info.exePath, _ = proc.Exe()
+
+	if content, err := ioutil.ReadFile(filepath.Join(hostProc(), strconv.Itoa(int(proc.Pid)), "cgroup")); err == nil {
+		info.cgroup = parseCgroupPath(content)
+		info.systemdUnit = systemdUnitFromCgroup(info.cgroup)
+		info.containerID = containerIDFromCgroup(info.cgroup)
+	}
+	return info
+}
+
+func hostProc() string {
+	if p := hostfs.HostProc(); p != "" {
+		return p
+	}
+	return "/proc"
+}
+
+// parseCgroupPath picks the most relevant cgroup path out of the contents of
+// a /proc/<pid>/cgroup file.  The unified (v2) hierarchy is preferred, then
+// the systemd hierarchy, then whatever hierarchy is listed first.
+func parseCgroupPath(content []byte) string {
+	var first, systemd, unified string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Lines are of the form hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			unified = parts[2]
+		case parts[1] == "name=systemd":
+			systemd = parts[2]
+		case first == "":
+			first = parts[2]
+		}
+	}
+
+	switch {
+	case unified != "" && unified != "/":
+		return unified
+	case systemd != "":
+		return systemd
+	case first != "":
+		return first
+	}
+	return unified
+}
+
+var systemdUnitRegexp = regexp.MustCompile(`^[^/]+\.(service|scope|socket)$`)
+
+// systemdUnitFromCgroup returns the innermost systemd unit in the cgroup
+// path, e.g. `nginx.service` for `/system.slice/nginx.service`.
+func systemdUnitFromCgroup(cgroup string) string {
+	parts := strings.Split(cgroup, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if systemdUnitRegexp.MatchString(parts[i]) {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+var containerIDRegexp = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerIDFromCgroup returns the id of the container the cgroup belongs
+// to, if any.  Docker, containerd and CRI-O all use the 64 character hex
+// container id somewhere in the cgroup path.
+func containerIDFromCgroup(cgroup string) string {
+	ids := containerIDRegexp.FindAllString(cgroup, -1)
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
+
+// unixSocketFlagAcceptCon is the flag set in /proc/net/unix on sockets that
+// are listening for connections
+const unixSocketFlagAcceptCon = 0x10000
+
+// listeningUnixSocketPaths returns the paths of all Unix stream sockets that
+// are listening for connections and all bound datagram sockets.
+func listeningUnixSocketPaths() (map[string]bool, error) {
+	content, err := ioutil.ReadFile(filepath.Join(hostProc(), "net", "unix"))
+	if err != nil {
+		return nil, err
+	}
+	return parseListeningUnixSockets(content)
+}
+
+func parseListeningUnixSockets(content []byte) (map[string]bool, error) {
+	out := map[string]bool{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// Skip the header line
+	scanner.Scan()
+	for scanner.Scan() {
+		// Num RefCount Protocol Flags Type St Inode Path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unix socket flags %s: %v", fields[3], err)
+		}
+		sockType, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unix socket type %s: %v", fields[4], err)
+		}
+
+		path := fields[7]
+		// Abstract sockets start with @ and can't be connected to by path
+		if strings.HasPrefix(path, "@") {
+			continue
+		}
+
+		if flags&unixSocketFlagAcceptCon != 0 || sockType == syscall.SOCK_DGRAM {
+			out[path] = true
+		}
+	}
+	return out, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupParsing(t *testing.T) {
+	t.Run("cgroup v2 systemd service", func(t *testing.T) {
+		cgroup := parseCgroupPath([]byte("0::/system.slice/nginx.service\n"))
+		require.Equal(t, "/system.slice/nginx.service", cgroup)
+		require.Equal(t, "nginx.service", systemdUnitFromCgroup(cgroup))
+		require.Equal(t, "", containerIDFromCgroup(cgroup))
+	})
+
+	t.Run("cgroup v1 docker container", func(t *testing.T) {
+		id := "3f5c4e27a1e1cb6f1b7c9f0f2d8b3a4c5d6e7f8091a2b3c4d5e6f708192a3b4c"
+		cgroup := parseCgroupPath([]byte(
+			"12:memory:/docker/" + id + "\n" +
+				"1:name=systemd:/system.slice/docker-" + id + ".scope\n" +
+				"0::/\n"))
+		require.Equal(t, "/system.slice/docker-"+id+".scope", cgroup)
+		require.Equal(t, "docker-"+id+".scope", systemdUnitFromCgroup(cgroup))
+		require.Equal(t, id, containerIDFromCgroup(cgroup))
+	})
+
+	t.Run("no systemd", func(t *testing.T) {
+		cgroup := parseCgroupPath([]byte("4:cpu,cpuacct:/mygroup\n"))
+		require.Equal(t, "/mygroup", cgroup)
+		require.Equal(t, "", systemdUnitFromCgroup(cgroup))
+	})
+}
+
+func TestParseListeningUnixSockets(t *testing.T) {
+	content := []byte(`Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 21133 /run/php/php-fpm.sock
+0000000000000000: 00000003 00000000 00000000 0001 03 21134 /run/php/php-fpm.sock
+0000000000000000: 00000002 00000000 00000000 0002 01 11213 /run/systemd/notify
+0000000000000000: 00000002 00000000 00010000 0001 01 11214 @/tmp/.X11-unix/X0
+0000000000000000: 00000003 00000000 00000000 0001 03 11215
+`)
+	paths, err := parseListeningUnixSockets(content)
+	require.Nil(t, err)
+	require.Equal(t, map[string]bool{
+		"/run/php/php-fpm.sock": true,
+		"/run/systemd/notify":   true,
+	}, paths)
+}
@@ -10,6 +10,8 @@
 package observers
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -56,19 +58,46 @@ type ServiceCallbacks struct {
 	Removed func(services.Endpoint)
 }
 
-func configureObserver(observer interface{}, conf *config.ObserverConfig) error {
-	log.WithFields(log.Fields{
-		"config": *conf,
-	}).Debug("Configuring observer")
+// ValidateObserverConfig checks the config of an observer against the
+// registered config template for its type without configuring an observer.
+func ValidateObserverConfig(conf *config.ObserverConfig) error {
+	_, err := decodeObserverConfig(conf)
+	return err
+}
 
-	finalConfig := utils.CloneInterface(ConfigTemplates[conf.Type])
+// Decodes the observer config into a clone of the registered template for
+// the observer type and validates it.
+func decodeObserverConfig(conf *config.ObserverConfig) (interface{}, error) {
+	template, ok := ConfigTemplates[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("observer type '%s' is not recognized", conf.Type)
+	}
+
+	finalConfig := utils.CloneInterface(template)
 
 	if err := config.FillInConfigTemplate("ObserverConfig", finalConfig, conf); err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := validation.ValidateStruct(finalConfig); err != nil {
+		return nil, errors.Wrap(err, "Observer config is invalid")
 	}
 
 	if err := validation.ValidateCustomConfig(finalConfig); err != nil {
-		return errors.Wrap(err, "Observer config is invalid")
+		return nil, errors.Wrap(err, "Observer config is invalid")
+	}
+
+	return finalConfig, nil
+}
+
+func configureObserver(observer interface{}, conf *config.ObserverConfig) error {
+	log.WithFields(log.Fields{
+		"config": *conf,
+	}).Debug("Configuring observer")
+
+	finalConfig, err := decodeObserverConfig(conf)
+	if err != nil {
+		return err
 	}
 
 	return config.CallConfigure(observer, finalConfig)
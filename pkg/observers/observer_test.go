@@ -0,0 +1,57 @@
+package observers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/signalfx/signalfx-agent/pkg/core/config"
+)
+
+type testObserverConfig struct {
+	config.ObserverConfig
+	Endpoint     string `yaml:"endpoint" validate:"required"`
+	PollInterval int    `yaml:"pollInterval" default:"10"`
+}
+
+func (c *testObserverConfig) Validate() error {
+	if c.PollInterval <= 0 {
+		return errors.New("pollInterval must be positive")
+	}
+	return nil
+}
+
+func init() {
+	Register("test-observer", func(cbs *ServiceCallbacks) interface{} {
+		return nil
+	}, &testObserverConfig{})
+}
+
+func TestValidateObserverConfig(t *testing.T) {
+	validate := func(otherConfig map[string]interface{}) error {
+		return ValidateObserverConfig(&config.ObserverConfig{Type: "test-observer", OtherConfig: otherConfig})
+	}
+
+	require.Nil(t, validate(map[string]interface{}{"endpoint": "localhost"}))
+
+	t.Run("unknown type", func(t *testing.T) {
+		require.NotNil(t, ValidateObserverConfig(&config.ObserverConfig{Type: "nope"}))
+	})
+
+	t.Run("unknown option", func(t *testing.T) {
+		require.NotNil(t, validate(map[string]interface{}{"endpoint": "localhost", "typo": true}))
+	})
+
+	t.Run("struct validation", func(t *testing.T) {
+		err := validate(map[string]interface{}{})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "endpoint")
+	})
+
+	t.Run("custom validation", func(t *testing.T) {
+		err := validate(map[string]interface{}{"endpoint": "localhost", "pollInterval": -1})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "pollInterval must be positive")
+	})
+}
@@ -31,7 +31,8 @@ func sortedDimensionString(dims map[string]string) string {
 	return tableString.String()
 }
 
-func dpTypeToString(t datapoint.MetricType) string {
+// MetricTypeToString returns a human readable name for the metric type
+func MetricTypeToString(t datapoint.MetricType) string {
 	switch t {
 	case datapoint.Gauge:
 		return "gauge"
@@ -53,7 +54,7 @@ func DatapointToString(dp *datapoint.Datapoint) string {
 	if !dp.Timestamp.IsZero() {
 		tsStr = dp.Timestamp.String()
 	}
-	return fmt.Sprintf("%s: %s (%s) %s\n%s\n", dp.Metric, dp.Value, strings.ToUpper(dpTypeToString(dp.MetricType)), tsStr, sortedDimensionString(dp.Dimensions))
+	return fmt.Sprintf("%s: %s (%s) %s\n%s\n", dp.Metric, dp.Value, strings.ToUpper(MetricTypeToString(dp.MetricType)), tsStr, sortedDimensionString(dp.Dimensions))
 }
 
 // BoolToInt returns 1 if b is true and 0 otherwise.  It is useful for
@@ -137,9 +137,10 @@ func NewThrottledLogger(logger logrus.FieldLogger, duration time.Duration) *Thro
 
 func (tl *ThrottledLogger) copy(newLogger logrus.FieldLogger) *ThrottledLogger {
 	return &ThrottledLogger{
-		FieldLogger: newLogger,
-		errorsSeen:  tl.errorsSeen,
-		duration:    tl.duration,
+		FieldLogger:  newLogger,
+		errorsSeen:   tl.errorsSeen,
+		warningsSeen: tl.warningsSeen,
+		duration:     tl.duration,
 	}
 }
 
@@ -29,6 +29,34 @@ func ConvertToMapViaYAML(obj interface{}) (map[string]interface{}, error) {
 	return newMap, nil
 }
 
+// ConvertYAMLValueForJSON recursively converts the map[interface{}]interface{}
+// values that come out of YAML unmarshalling to map[string]interface{} so
+// that they can be serialized as JSON.
+func ConvertYAMLValueForJSON(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, iv := range v {
+			out[fmt.Sprintf("%v", k)] = ConvertYAMLValueForJSON(iv)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, iv := range v {
+			out[k] = ConvertYAMLValueForJSON(iv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = ConvertYAMLValueForJSON(v[i])
+		}
+		return out
+	default:
+		return val
+	}
+}
+
 // YAMLNameOfField returns the YAML key that is used for the given struct
 // field.  It does this by actually serializing the field and parsing the
 // output string.  If the field has no key (e.g. if the `yaml:"-"` tag is set,